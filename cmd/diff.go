@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/config"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <client> <client>",
+	Short: "Compare the cached UserData of two Jellyfin servers",
+	Long: `The 'diff' command compares the UserData of two configured clients as cached in the
+local database by the last sync. Items are matched using the same keys that are used for syncing.
+
+It lists all items that are missing on one of the servers or that differ in their watched state,
+their resume position or their favorite state.`,
+	Args: cobra.ExactArgs(2),
+	Run:  Diff,
+}
+
+var (
+	flagDiffUser   string
+	flagDiffTypes  []string
+	flagDiffOutput string
+	flagDiffAll    bool
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&flagDiffUser, "user", "u", "", "The user to compare, may be omitted if only a single user is configured")
+	diffCmd.Flags().StringSliceVarP(&flagDiffTypes, "type", "t", nil, "The item types to compare, defaults to the configured item types")
+	diffCmd.Flags().StringVar(&flagDiffOutput, "output", outputTable, "Output format, one of 'table', 'json' or 'csv'")
+	diffCmd.Flags().BoolVar(&flagDiffAll, "all", false, "Also list items that do not differ")
+}
+
+type diffEntry struct {
+	User        string            `json:"user"`
+	Type        jellyfin.ItemType `json:"type"`
+	Differences []string          `json:"differences"`
+	sqlite.ItemDiff
+}
+
+func Diff(cmd *cobra.Command, args []string) {
+	cfg := mustLoadConfig()
+
+	serverA, serverB := args[0], args[1]
+	for _, server := range args {
+		if _, found := cfg.Clients[server]; !found {
+			log.Fatal().Msgf("unknown client %q", server)
+		}
+	}
+	if serverA == serverB {
+		log.Fatal().Msg("can not compare a client with itself")
+	}
+
+	if flagDiffOutput != outputTable && flagDiffOutput != outputJson && flagDiffOutput != outputCsv {
+		log.Fatal().Msgf("invalid output format %q", flagDiffOutput)
+	}
+
+	user, err := resolveUser(cfg, flagDiffUser)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not determine user")
+	}
+
+	itemTypes := flagDiffTypes
+	if len(itemTypes) == 0 {
+		itemTypes = cfg.ItemTypes
+	}
+
+	db := mustOpenDb(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	entries := []diffEntry{}
+	for _, itemType := range itemTypes {
+		diffs, err := db.GetItemDiff(ctx, user, serverA, serverB, jellyfin.ItemType(itemType))
+		if err != nil {
+			log.Fatal().Err(err).Str("type", itemType).Msg("could not compare items")
+		}
+
+		for _, diff := range diffs {
+			differences := diff.Differences()
+			if len(differences) == 0 && !flagDiffAll {
+				continue
+			}
+
+			entries = append(entries, diffEntry{
+				User:        user,
+				Type:        jellyfin.ItemType(itemType),
+				Differences: differences,
+				ItemDiff:    diff,
+			})
+		}
+	}
+
+	if err := printDiff(os.Stdout, flagDiffOutput, serverA, serverB, entries); err != nil {
+		log.Fatal().Err(err).Msg("could not print differences")
+	}
+}
+
+// resolveUser returns the given user if it's configured. If no user is given, the only configured user is returned.
+func resolveUser(cfg *config.Config, user string) (string, error) {
+	users := cfg.GetUsers()
+	if user != "" {
+		if _, found := users[user]; !found {
+			return "", fmt.Errorf("unknown user %q", user)
+		}
+		return user, nil
+	}
+
+	if len(users) != 1 {
+		return "", errors.New("multiple users configured, a user needs to be specified")
+	}
+
+	for name := range users {
+		user = name
+	}
+	return user, nil
+}
+
+func printDiff(w io.Writer, format, serverA, serverB string, entries []diffEntry) error {
+	switch format {
+	case outputJson:
+		return printJson(w, entries)
+	case outputCsv:
+		writer := csv.NewWriter(w)
+		header := []string{"user", "type", "match_key", "name", "series_name", "differences"}
+		for _, server := range []string{serverA, serverB} {
+			header = append(header, server+"_id", server+"_played", server+"_watched_date", server+"_position_ticks", server+"_favorite")
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			record := []string{entry.User, string(entry.Type), entry.MatchKey, entry.Name, entry.SeriesName, strings.Join(entry.Differences, ";")}
+			for _, state := range []sqlite.ItemState{entry.A, entry.B} {
+				record = append(record, state.LocalID, strconv.FormatBool(state.Played), strconv.FormatInt(state.WatchedDate, 10), strconv.FormatInt(state.WatchedPositionTicks, 10), strconv.FormatBool(state.IsFavorite))
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(tw, "TYPE\tNAME\tDIFFERENCES\t%s\t%s\n", strings.ToUpper(serverA), strings.ToUpper(serverB))
+		for _, entry := range entries {
+			name := entry.Name
+			if entry.SeriesName != "" {
+				name = fmt.Sprintf("%s - %s", entry.SeriesName, entry.Name)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.Type, name, strings.Join(entry.Differences, ","), formatItemState(entry.A), formatItemState(entry.B))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %q", format)
+	}
+}
+
+func formatItemState(state sqlite.ItemState) string {
+	if state.IsMissing() {
+		return "-"
+	}
+
+	watched := "never"
+	if state.WatchedDate > 0 {
+		watched = time.Unix(state.WatchedDate, 0).Format(time.DateTime)
+	}
+	return fmt.Sprintf("played=%t watched=%s position=%d favorite=%t", state.Played, watched, state.WatchedPositionTicks, state.IsFavorite)
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the changes jellyporter has made to the UserData on the Jellyfin servers",
+	Long: `The 'history' command lists the entries of the changelog, newest first. Each entry is
+an update of an item's UserData that jellyporter has sent to a Jellyfin server.
+
+Entries can be filtered by server, user, item, time range and the field that has been changed.`,
+	Args: cobra.NoArgs,
+	Run:  History,
+}
+
+var (
+	flagHistoryServer string
+	flagHistoryUser   string
+	flagHistoryRun    string
+	flagHistoryItem   string
+	flagHistorySince  string
+	flagHistoryUntil  string
+	flagHistoryField  string
+	flagHistoryLimit  int
+	flagHistoryOutput string
+)
+
+var changelogFields = []string{sqlite.FieldWatchedDate, sqlite.FieldPositionTicks, sqlite.FieldPlayed, sqlite.FieldFavorite}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVarP(&flagHistoryServer, "server", "s", "", "Only show changes made to the given client")
+	historyCmd.Flags().StringVarP(&flagHistoryUser, "user", "u", "", "Only show changes made for the given user")
+	historyCmd.Flags().StringVar(&flagHistoryRun, "run", "", "Only show changes made by the sync run with the given ID")
+	historyCmd.Flags().StringVarP(&flagHistoryItem, "item", "i", "", "Only show changes of items with the given ID or whose name or series contains the given text")
+	historyCmd.Flags().StringVar(&flagHistorySince, "since", "", "Only show changes since the given time, either a duration such as '24h' or a RFC3339 timestamp")
+	historyCmd.Flags().StringVar(&flagHistoryUntil, "until", "", "Only show changes until the given time, either a duration such as '24h' or a RFC3339 timestamp")
+	historyCmd.Flags().StringVarP(&flagHistoryField, "field", "f", "", fmt.Sprintf("Only show changes of the given field, one of %s", strings.Join(changelogFields, ", ")))
+	historyCmd.Flags().IntVarP(&flagHistoryLimit, "limit", "n", 100, "Maximum number of changes to show")
+	historyCmd.Flags().StringVar(&flagHistoryOutput, "output", outputTable, "Output format, one of 'table', 'json' or 'csv'")
+}
+
+func History(cmd *cobra.Command, args []string) {
+	cfg := mustLoadConfig()
+
+	if flagHistoryOutput != outputTable && flagHistoryOutput != outputJson && flagHistoryOutput != outputCsv {
+		log.Fatal().Msgf("invalid output format %q", flagHistoryOutput)
+	}
+
+	if flagHistoryField != "" && !slices.Contains(changelogFields, flagHistoryField) {
+		log.Fatal().Msgf("invalid field %q", flagHistoryField)
+	}
+
+	filter := sqlite.ChangelogFilter{
+		Server: flagHistoryServer,
+		User:   flagHistoryUser,
+		RunID:  flagHistoryRun,
+		Item:   flagHistoryItem,
+		Field:  flagHistoryField,
+		Limit:  flagHistoryLimit,
+	}
+
+	var err error
+	if filter.Since, err = parseTime(flagHistorySince); err != nil {
+		log.Fatal().Err(err).Msg("invalid value for --since")
+	}
+	if filter.Until, err = parseTime(flagHistoryUntil); err != nil {
+		log.Fatal().Err(err).Msg("invalid value for --until")
+	}
+
+	db := mustOpenDb(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	entries, err := db.GetChangelog(ctx, filter)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not query changelog")
+	}
+
+	if err := printChangelog(os.Stdout, flagHistoryOutput, entries); err != nil {
+		log.Fatal().Err(err).Msg("could not print changelog")
+	}
+}
+
+// parseTime parses either a duration that is subtracted from the current time or a RFC3339 timestamp or date.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return ts, nil
+	}
+
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+func printChangelog(w io.Writer, format string, entries []sqlite.ChangelogEntry) error {
+	switch format {
+	case outputJson:
+		return printJson(w, entries)
+	case outputCsv:
+		writer := csv.NewWriter(w)
+		if err := writer.Write([]string{"id", "date", "server", "user", "local_id", "type", "name", "series_name", "reason", "run_id", "reverts", "reverted_by", "source_server", "source_local_id", "changed_fields", "watched_date", "position_ticks", "played", "favorite"}); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			record := []string{
+				strconv.FormatInt(entry.ID, 10),
+				entry.Date.Format(time.RFC3339),
+				entry.Server,
+				entry.User,
+				entry.LocalID,
+				entry.Type,
+				entry.Name,
+				entry.SeriesName,
+				entry.Reason,
+				entry.RunID,
+				strconv.FormatInt(entry.Reverts, 10),
+				strconv.FormatInt(entry.RevertedBy, 10),
+				entry.SourceServer,
+				entry.SourceLocalID,
+				strings.Join(entry.ChangedFields(), ";"),
+				strconv.FormatInt(entry.NewWatchedDate, 10),
+				strconv.FormatInt(entry.NewWatchedPositionTicks, 10),
+				strconv.FormatBool(entry.NewPlayed),
+				strconv.FormatBool(entry.NewIsFavorite),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ID\tDATE\tRUN\tSERVER\tUSER\tTYPE\tNAME\tREASON\tSOURCE\tCHANGED\tWATCHED\tPOSITION\tPLAYED\tFAVORITE")
+		for _, entry := range entries {
+			name := entry.Name
+			if name == "" {
+				name = entry.LocalID
+			} else if entry.SeriesName != "" {
+				name = fmt.Sprintf("%s - %s", entry.SeriesName, entry.Name)
+			}
+
+			watched := "never"
+			if entry.NewWatchedDate > 0 {
+				watched = time.Unix(entry.NewWatchedDate, 0).Format(time.DateTime)
+			}
+
+			source := "-"
+			if entry.SourceServer != "" {
+				source = entry.SourceServer
+			}
+
+			reason := entry.Reason
+			if entry.Reverts > 0 {
+				reason = fmt.Sprintf("%s #%d", entry.Reason, entry.Reverts)
+			}
+
+			run := "-"
+			if entry.RunID != "" {
+				run = entry.RunID
+			}
+
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%t\t%t\n", entry.ID, entry.Date.Format(time.DateTime), run, entry.Server, entry.User, entry.Type, name, reason, source, strings.Join(entry.ChangedFields(), ","), watched, entry.NewWatchedPositionTicks, entry.NewPlayed, entry.NewIsFavorite)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %q", format)
+	}
+}
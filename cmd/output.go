@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/soerenschneider/jellyporter/internal"
+)
+
+const (
+	outputTable = "table"
+	outputJson  = "json"
+	outputCsv   = "csv"
+)
+
+func printPlannedUpdates(w io.Writer, format string, updates []internal.PlannedUpdate) error {
+	switch format {
+	case outputJson:
+		return printJson(w, updates)
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "SERVER\tUSER\tTYPE\tID\tNAME\tFIELD\tVALUE")
+		for _, update := range updates {
+			name := update.Name
+			if update.SeriesName != "" {
+				name = fmt.Sprintf("%s - %s", update.SeriesName, update.Name)
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", update.Server, update.User, update.Type, update.LocalID, name, update.Field, update.Value)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %q", format)
+	}
+}
+
+func printJson(w io.Writer, data any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/spf13/cobra"
+)
+
+var revertCmd = &cobra.Command{
+	Use:   "revert",
+	Short: "Undo changes jellyporter has made to the UserData on the Jellyfin servers",
+	Long: `The 'revert' command restores the previous UserData of items that have been updated by
+jellyporter, e.g. after a bad match has marked the wrong item as watched.
+
+The changes to revert are selected from the changelog by an ID range, a time window or the ID
+of a sync run, see the 'history' command. Changes are reverted newest first and each revert is
+recorded in the changelog itself.
+
+If the '--dry-run' flag is provided, the updates are only reported instead of sent to Jellyfin.`,
+	Args: cobra.NoArgs,
+	Run:  Revert,
+}
+
+var (
+	flagRevertFromId int64
+	flagRevertToId   int64
+	flagRevertSince  string
+	flagRevertUntil  string
+	flagRevertRun    string
+	flagRevertServer string
+	flagRevertUser   string
+	flagRevertDryRun bool
+	flagRevertOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(revertCmd)
+
+	revertCmd.Flags().Int64Var(&flagRevertFromId, "from-id", 0, "Revert changes with an ID greater than or equal to the given ID")
+	revertCmd.Flags().Int64Var(&flagRevertToId, "to-id", 0, "Revert changes with an ID less than or equal to the given ID")
+	revertCmd.Flags().StringVar(&flagRevertSince, "since", "", "Revert changes since the given time, either a duration such as '24h' or a RFC3339 timestamp")
+	revertCmd.Flags().StringVar(&flagRevertUntil, "until", "", "Revert changes until the given time, either a duration such as '24h' or a RFC3339 timestamp")
+	revertCmd.Flags().StringVar(&flagRevertRun, "run", "", "Revert changes made by the sync run with the given ID")
+	revertCmd.Flags().StringVarP(&flagRevertServer, "server", "s", "", "Only revert changes made to the given client")
+	revertCmd.Flags().StringVarP(&flagRevertUser, "user", "u", "", "Only revert changes made for the given user")
+	revertCmd.Flags().BoolVar(&flagRevertDryRun, "dry-run", false, "Only report the updates instead of sending them to Jellyfin")
+	revertCmd.Flags().StringVar(&flagRevertOutput, "output", outputTable, "Output format of the updates in dry run mode, one of 'table' or 'json'")
+}
+
+func Revert(cmd *cobra.Command, args []string) {
+	cfg := mustLoadConfig()
+
+	if flagRevertFromId == 0 && flagRevertToId == 0 && flagRevertSince == "" && flagRevertUntil == "" && flagRevertRun == "" {
+		log.Fatal().Msg("at least one of --from-id, --to-id, --since, --until or --run is required")
+	}
+
+	if flagRevertDryRun && flagRevertOutput != outputTable && flagRevertOutput != outputJson {
+		log.Fatal().Msgf("invalid output format %q", flagRevertOutput)
+	}
+
+	filter := sqlite.ChangelogFilter{
+		Server: flagRevertServer,
+		User:   flagRevertUser,
+		RunID:  flagRevertRun,
+		FromID: flagRevertFromId,
+		ToID:   flagRevertToId,
+		// all matching changes are reverted
+		Limit: math.MaxInt32,
+	}
+
+	var err error
+	if filter.Since, err = parseTime(flagRevertSince); err != nil {
+		log.Fatal().Err(err).Msg("invalid value for --since")
+	}
+	if filter.Until, err = parseTime(flagRevertUntil); err != nil {
+		log.Fatal().Err(err).Msg("invalid value for --until")
+	}
+
+	clients := mustBuildClients(cfg)
+
+	db := mustOpenDb(cfg)
+
+	var appOpts []internal.AppOpts
+	if flagRevertDryRun {
+		appOpts = append(appOpts, internal.WithDryRun())
+	}
+
+	app, err := internal.NewApp(clients, db, cfg, appOpts...)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("could not build app")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	_, err = app.Revert(ctx, filter)
+	if flagRevertDryRun {
+		if printErr := printPlannedUpdates(os.Stdout, flagRevertOutput, app.PlannedUpdates()); printErr != nil {
+			log.Fatal().Err(printErr).Msg("could not print planned updates")
+		}
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("could not revert all changes")
+		os.Exit(1)
+	}
+}
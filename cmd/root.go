@@ -1,8 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal"
+	"github.com/soerenschneider/jellyporter/internal/config"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
 	"github.com/spf13/cobra"
 )
 
@@ -45,3 +51,68 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&flagConfigPath, "config", "c", "", "Path to YAML config file")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+func mustLoadConfig() *config.Config {
+	log.Info().Msgf("Using config file %s", configPath)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load config")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("configuration invalid")
+	}
+
+	return cfg
+}
+
+func mustBuildClients(cfg *config.Config) map[string]internal.JellyfinClient {
+	clients := make(map[string]internal.JellyfinClient)
+	for name, c := range cfg.Clients {
+		apiKey, err := c.GetApiKey()
+		if err != nil {
+			log.Fatal().Err(err).Str("server", name).Msg("could not gather apikey")
+		}
+		clients[name] = jellyfin.NewJellyfinClient(c.Address, apiKey)
+	}
+	return clients
+}
+
+// mustOpenDb opens and migrates the SQLite cache configured the same way for every command, so queries apply the
+// configured conflict policies, match priorities and replication sources.
+func mustOpenDb(cfg *config.Config) *sqlite.SQLiteJellyDb {
+	dbOpts, err := buildDbOpts(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("could not build sqlite db options")
+	}
+
+	db, err := sqlite.New(cfg.Database.Path, dbOpts...)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("could not create sqlite db")
+	}
+
+	return db
+}
+
+// buildDbOpts returns the options to configure the SQLite cache, e.g. the conflict policy per item type and the
+// servers each server receives updates from.
+func buildDbOpts(cfg *config.Config) ([]sqlite.SQLiteJellyDbOpts, error) {
+	var opts []sqlite.SQLiteJellyDbOpts
+	for itemType, conf := range cfg.ConflictPolicies {
+		policy, err := sqlite.ParseConflictPolicy(conf.Policy, conf.Primary)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conflict policy of %q: %w", itemType, err)
+		}
+		opts = append(opts, sqlite.WithConflictPolicy(jellyfin.ItemType(itemType), policy))
+	}
+
+	for itemType, priority := range cfg.MatchPriorities {
+		opts = append(opts, sqlite.WithMatchPriority(jellyfin.ItemType(itemType), priority))
+	}
+
+	if sources := cfg.GetReplicationSources(); sources != nil {
+		opts = append(opts, sqlite.WithReplicationSources(sources))
+	}
+
+	return opts, nil
+}
@@ -2,19 +2,25 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/jellyporter/internal"
+	"github.com/soerenschneider/jellyporter/internal/api"
 	"github.com/soerenschneider/jellyporter/internal/config"
-	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
 	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/events/mqtt"
 	"github.com/soerenschneider/jellyporter/internal/events/webhook"
-	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/events/websocket"
+	"github.com/soerenschneider/jellyporter/internal/health"
 	"github.com/soerenschneider/jellyporter/internal/metrics"
 	"github.com/spf13/cobra"
 	"go.uber.org/multierr"
@@ -30,7 +36,10 @@ across multiple configured Jellyfin servers.
 By default, this command runs as a long-lived daemon, polling or responding to event sources
 (e.g., webhooks) to perform syncs in real time.
 
-If the '--once' flag is provided, jellyporter will perform a single sync pass and then exit.`,
+If the '--once' flag is provided, jellyporter will perform a single sync pass and then exit.
+
+If the '--dry-run' flag is provided, jellyporter will perform a single sync pass that fetches and
+matches all items, but only reports the planned updates instead of sending them to Jellyfin.`,
 	Run: Run,
 }
 
@@ -39,6 +48,8 @@ func init() {
 
 	runCmd.Flags().BoolVarP(&flagDebug, "debug", "d", false, "Print debug statements")
 	runCmd.Flags().BoolVarP(&flagOnce, "once", "o", false, "Do not run as daemon but only sync once and exit")
+	runCmd.Flags().BoolVar(&flagDryRun, "dry-run", false, "Sync once and only report planned updates without updating Jellyfin")
+	runCmd.Flags().StringVar(&flagOutput, "output", outputTable, "Output format of the planned updates, one of 'table' or 'json'")
 }
 
 const (
@@ -46,8 +57,10 @@ const (
 )
 
 var (
-	flagDebug bool
-	flagOnce  bool
+	flagDebug  bool
+	flagOnce   bool
+	flagDryRun bool
+	flagOutput string
 
 	BuildVersion = "dev"
 	CommitHash   = "unknown"
@@ -62,35 +75,30 @@ func Run(cmd *cobra.Command, args []string) {
 	metrics.Version.WithLabelValues(BuildVersion, GoVersion).Set(1)
 	metrics.Heartbeat.SetToCurrentTime()
 
-	log.Info().Msgf("Using config file %s", configPath)
-	cfg, err := config.LoadConfig(configPath)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to load config")
-	}
+	cfg := mustLoadConfig()
 
-	if err := cfg.Validate(); err != nil {
-		log.Fatal().Err(err).Msg("configuration invalid")
+	if flagDryRun && flagOutput != outputTable && flagOutput != outputJson {
+		log.Fatal().Msgf("invalid output format %q", flagOutput)
 	}
 
-	clients := make(map[string]internal.JellyfinClient)
-	for name, c := range cfg.Clients {
-		apiKey, err := c.GetApiKey()
-		if err != nil {
-			log.Fatal().Err(err).Str("server", name).Msg("could not gather apikey")
-		}
-		clients[name] = jellyfin.NewJellyfinClient(c.Address, apiKey, c.User)
-	}
+	clients := mustBuildClients(cfg)
 
-	db, err := sqlite.New(cfg.Database.Path)
-	if err != nil {
-		log.Fatal().Err(err).Msgf("could not create sqlite db")
+	db := mustOpenDb(cfg)
+
+	var appOpts []internal.AppOpts
+	if flagDryRun {
+		appOpts = append(appOpts, internal.WithDryRun())
 	}
 
-	app, err := internal.NewApp(clients, db, cfg)
+	app, err := internal.NewApp(clients, db, cfg, appOpts...)
 	if err != nil {
 		log.Fatal().Err(err).Msgf("could not build app")
 	}
 
+	if flagDryRun {
+		runDryRun(app)
+	}
+
 	if flagOnce {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -113,6 +121,21 @@ func Run(cmd *cobra.Command, args []string) {
 	runDaemon(app, cfg)
 }
 
+func runDryRun(app *internal.App) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	err := app.SyncOnce(ctx)
+	if printErr := printPlannedUpdates(os.Stdout, flagOutput, app.PlannedUpdates()); printErr != nil {
+		log.Fatal().Err(printErr).Msg("could not print planned updates")
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 func runDaemon(app *internal.App, cfg *config.Config) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -134,9 +157,26 @@ func runDaemon(app *internal.App, cfg *config.Config) {
 	}
 
 	go app.Sync(ctx, wg, webhookRequests)
+
+	if cfg.Api != nil {
+		apiServer, err := buildApiServer(cfg.Api, app)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not build api server")
+		}
+		go func() {
+			if err := apiServer.Listen(ctx, wg); err != nil {
+				log.Fatal().Err(err).Msg("could not start api server")
+			}
+		}()
+	}
+
 	go func() {
 		if cfg.MetricsAddr != "" {
-			if err := metrics.StartServer(ctx, cfg.MetricsAddr, wg); err != nil {
+			handlers := map[string]http.Handler{
+				"/healthz": health.LivenessHandler(app),
+				"/readyz":  health.ReadinessHandler(app),
+			}
+			if err := metrics.StartServer(ctx, cfg.MetricsAddr, wg, handlers); err != nil {
 				log.Fatal().Err(err).Msg("could not start metrics server")
 			}
 		}
@@ -182,11 +222,30 @@ func buildEventSources(cfg *config.Config) ([]eventSource, error) {
 	if cfg.EventSources.WebhookServer != nil {
 		var webhookServerOpts []webhook.WebhookServerOpts
 
-		if cfg.EventSources.WebhookServer.Path != "" {
-			webhookServerOpts = append(webhookServerOpts, webhook.WithPath(cfg.EventSources.WebhookServer.Path))
+		webhookConf := cfg.EventSources.WebhookServer
+		if webhookConf.Path != "" {
+			webhookServerOpts = append(webhookServerOpts, webhook.WithPath(webhookConf.Path))
+		}
+
+		if webhookConf.TLSCertFile != "" {
+			webhookServerOpts = append(webhookServerOpts, webhook.WithTLS(webhookConf.TLSCertFile, webhookConf.TLSKeyFile))
+		}
+
+		if webhookConf.ClientCAFile != "" {
+			webhookServerOpts = append(webhookServerOpts, webhook.WithClientCA(webhookConf.ClientCAFile))
+		}
+
+		authOpts, err := buildWebhookAuthOpts(webhookConf)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		}
+		webhookServerOpts = append(webhookServerOpts, authOpts...)
+
+		if len(webhookConf.TrustedProxies) > 0 {
+			webhookServerOpts = append(webhookServerOpts, webhook.WithTrustedProxies(webhookConf.TrustedProxies))
 		}
 
-		webhookServer, err := webhook.New(cfg.EventSources.WebhookServer.Addr, webhookServerOpts...)
+		webhookServer, err := webhook.New(webhookConf.Addr, webhookServerOpts...)
 		if err != nil {
 			errs = multierr.Append(errs, err)
 		} else {
@@ -194,5 +253,122 @@ func buildEventSources(cfg *config.Config) ([]eventSource, error) {
 		}
 	}
 
+	if cfg.EventSources.Mqtt != nil {
+		mqttSource, err := buildMqttSource(cfg.EventSources.Mqtt)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		} else {
+			eventSources = append(eventSources, mqttSource)
+		}
+	}
+
+	if cfg.EventSources.Websocket != nil {
+		websocketSources, err := buildWebsocketSources(cfg)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		}
+		for _, source := range websocketSources {
+			eventSources = append(eventSources, source)
+		}
+	}
+
 	return eventSources, errs
 }
+
+// buildWebsocketSources returns a WebSocket event source for each configured client, or only for the clients listed in
+// the WebSocket config.
+func buildWebsocketSources(cfg *config.Config) ([]*websocket.WebsocketSource, error) {
+	clients := cfg.EventSources.Websocket.Clients
+	if len(clients) == 0 {
+		clients = slices.Sorted(maps.Keys(cfg.Clients))
+	}
+
+	var errs error
+	var sources []*websocket.WebsocketSource
+	for _, name := range clients {
+		client := cfg.Clients[name]
+		apiKey, err := client.GetApiKey()
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not read api key of client %q: %w", name, err))
+			continue
+		}
+
+		source, err := websocket.New(name, client.Address, apiKey)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, errs
+}
+
+func buildApiServer(conf *config.ApiConfig, app *internal.App) (*api.ApiServer, error) {
+	token, err := conf.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("could not read api token: %w", err)
+	}
+
+	var opts []api.ApiServerOpts
+	if conf.TLSCertFile != "" {
+		opts = append(opts, api.WithTLS(conf.TLSCertFile, conf.TLSKeyFile))
+	}
+
+	return api.New(conf.Addr, app, token, opts...)
+}
+
+func buildMqttSource(conf *config.MqttConfig) (*mqtt.MqttSource, error) {
+	var opts []mqtt.MqttSourceOpts
+	if conf.ClientID != "" {
+		opts = append(opts, mqtt.WithClientID(conf.ClientID))
+	}
+
+	if conf.Username != "" {
+		password, err := conf.GetPassword()
+		if err != nil {
+			return nil, fmt.Errorf("could not read mqtt password: %w", err)
+		}
+		opts = append(opts, mqtt.WithAuth(conf.Username, password))
+	}
+
+	if conf.QoS > 0 {
+		opts = append(opts, mqtt.WithQoS(conf.QoS))
+	}
+
+	if conf.TLSCAFile != "" || conf.TLSCertFile != "" {
+		opts = append(opts, mqtt.WithTLS(conf.TLSCAFile, conf.TLSCertFile, conf.TLSKeyFile))
+	}
+
+	return mqtt.New(conf.Broker, conf.Topics, opts...)
+}
+
+func buildWebhookAuthOpts(conf *config.WebhookConfig) ([]webhook.WebhookServerOpts, error) {
+	var opts []webhook.WebhookServerOpts
+	var errs error
+
+	token, err := conf.GetBearerToken()
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("could not read bearer token: %w", err))
+	} else if token != "" {
+		opts = append(opts, webhook.WithBearerToken(token))
+	}
+
+	if conf.BasicAuthUser != "" {
+		password, err := conf.GetBasicAuthPassword()
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not read basic auth password: %w", err))
+		} else {
+			opts = append(opts, webhook.WithBasicAuth(conf.BasicAuthUser, password))
+		}
+	}
+
+	secret, err := conf.GetHmacSecret()
+	if err != nil {
+		errs = multierr.Append(errs, fmt.Errorf("could not read hmac secret: %w", err))
+	} else if secret != "" {
+		opts = append(opts, webhook.WithHmacSecret(secret, conf.HmacHeader))
+	}
+
+	return opts, errs
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+var syncItemCmd = &cobra.Command{
+	Use:   "sync-item",
+	Short: "Sync the UserData of a single item across the Jellyfin servers",
+	Long: `The 'sync-item' command synchronizes the UserData of a single item instead of running a full
+sync. The item is identified either by a client and its ID on that client or by a provider ID
+such as 'imdb=tt0133093' together with its type.
+
+Only the item and its matching items on the other servers are fetched from Jellyfin, the items
+are matched using the keys of the last full sync.
+
+If the '--dry-run' flag is provided, the updates are only reported instead of sent to Jellyfin.`,
+	Args: cobra.NoArgs,
+	Run:  SyncItem,
+}
+
+var (
+	flagSyncItemServer   string
+	flagSyncItemId       string
+	flagSyncItemProvider string
+	flagSyncItemType     string
+	flagSyncItemUser     string
+	flagSyncItemDryRun   bool
+	flagSyncItemOutput   string
+)
+
+func init() {
+	rootCmd.AddCommand(syncItemCmd)
+
+	syncItemCmd.Flags().StringVarP(&flagSyncItemServer, "server", "s", "", "The client the item ID belongs to")
+	syncItemCmd.Flags().StringVar(&flagSyncItemId, "id", "", "The ID of the item on the given client")
+	syncItemCmd.Flags().StringVarP(&flagSyncItemProvider, "provider", "p", "", "The provider ID of the item, e.g. 'imdb=tt0133093', one of imdb, tmdb, tvdb, anidb, tvmaze or musicbrainz")
+	syncItemCmd.Flags().StringVarP(&flagSyncItemType, "type", "t", "", "The type of the item, required when using a provider ID")
+	syncItemCmd.Flags().StringVarP(&flagSyncItemUser, "user", "u", "", "Only sync the item for the given user, defaults to all users")
+	syncItemCmd.Flags().BoolVar(&flagSyncItemDryRun, "dry-run", false, "Only report the updates instead of sending them to Jellyfin")
+	syncItemCmd.Flags().StringVar(&flagSyncItemOutput, "output", outputTable, "Output format of the updates in dry run mode, one of 'table' or 'json'")
+}
+
+func SyncItem(cmd *cobra.Command, args []string) {
+	cfg := mustLoadConfig()
+
+	byId := flagSyncItemServer != "" || flagSyncItemId != ""
+	if byId == (flagSyncItemProvider != "") {
+		log.Fatal().Msg("either --server and --id or --provider and --type are required")
+	}
+
+	if byId && (flagSyncItemServer == "" || flagSyncItemId == "") {
+		log.Fatal().Msg("--server and --id are both required")
+	}
+
+	if byId {
+		if _, found := cfg.Clients[flagSyncItemServer]; !found {
+			log.Fatal().Msgf("unknown client %q", flagSyncItemServer)
+		}
+	}
+
+	var provider, providerId string
+	if !byId {
+		if flagSyncItemType == "" {
+			log.Fatal().Msg("--type is required when using a provider ID")
+		}
+
+		var found bool
+		provider, providerId, found = strings.Cut(flagSyncItemProvider, "=")
+		if !found {
+			log.Fatal().Msgf("invalid provider ID %q, expected format '<provider>=<id>'", flagSyncItemProvider)
+		}
+		if _, err := matching.ProviderKey(provider, providerId); err != nil {
+			log.Fatal().Err(err).Msg("invalid provider ID")
+		}
+	}
+
+	if flagSyncItemDryRun && flagSyncItemOutput != outputTable && flagSyncItemOutput != outputJson {
+		log.Fatal().Msgf("invalid output format %q", flagSyncItemOutput)
+	}
+
+	users := []string{flagSyncItemUser}
+	if flagSyncItemUser == "" {
+		users = nil
+		for user, servers := range cfg.GetUsers() {
+			if _, found := servers[flagSyncItemServer]; found || !byId {
+				users = append(users, user)
+			}
+		}
+	} else if _, found := cfg.GetUsers()[flagSyncItemUser]; !found {
+		log.Fatal().Msgf("unknown user %q", flagSyncItemUser)
+	}
+
+	clients := mustBuildClients(cfg)
+
+	db := mustOpenDb(cfg)
+
+	var appOpts []internal.AppOpts
+	if flagSyncItemDryRun {
+		appOpts = append(appOpts, internal.WithDryRun())
+	}
+
+	app, err := internal.NewApp(clients, db, cfg, appOpts...)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("could not build app")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	var errs error
+	var planned []internal.PlannedUpdate
+	for _, user := range users {
+		if byId {
+			err = app.SyncItem(ctx, user, flagSyncItemServer, flagSyncItemId)
+		} else {
+			err = app.SyncItemByProviderID(ctx, user, jellyfin.ItemType(flagSyncItemType), provider, providerId)
+		}
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			log.Error().Err(err).Str("user", user).Msg("could not sync item")
+		}
+		planned = append(planned, app.PlannedUpdates()...)
+	}
+
+	if flagSyncItemDryRun {
+		if err := printPlannedUpdates(os.Stdout, flagSyncItemOutput, planned); err != nil {
+			log.Fatal().Err(err).Msg("could not print planned updates")
+		}
+	}
+
+	if errs != nil {
+		os.Exit(1)
+	}
+}
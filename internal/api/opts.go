@@ -0,0 +1,19 @@
+package api
+
+import "errors"
+
+func WithTLS(certFile, keyFile string) func(a *ApiServer) error {
+	return func(a *ApiServer) error {
+		if len(certFile) == 0 {
+			return errors.New("empty certfile")
+		}
+
+		if len(keyFile) == 0 {
+			return errors.New("empty keyfile")
+		}
+
+		a.certFile = certFile
+		a.keyFile = keyFile
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal"
+	"go.uber.org/multierr"
+)
+
+const pathPrefix = "/api/v1"
+
+// Controller is the part of the app that is controlled using the API.
+type Controller interface {
+	TriggerSync(mode internal.SyncMode) error
+	Pause()
+	Resume()
+	IsPaused() bool
+	QueuedSyncs() int
+	SyncResults() []internal.SyncResult
+	PendingUpdates(ctx context.Context) ([]internal.PlannedUpdate, error)
+}
+
+// ApiServer serves a JSON API to trigger syncs, inspect the results of the last syncs and pause syncing. All requests
+// need to be authenticated using a bearer token.
+type ApiServer struct {
+	address    string
+	controller Controller
+	token      string
+
+	// optional
+	certFile string
+	keyFile  string
+}
+
+type ApiServerOpts func(*ApiServer) error
+
+func New(address string, controller Controller, token string, opts ...ApiServerOpts) (*ApiServer, error) {
+	if len(address) == 0 {
+		return nil, errors.New("empty address provided")
+	}
+
+	if controller == nil {
+		return nil, errors.New("nil controller provided")
+	}
+
+	if len(token) == 0 {
+		return nil, errors.New("empty token provided")
+	}
+
+	a := &ApiServer{
+		address:    address,
+		controller: controller,
+		token:      token,
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return a, errs
+}
+
+func (a *ApiServer) IsTLSConfigured() bool {
+	return len(a.certFile) > 0 && len(a.keyFile) > 0
+}
+
+type statusResponse struct {
+	Paused      bool                  `json:"paused"`
+	QueuedSyncs int                   `json:"queued_syncs"`
+	Results     []internal.SyncResult `json:"results"`
+}
+
+type syncResponse struct {
+	Mode internal.SyncMode `json:"mode"`
+}
+
+type pauseResponse struct {
+	Paused bool `json:"paused"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (a *ApiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+pathPrefix+"/status", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, statusResponse{
+			Paused:      a.controller.IsPaused(),
+			QueuedSyncs: a.controller.QueuedSyncs(),
+			Results:     a.controller.SyncResults(),
+		})
+	})
+
+	mux.HandleFunc("GET "+pathPrefix+"/results", func(rw http.ResponseWriter, r *http.Request) {
+		writeJSON(rw, http.StatusOK, a.controller.SyncResults())
+	})
+
+	mux.HandleFunc("POST "+pathPrefix+"/sync", func(rw http.ResponseWriter, r *http.Request) {
+		mode, err := internal.ParseSyncMode(r.URL.Query().Get("mode"))
+		if err != nil {
+			writeError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := a.controller.TriggerSync(mode); err != nil {
+			writeError(rw, http.StatusConflict, err)
+			return
+		}
+		writeJSON(rw, http.StatusAccepted, syncResponse{Mode: mode})
+	})
+
+	mux.HandleFunc("POST "+pathPrefix+"/pause", func(rw http.ResponseWriter, r *http.Request) {
+		a.controller.Pause()
+		writeJSON(rw, http.StatusOK, pauseResponse{Paused: a.controller.IsPaused()})
+	})
+
+	mux.HandleFunc("POST "+pathPrefix+"/resume", func(rw http.ResponseWriter, r *http.Request) {
+		a.controller.Resume()
+		writeJSON(rw, http.StatusOK, pauseResponse{Paused: a.controller.IsPaused()})
+	})
+
+	mux.HandleFunc("GET "+pathPrefix+"/pending", func(rw http.ResponseWriter, r *http.Request) {
+		updates, err := a.controller.PendingUpdates(r.Context())
+		if err != nil {
+			log.Error().Err(err).Msg("could not get pending updates")
+			writeError(rw, http.StatusInternalServerError, errors.New("could not get pending updates"))
+			return
+		}
+		if updates == nil {
+			updates = []internal.PlannedUpdate{}
+		}
+		writeJSON(rw, http.StatusOK, updates)
+	})
+
+	return a.authenticate(mux)
+}
+
+// authenticate rejects all requests that do not carry the configured bearer token.
+func (a *ApiServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			log.Warn().Str("source", r.RemoteAddr).Str("path", r.URL.Path).Msg("Rejected unauthenticated API request")
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="jellyporter"`)
+			writeError(rw, http.StatusUnauthorized, errors.New("missing or invalid credentials"))
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(body); err != nil {
+		log.Warn().Err(err).Msg("could not write API response")
+	}
+}
+
+func writeError(rw http.ResponseWriter, status int, err error) {
+	writeJSON(rw, status, errorResponse{Error: err.Error()})
+}
+
+func (a *ApiServer) Listen(ctx context.Context, wg *sync.WaitGroup) error {
+	if wg == nil {
+		return errors.New("nil waitgroup passed")
+	}
+
+	wg.Add(1)
+	defer wg.Done()
+
+	server := http.Server{
+		Addr:              a.address,
+		Handler:           a.handler(),
+		ReadTimeout:       3 * time.Second,
+		ReadHeaderTimeout: 3 * time.Second,
+		// listing the pending updates queries the database for all users, servers and types of items
+		WriteTimeout: 30 * time.Second,
+		IdleTimeout:  30 * time.Second,
+	}
+
+	errChan := make(chan error)
+	go func() {
+		log.Info().Str("address", a.address).Msg("Starting API server")
+		var err error
+		if a.IsTLSConfigured() {
+			err = server.ListenAndServeTLS(a.certFile, a.keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- fmt.Errorf("can not start api server: %w", err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("Stopping API server")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	case err := <-errChan:
+		return err
+	}
+}
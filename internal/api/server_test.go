@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+const testToken = "secret"
+
+// fakeController records the calls of the API and returns canned results.
+type fakeController struct {
+	triggerErr error
+	results    []internal.SyncResult
+	pending    []internal.PlannedUpdate
+	pendingErr error
+	queued     int
+
+	mutex     sync.Mutex
+	paused    bool
+	triggered []internal.SyncMode
+}
+
+func (c *fakeController) TriggerSync(mode internal.SyncMode) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.paused {
+		return internal.ErrPaused
+	}
+	if c.triggerErr != nil {
+		return c.triggerErr
+	}
+	c.triggered = append(c.triggered, mode)
+	return nil
+}
+
+func (c *fakeController) Pause() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paused = true
+}
+
+func (c *fakeController) Resume() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paused = false
+}
+
+func (c *fakeController) IsPaused() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.paused
+}
+
+func (c *fakeController) QueuedSyncs() int {
+	return c.queued
+}
+
+func (c *fakeController) SyncResults() []internal.SyncResult {
+	return c.results
+}
+
+func (c *fakeController) PendingUpdates(_ context.Context) ([]internal.PlannedUpdate, error) {
+	return c.pending, c.pendingErr
+}
+
+// do sends a request to the API and returns the status code and the decoded JSON body.
+func do(t *testing.T, handler http.Handler, method, path, token string) (int, any) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("%s %s: content type = %q, want application/json", method, path, got)
+	}
+
+	var body any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: could not decode body %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func decode(t *testing.T, data string) any {
+	t.Helper()
+	var ret any
+	if err := json.Unmarshal([]byte(data), &ret); err != nil {
+		t.Fatalf("could not decode %q: %v", data, err)
+	}
+	return ret
+}
+
+func TestApiServer_handler(t *testing.T) {
+	finished := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		controller    *fakeController
+		method        string
+		path          string
+		token         string
+		wantStatus    int
+		wantBody      string
+		wantTriggered []internal.SyncMode
+	}{
+		{
+			name:       "Missing token",
+			controller: &fakeController{},
+			method:     http.MethodPost,
+			path:       "/api/v1/sync",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"missing or invalid credentials"}`,
+		},
+		{
+			name:       "Invalid token",
+			controller: &fakeController{},
+			method:     http.MethodGet,
+			path:       "/api/v1/status",
+			token:      "wrong",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"missing or invalid credentials"}`,
+		},
+		{
+			name:       "Unauthenticated requests to unknown paths are rejected",
+			controller: &fakeController{},
+			method:     http.MethodGet,
+			path:       "/api/v1/unknown",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"missing or invalid credentials"}`,
+		},
+		{
+			name:          "Trigger sync",
+			controller:    &fakeController{},
+			method:        http.MethodPost,
+			path:          "/api/v1/sync",
+			token:         testToken,
+			wantStatus:    http.StatusAccepted,
+			wantBody:      `{"mode":"auto"}`,
+			wantTriggered: []internal.SyncMode{internal.SyncModeAuto},
+		},
+		{
+			name:          "Trigger full sync",
+			controller:    &fakeController{},
+			method:        http.MethodPost,
+			path:          "/api/v1/sync?mode=full",
+			token:         testToken,
+			wantStatus:    http.StatusAccepted,
+			wantBody:      `{"mode":"full"}`,
+			wantTriggered: []internal.SyncMode{internal.SyncModeFull},
+		},
+		{
+			name:       "Trigger sync with invalid mode",
+			controller: &fakeController{},
+			method:     http.MethodPost,
+			path:       "/api/v1/sync?mode=partial",
+			token:      testToken,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "Trigger sync while another one is pending",
+			controller: &fakeController{triggerErr: internal.ErrSyncPending},
+			method:     http.MethodPost,
+			path:       "/api/v1/sync",
+			token:      testToken,
+			wantStatus: http.StatusConflict,
+			wantBody:   `{"error":"` + internal.ErrSyncPending.Error() + `"}`,
+		},
+		{
+			name:       "Trigger sync while paused",
+			controller: &fakeController{paused: true},
+			method:     http.MethodPost,
+			path:       "/api/v1/sync",
+			token:      testToken,
+			wantStatus: http.StatusConflict,
+			wantBody:   `{"error":"` + internal.ErrPaused.Error() + `"}`,
+		},
+		{
+			name:       "Trigger sync using GET",
+			controller: &fakeController{},
+			method:     http.MethodGet,
+			path:       "/api/v1/sync",
+			token:      testToken,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "Pause",
+			controller: &fakeController{},
+			method:     http.MethodPost,
+			path:       "/api/v1/pause",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"paused":true}`,
+		},
+		{
+			name:       "Resume",
+			controller: &fakeController{paused: true},
+			method:     http.MethodPost,
+			path:       "/api/v1/resume",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"paused":false}`,
+		},
+		{
+			name: "Status",
+			controller: &fakeController{
+				paused:  true,
+				queued:  2,
+				results: []internal.SyncResult{{RunID: "run", Server: "a", User: "user", Type: jellyfin.ItemMovie, Finished: finished, Success: true}},
+			},
+			method:     http.MethodGet,
+			path:       "/api/v1/status",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody: `{"paused":true,"queued_syncs":2,"results":[{"run_id":"run","server":"a","user":"user","type":"Movie","full":false,
+				"started":"0001-01-01T00:00:00Z","finished":"2025-06-15T15:00:00Z","fetched":0,"updated":0,"success":true}]}`,
+		},
+		{
+			name: "Results",
+			controller: &fakeController{
+				results: []internal.SyncResult{{RunID: "run", Server: "a", User: "user", Type: jellyfin.ItemMovie, Finished: finished, Errors: []string{"connection refused"}}},
+			},
+			method:     http.MethodGet,
+			path:       "/api/v1/results",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody: `[{"run_id":"run","server":"a","user":"user","type":"Movie","full":false,"started":"0001-01-01T00:00:00Z",
+				"finished":"2025-06-15T15:00:00Z","fetched":0,"updated":0,"success":false,"errors":["connection refused"]}]`,
+		},
+		{
+			name: "Pending",
+			controller: &fakeController{
+				pending: []internal.PlannedUpdate{{Server: "b", User: "user", Type: jellyfin.ItemMovie, LocalID: "1", Name: "The Matrix", Field: "played", Value: "true"}},
+			},
+			method:     http.MethodGet,
+			path:       "/api/v1/pending",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"server":"b","user":"user","type":"Movie","local_id":"1","name":"The Matrix","field":"played","value":"true"}]`,
+		},
+		{
+			name:       "No pending updates",
+			controller: &fakeController{},
+			method:     http.MethodGet,
+			path:       "/api/v1/pending",
+			token:      testToken,
+			wantStatus: http.StatusOK,
+			wantBody:   `[]`,
+		},
+		{
+			name:       "Pending updates are not available",
+			controller: &fakeController{pendingErr: errors.New("database is locked")},
+			method:     http.MethodGet,
+			path:       "/api/v1/pending",
+			token:      testToken,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"could not get pending updates"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := New("localhost:0", tt.controller, testToken)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			server.handler().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %q", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+			if tt.wantBody != "" {
+				var got any
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("could not decode body %q: %v", rec.Body.String(), err)
+				}
+				if want := decode(t, tt.wantBody); !reflect.DeepEqual(got, want) {
+					t.Errorf("body = %v, want %v", got, want)
+				}
+			}
+			if !reflect.DeepEqual(tt.controller.triggered, tt.wantTriggered) {
+				t.Errorf("triggered = %v, want %v", tt.controller.triggered, tt.wantTriggered)
+			}
+		})
+	}
+}
+
+func TestApiServer_PauseResume(t *testing.T) {
+	controller := &fakeController{}
+	server, err := New("localhost:0", controller, testToken)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	handler := server.handler()
+
+	steps := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{http.MethodPost, "/api/v1/pause", http.StatusOK, `{"paused":true}`},
+		// pausing is idempotent
+		{http.MethodPost, "/api/v1/pause", http.StatusOK, `{"paused":true}`},
+		{http.MethodGet, "/api/v1/status", http.StatusOK, `{"paused":true,"queued_syncs":0,"results":null}`},
+		{http.MethodPost, "/api/v1/sync", http.StatusConflict, `{"error":"` + internal.ErrPaused.Error() + `"}`},
+		{http.MethodPost, "/api/v1/resume", http.StatusOK, `{"paused":false}`},
+		{http.MethodGet, "/api/v1/status", http.StatusOK, `{"paused":false,"queued_syncs":0,"results":null}`},
+		{http.MethodPost, "/api/v1/sync", http.StatusAccepted, `{"mode":"auto"}`},
+	}
+	for idx, step := range steps {
+		status, body := do(t, handler, step.method, step.path, testToken)
+		if status != step.wantStatus {
+			t.Errorf("step %d: %s %s status = %d, want %d", idx, step.method, step.path, status, step.wantStatus)
+		}
+		if want := decode(t, step.wantBody); !reflect.DeepEqual(body, want) {
+			t.Errorf("step %d: %s %s body = %v, want %v", idx, step.method, step.path, body, want)
+		}
+	}
+
+	if want := []internal.SyncMode{internal.SyncModeAuto}; !reflect.DeepEqual(controller.triggered, want) {
+		t.Errorf("triggered = %v, want %v", controller.triggered, want)
+	}
+}
@@ -2,9 +2,13 @@ package internal
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -22,40 +26,117 @@ import (
 const defaultCooldownDuration = 30 * time.Second
 
 type JellyfinClient interface {
-	GetUserId(ctx context.Context) (string, error)
+	GetUserId(ctx context.Context, userName string) (string, error)
 	GetItems(ctx context.Context, userID string, opts jellyfin.ItemQueryOpts) (*jellyfin.ItemsResponse, error)
+	GetItem(ctx context.Context, userID, itemID string) (*jellyfin.Item, error)
+	IsIncluded(ctx context.Context, userID string, item jellyfin.Item, filter jellyfin.ItemFilter) (bool, error)
+	GetServerId(ctx context.Context) (string, error)
 	UpdateUserData(ctx context.Context, userID, itemID string, data jellyfin.UserDataUpdate) error
 }
 
 type LibraryDb interface {
-	InsertChangelog(ctx context.Context, server string, change sqlite.ChangelogData) error
-	InsertItems(ctx context.Context, server string, itemType jellyfin.ItemType, episodes []jellyfin.Item) error
-
-	GetMoviesWithUpdatedUserData(ctx context.Context, server string) ([]sqlite.ItemWithUpdatedUserData, error)
-	GetEpisodesWithUpdatedUserData(ctx context.Context, server string) ([]sqlite.ItemWithUpdatedUserData, error)
-	RemoveItemsNotSeenSince(ctx context.Context, server string, itemType jellyfin.ItemType, since time.Time) error
-
-	UpsertState(ctx context.Context, server string, itemType jellyfin.ItemType, ts time.Time) error
-	GetState(ctx context.Context, server string, itemType jellyfin.ItemType) (time.Time, error)
+	InsertChangelog(ctx context.Context, server, user string, change sqlite.ChangelogData) error
+	Check(ctx context.Context) error
+	GetChangelog(ctx context.Context, filter sqlite.ChangelogFilter) ([]sqlite.ChangelogEntry, error)
+	InsertItems(ctx context.Context, server, user string, itemType jellyfin.ItemType, episodes []jellyfin.Item) error
+
+	GetItemsWithUpdatedUserData(ctx context.Context, server, user string, itemType jellyfin.ItemType) ([]sqlite.ItemWithUpdatedUserData, error)
+	GetItemsWithUpdatedFavorite(ctx context.Context, server, user string, itemType jellyfin.ItemType) ([]sqlite.ItemWithUpdatedFavorite, error)
+	GetItemMatches(ctx context.Context, user string, itemType jellyfin.ItemType, server, localID, matchKey string) ([]sqlite.ItemMatch, error)
+	RemoveItemsNotSeenSince(ctx context.Context, server, user string, itemType jellyfin.ItemType, since time.Time) error
+	RevertUserData(ctx context.Context, server, user string, itemType jellyfin.ItemType, localID string, data jellyfin.UserDataUpdate) error
+
+	UpsertState(ctx context.Context, server, user string, itemType jellyfin.ItemType, ts time.Time) error
+	GetState(ctx context.Context, server, user string, itemType jellyfin.ItemType) (time.Time, error)
+
+	MarkStale(ctx context.Context, server, user string, itemType jellyfin.ItemType, since time.Time) error
+	ClearStale(ctx context.Context, server, user string, itemType jellyfin.ItemType) error
+	IsStale(ctx context.Context, server, user string, itemType jellyfin.ItemType) (bool, error)
 }
 
 type App struct {
 	clients map[string]JellyfinClient
 	db      LibraryDb
 
+	// users maps the name of each user to the user's Jellyfin user name per server
+	users map[string]map[string]string
+
+	// itemTypes are the types of items that are synced
+	itemTypes []jellyfin.ItemType
+
+	// sources are the servers each server receives updates from, nil if every server receives updates from all servers
+	sources map[string][]string
+	// filters restrict the items that are synced per server
+	filters map[string]jellyfin.ItemFilter
+
 	mutex sync.Mutex
 
-	// cooldown is a cooldown phase for when receiving a burst of requests from the webhook
-	cooldown      atomic.Bool
+	// cooldownTimer is the duration of the cooldown phase after a sync triggered by an event source, events that arrive
+	// during a cooldown phase are merged into a single trailing sync
 	cooldownTimer time.Duration
+	queue         *syncQueue
+
+	// paused stops syncs triggered by the ticker and by event sources, resumed signals the sync loop to process the
+	// events that have been queued in the meantime
+	paused  atomic.Bool
+	resumed chan struct{}
+
+	// triggers are syncs requested using TriggerSync
+	triggers chan SyncMode
+	// syncMode is the mode of the current sync run, it's only written while holding the mutex
+	syncMode SyncMode
+
+	// results are the results of the last sync per server, user and type of items
+	results      map[syncResultKey]*SyncResult
+	resultsMutex sync.Mutex
+
+	// clientStatus is the health of each client that is synced
+	clientStatus     map[string]*ClientStatus
+	lastSync         time.Time
+	syncRunningSince time.Time
+	healthMutex      sync.Mutex
 
 	// counter tracks invocations to control fetching deltas or full data from Jellyfin
 	counter                 atomic.Int32
 	syncIntervalMinutes     int32
 	fullSyncIntervalMinutes int32
+
+	// finishedThreshold is the share of an item's runtime after which an item in progress is considered finished
+	finishedThreshold float64
+
+	// runID identifies the current sync run in the changelog, it's only written while holding the mutex
+	runID string
+
+	// dryRun only plans updates instead of sending them to Jellyfin and leaves the state untouched
+	dryRun       bool
+	planned      []PlannedUpdate
+	plannedMutex sync.Mutex
+}
+
+type AppOpts func(*App) error
+
+// buildItemFilters returns the filters of all clients that have filters configured.
+func buildItemFilters(cfg *config.Config) map[string]jellyfin.ItemFilter {
+	ret := map[string]jellyfin.ItemFilter{}
+	for name, client := range cfg.Clients {
+		if client.Filters == nil {
+			continue
+		}
+		ret[name] = jellyfin.ItemFilter{
+			IncludeLibraries: client.Filters.Include.Libraries,
+			ExcludeLibraries: client.Filters.Exclude.Libraries,
+			IncludeParentIDs: client.Filters.Include.ParentIDs,
+			ExcludeParentIDs: client.Filters.Exclude.ParentIDs,
+			IncludeTags:      client.Filters.Include.Tags,
+			ExcludeTags:      client.Filters.Exclude.Tags,
+			IncludeGenres:    client.Filters.Include.Genres,
+			ExcludeGenres:    client.Filters.Exclude.Genres,
+		}
+	}
+	return ret
 }
 
-func NewApp(clients map[string]JellyfinClient, db LibraryDb, cfg *config.Config) (*App, error) {
+func NewApp(clients map[string]JellyfinClient, db LibraryDb, cfg *config.Config, opts ...AppOpts) (*App, error) {
 	if len(clients) == 0 {
 		return nil, errors.New("empty client map provided")
 	}
@@ -68,16 +149,56 @@ func NewApp(clients map[string]JellyfinClient, db LibraryDb, cfg *config.Config)
 		return nil, errors.New("nil config passed")
 	}
 
+	users := cfg.GetUsers()
+	for user, servers := range users {
+		for server := range servers {
+			if _, found := clients[server]; !found {
+				return nil, fmt.Errorf("no client for server %q of user %q", server, user)
+			}
+		}
+	}
+
+	itemTypes := make([]jellyfin.ItemType, len(cfg.ItemTypes))
+	for idx, itemType := range cfg.ItemTypes {
+		itemTypes[idx] = jellyfin.ItemType(itemType)
+	}
+
+	// every client that is synced for any user is reported as not ready until the first sync has reached it, clients
+	// that are not mapped to any user are never synced and therefore not part of the health report
+	clientStatus := make(map[string]*ClientStatus, len(clients))
+	for _, servers := range users {
+		for name := range servers {
+			clientStatus[name] = &ClientStatus{Name: name}
+		}
+	}
+
 	app := &App{
-		clients: clients,
-		db:      db,
+		clients:   clients,
+		db:        db,
+		users:     users,
+		itemTypes: itemTypes,
+		sources:   cfg.GetReplicationSources(),
+		filters:   buildItemFilters(cfg),
 
 		cooldownTimer:           defaultCooldownDuration,
+		queue:                   newSyncQueue(),
+		resumed:                 make(chan struct{}, 1),
+		triggers:                make(chan SyncMode, 1),
+		results:                 map[syncResultKey]*SyncResult{},
+		clientStatus:            clientStatus,
 		syncIntervalMinutes:     int32(cfg.SyncIntervalMinutes),     //nolint G115
 		fullSyncIntervalMinutes: int32(cfg.FullSyncIntervalMinutes), //nolint G115
+		finishedThreshold:       cfg.FinishedThreshold,
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(app); err != nil {
+			errs = multierr.Append(errs, err)
+		}
 	}
 
-	return app, nil
+	return app, errs
 }
 
 func (a *App) Sync(ctx context.Context, wg *sync.WaitGroup, hook chan events.EventSyncRequest) {
@@ -91,34 +212,49 @@ func (a *App) Sync(ctx context.Context, wg *sync.WaitGroup, hook chan events.Eve
 	ticker := time.NewTicker(time.Duration(a.syncIntervalMinutes) * time.Minute)
 	_ = a.SyncOnce(ctx)
 
+	// cooldown fires at the end of the current cooldown phase, it is nil if no cooldown phase is active
+	var cooldown <-chan time.Time
+
 	for {
 		select {
 		case event := <-hook:
 			metrics.EventSourceRequestsTotal.WithLabelValues(event.Source).Inc()
-			if a.cooldown.CompareAndSwap(false, true) {
-				metrics.EventSourceCooldownPhases.Inc()
+			if event.IsTargeted() {
+				log.Info().Str("source", event.Source).Str("metadata", event.Metadata).Str("item", event.ItemID).Str("server", event.Server).Str("server_id", event.ServerID).Msg("Received external request to sync item")
+			} else {
 				log.Info().Str("source", event.Source).Str("metadata", event.Metadata).Msg("Received external request to sync data")
+			}
+			respond(event, nil)
 
-				cooldownCtx, cancel := context.WithTimeout(ctx, a.cooldownTimer)
-				go func() {
-					defer cancel()
-					<-cooldownCtx.Done()
-					a.cooldown.Store(false)
-				}()
-
-				select {
-				case event.Response <- nil:
-					// nop
-				case <-time.After(1 * time.Second):
-					log.Warn().Msg("hanging goroutine")
-				}
-				_ = a.SyncOnce(ctx)
-			} else {
-				metrics.EventSourceErrorsTotal.WithLabelValues(event.Source).Inc()
-				log.Debug().Str("source", event.Source).Str("metadata", event.Metadata).Msgf("Not initiating sync due to having received too many requests in the last %v", a.cooldownTimer)
-				event.Response <- errors.New("too many requests")
+			if !a.queue.add(event) {
+				log.Debug().Str("source", event.Source).Str("metadata", event.Metadata).Msg("Merged request into an already queued sync")
+			}
+
+			switch {
+			case a.paused.Load():
+				log.Debug().Str("source", event.Source).Str("metadata", event.Metadata).Int("queued", a.queue.len()).Msg("Delaying sync until syncing is resumed")
+			case cooldown == nil:
+				cooldown = a.processQueue(ctx)
+			default:
+				log.Debug().Str("source", event.Source).Str("metadata", event.Metadata).Int("queued", a.queue.len()).Msgf("Delaying sync until the end of the cooldown phase of %v", a.cooldownTimer)
+			}
+		case <-cooldown:
+			cooldown = nil
+			// the requests that arrived during the cooldown phase are merged into a single trailing sync
+			if a.queue.len() > 0 && !a.paused.Load() {
+				cooldown = a.processQueue(ctx)
 			}
+		case <-a.resumed:
+			if cooldown == nil && a.queue.len() > 0 {
+				cooldown = a.processQueue(ctx)
+			}
+		case mode := <-a.triggers:
+			_ = a.syncOnce(ctx, mode)
 		case <-ticker.C:
+			if a.paused.Load() {
+				log.Info().Msg("Skipping sync, syncing is paused")
+				continue
+			}
 			_ = a.SyncOnce(ctx)
 		case <-ctx.Done():
 			return
@@ -126,111 +262,201 @@ func (a *App) Sync(ctx context.Context, wg *sync.WaitGroup, hook chan events.Eve
 	}
 }
 
+// processQueue runs the queued syncs and starts a cooldown phase. Returns a channel that fires at the end of the
+// cooldown phase.
+func (a *App) processQueue(ctx context.Context) <-chan time.Time {
+	metrics.EventSourceCooldownPhases.Inc()
+
+	full, superseded, items := a.queue.take()
+	if full {
+		mode := SyncModeAuto
+		if superseded {
+			// the events of single items that have been dropped may not be covered by a delta sync
+			mode = SyncModeFull
+		}
+		_ = a.syncOnce(ctx, mode)
+	}
+
+	for _, event := range items {
+		if err := a.SyncEvent(ctx, event); err != nil {
+			log.Error().Err(err).Str("source", event.Source).Str("item", event.ItemID).Str("server", event.Server).Str("server_id", event.ServerID).Msg("Could not sync item")
+		}
+	}
+
+	return time.After(a.cooldownTimer)
+}
+
+// respond sends the result of an event back to its source without blocking if the source has stopped waiting.
+func respond(event events.EventSyncRequest, err error) {
+	select {
+	case event.Response <- err:
+		// nop
+	case <-time.After(1 * time.Second):
+		log.Warn().Msg("hanging goroutine")
+	}
+}
+
 func (a *App) SyncOnce(ctx context.Context) error {
+	return a.syncOnce(ctx, SyncModeAuto)
+}
+
+func (a *App) syncOnce(ctx context.Context, mode SyncMode) error {
 	defer func() {
 		a.counter.Add(1)
 		a.mutex.Unlock()
 	}()
 	// Prevent multiple goroutines running this code simultaneously
 	a.mutex.Lock()
+	a.resetPlannedUpdates()
+	a.runID = newRunID()
+	a.syncMode = mode
+	a.syncStarted()
+	defer a.syncFinished()
 
 	start := time.Now()
 	var errs error
-	if err := a.syncMoviesWatchedState(ctx); err != nil {
-		errs = multierr.Append(errs, err)
-		log.Error().Err(err).Dur("duration", time.Since(start)).Msgf("Experienced errors while syncing 'watched' data for movies between %d servers", len(a.clients))
-	}
-
-	if err := a.syncEpisodesWatchedState(ctx); err != nil {
-		errs = multierr.Append(errs, err)
-		log.Error().Err(err).Dur("duration", time.Since(start)).Msgf("Experienced errors while syncing 'watched' data for episodes between %d servers", len(a.clients))
+	for user, servers := range a.users {
+		for _, itemType := range a.itemTypes {
+			if err := a.syncItemType(ctx, user, itemType); err != nil {
+				errs = multierr.Append(errs, err)
+				log.Error().Err(err).Str("user", user).Str("type", string(itemType)).Dur("duration", time.Since(start)).Msgf("Experienced errors while syncing 'watched' data between %d servers", len(servers))
+			}
+		}
 	}
 
-	log.Info().Dur("duration", time.Since(start)).Msgf("Finished syncing data between %d servers", len(a.clients))
+	log.Info().Dur("duration", time.Since(start)).Msgf("Finished syncing data of %d users between %d servers", len(a.users), len(a.clients))
 	return errs
 }
 
-func (a *App) syncMoviesWatchedState(ctx context.Context) error {
-	err := a.fetchUpdatesFromJellyfin(ctx, jellyfin.ItemMovie)
-	if err != nil {
-		return err
-	}
-
-	return a.synchronizeUpdatedUserData(ctx, jellyfin.ItemMovie)
-}
-
-func (a *App) syncEpisodesWatchedState(ctx context.Context) error {
-	err := a.fetchUpdatesFromJellyfin(ctx, jellyfin.ItemEpisode)
-	if err != nil {
+func (a *App) syncItemType(ctx context.Context, user string, itemType jellyfin.ItemType) error {
+	reachable, err := a.fetchUpdatesFromJellyfin(ctx, user, itemType)
+	if len(reachable) == 0 {
 		return err
 	}
 
-	return a.synchronizeUpdatedUserData(ctx, jellyfin.ItemEpisode)
+	// servers that could not be reached are skipped, the reachable servers keep syncing among themselves
+	return multierr.Append(err, a.synchronizeUpdatedUserData(ctx, user, itemType, reachable))
 }
 
-func (a *App) fetchUpdatesFromJellyfin(ctx context.Context, itemType jellyfin.ItemType) error {
+// fetchUpdatesFromJellyfin fetches the items of all servers of the user and returns the servers that have been
+// reached. Servers that could not be reached are marked stale until their next successful full fetch.
+func (a *App) fetchUpdatesFromJellyfin(ctx context.Context, user string, itemType jellyfin.ItemType) ([]string, error) {
 	start := time.Now()
 	var mutex sync.Mutex
 	var errs error
+	var reachable []string
 	var wg sync.WaitGroup
-	log.Info().Str("type", string(itemType)).Msg("Fetching data from Jellyfin")
-	for server, client := range a.clients {
+	log.Info().Str("user", user).Str("type", string(itemType)).Msg("Fetching data from Jellyfin")
+	for server, userName := range a.users[user] {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := a.fetchUpdateFromJellyfin(ctx, itemType, server, client); err != nil {
-				mutex.Lock()
+			err := a.fetchUpdateFromJellyfin(ctx, itemType, server, user, userName)
+			if err != nil {
+				log.Warn().Err(err).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Could not fetch items, skipping server and marking it stale")
+				if !a.dryRun {
+					if staleErr := a.db.MarkStale(ctx, server, user, itemType, time.Now()); staleErr != nil {
+						err = multierr.Append(err, staleErr)
+					}
+				}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
 				errs = multierr.Append(errs, err)
-				mutex.Unlock()
+			} else {
+				reachable = append(reachable, server)
 			}
 		}()
 	}
 	wg.Wait()
-	log.Info().Dur("duration", time.Since(start)).Str("type", string(itemType)).Msgf("Finished fetching items from %d servers", len(a.clients))
-	return errs
+	slices.Sort(reachable)
+	log.Info().Dur("duration", time.Since(start)).Str("user", user).Str("type", string(itemType)).Msgf("Finished fetching items from %d of %d servers", len(reachable), len(a.users[user]))
+	return reachable, errs
 }
 
-func (a *App) fetchUpdateFromJellyfin(ctx context.Context, itemType jellyfin.ItemType, server string, client JellyfinClient) error {
+func (a *App) fetchUpdateFromJellyfin(ctx context.Context, itemType jellyfin.ItemType, server, user, userName string) (err error) {
 	start := time.Now()
+	var fetched int
+	var full bool
+	defer func() {
+		a.updateSyncResult(server, user, itemType, func(result *SyncResult) {
+			result.Full = full
+			result.Fetched = fetched
+			result.addError(err)
+		})
+	}()
 
-	userId, err := client.GetUserId(ctx)
+	userId, err := a.clients[server].GetUserId(ctx, userName)
 	if err != nil {
 		return err
 	}
 
-	lastSeenUserDataUpdate, err := a.db.GetState(ctx, server, itemType)
+	lastSeenUserDataUpdate, err := a.db.GetState(ctx, server, user, itemType)
 	if err != nil {
-		log.Error().Err(err).Str("server", server).Str("type", string(itemType)).Msg("could not get state from DB")
+		log.Error().Err(err).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("could not get state from DB")
 	}
-	opts := a.getQueryOpts(lastSeenUserDataUpdate, server, itemType)
-	items, err := client.GetItems(ctx, userId, opts)
+	stale, err := a.db.IsStale(ctx, server, user, itemType)
+	if err != nil {
+		log.Error().Err(err).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("could not get stale state from DB")
+	}
+	opts := a.getQueryOpts(lastSeenUserDataUpdate, stale, server, itemType)
+	full = !opts.IsDelta()
+	items, err := a.clients[server].GetItems(ctx, userId, opts)
 	if err != nil {
 		return err
 	}
+	fetched = len(items.Items)
 
 	if !opts.IsDelta() {
 		// Only set metric when fetching the full list of items
-		metrics.TotalItems.WithLabelValues(server, strings.ToLower(string(itemType))).Set(float64(len(items.Items)))
-		metrics.TotalItemsTimestamp.WithLabelValues(server, strings.ToLower(string(itemType))).SetToCurrentTime()
+		metrics.TotalItems.WithLabelValues(server, user, strings.ToLower(string(itemType))).Set(float64(len(items.Items)))
+		metrics.TotalItemsTimestamp.WithLabelValues(server, user, strings.ToLower(string(itemType))).SetToCurrentTime()
 	}
-	log.Info().Str("server", server).Str("type", string(itemType)).Msgf("Fetched %d items from server", len(items.Items))
-	if err = a.db.InsertItems(ctx, server, itemType, items.Items); err != nil {
+	log.Info().Str("server", server).Str("user", user).Str("type", string(itemType)).Msgf("Fetched %d items from server", len(items.Items))
+	if err = a.db.InsertItems(ctx, server, user, itemType, items.Items); err != nil {
 		return err
 	}
 
-	return a.db.RemoveItemsNotSeenSince(ctx, server, itemType, start)
+	if err = a.db.RemoveItemsNotSeenSince(ctx, server, user, itemType, start); err != nil {
+		return err
+	}
+
+	if stale && !a.dryRun {
+		// the cached items are up-to-date again after a full fetch and can be used as a source again
+		log.Info().Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Server is reachable again, clearing stale state")
+		return a.db.ClearStale(ctx, server, user, itemType)
+	}
+
+	return nil
 }
 
-func (a *App) synchronizeUpdatedUserData(ctx context.Context, itemType jellyfin.ItemType) error {
+// synchronizeUpdatedUserData sends the updates detected for the given servers of the user to Jellyfin.
+func (a *App) synchronizeUpdatedUserData(ctx context.Context, user string, itemType jellyfin.ItemType, servers []string) error {
 	var mutex sync.Mutex
 	var errs error
 	var wg sync.WaitGroup
 
-	wg.Add(len(a.clients))
-	for server, client := range a.clients {
+	for _, server := range servers {
+		if !a.receivesUpdates(server) {
+			log.Debug().Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Server does not receive updates, skipping")
+			continue
+		}
+
+		userName := a.users[user][server]
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := a.synchronizeSingleUpdatedUserData(ctx, itemType, server, client); err != nil {
+			updatedUserData, userDataErr := a.synchronizeSingleUpdatedUserData(ctx, itemType, server, user, userName)
+			updatedFavorites, favoritesErr := a.synchronizeSingleUpdatedFavorites(ctx, itemType, server, user, userName)
+			err := multierr.Combine(userDataErr, favoritesErr)
+			a.updateSyncResult(server, user, itemType, func(result *SyncResult) {
+				result.Updated = updatedUserData + updatedFavorites
+				result.addError(err)
+			})
+
+			if err != nil {
 				mutex.Lock()
 				errs = multierr.Append(errs, err)
 				mutex.Unlock()
@@ -242,74 +468,155 @@ func (a *App) synchronizeUpdatedUserData(ctx context.Context, itemType jellyfin.
 	return errs
 }
 
-func (a *App) synchronizeSingleUpdatedUserData(ctx context.Context, itemType jellyfin.ItemType, server string, client JellyfinClient) error {
-	var updated []sqlite.ItemWithUpdatedUserData
-	var err error
+// receivesUpdates returns whether the server may receive updates from any other server.
+func (a *App) receivesUpdates(server string) bool {
+	sources, found := a.sources[server]
+	return a.sources == nil || !found || len(sources) > 0
+}
 
-	switch itemType {
-	case jellyfin.ItemMovie:
-		updated, err = a.db.GetMoviesWithUpdatedUserData(ctx, server)
-	case jellyfin.ItemEpisode:
-		updated, err = a.db.GetEpisodesWithUpdatedUserData(ctx, server)
-	default:
-		return fmt.Errorf("invalid type: %s", itemType)
-	}
+func (a *App) synchronizeSingleUpdatedUserData(ctx context.Context, itemType jellyfin.ItemType, server, user, userName string) (int, error) {
+	updated, err := a.db.GetItemsWithUpdatedUserData(ctx, server, user, itemType)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	metrics.ItemsUpdatedUserData.WithLabelValues(server, strings.ToLower(string(itemType))).Set(float64(len(updated)))
+	metrics.ItemsUpdatedUserData.WithLabelValues(server, user, strings.ToLower(string(itemType))).Set(float64(len(updated)))
 	if len(updated) == 0 {
-		if err := a.db.UpsertState(ctx, server, itemType, time.Now()); err != nil {
-			log.Warn().Str("server", server).Err(err).Msg("could not upsert timestamp")
+		if a.dryRun {
+			return 0, nil
+		}
+
+		if err := a.db.UpsertState(ctx, server, user, itemType, time.Now()); err != nil {
+			log.Warn().Str("server", server).Str("user", user).Err(err).Msg("could not upsert timestamp")
 		} else {
-			log.Info().Str("server", server).Time("ts", time.Now()).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Upsert state")
+			log.Info().Str("server", server).Str("user", user).Time("ts", time.Now()).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Upsert state")
 		}
-		return nil
+		return 0, nil
 	}
 
-	log.Info().Str("server", server).Int("updated", len(updated)).Str("server", server).Str("type", string(itemType)).Msg("Found items with updated UserData")
+	log.Info().Str("server", server).Str("user", user).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Found items with updated UserData")
 
-	userId, err := client.GetUserId(ctx)
-	if err != nil {
-		return err
+	err = a.pushUserData(ctx, itemType, server, user, userName, updated)
+	if a.dryRun || err != nil {
+		return len(updated), err
 	}
 
 	var lowestTimestamp int64 = math.MaxInt64
-	var encounteredErrorsWhileUpdatingUserData bool
-	var errs error
 	for _, item := range updated {
-		if item.WatchedDate < lowestTimestamp {
+		if item.WatchedDate > 0 && item.WatchedDate < lowestTimestamp {
 			lowestTimestamp = item.WatchedDate
 		}
+	}
 
-		if err := client.UpdateUserData(ctx, userId, item.LocalID, item.AsUserData()); err != nil {
-			encounteredErrorsWhileUpdatingUserData = true
+	timestamp := time.Now()
+	if lowestTimestamp != math.MaxInt64 {
+		timestamp = time.Unix(lowestTimestamp-1, 0)
+	}
+	log.Info().Str("server", server).Str("user", user).Time("ts", timestamp).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Upsert state")
+	if err := a.db.UpsertState(ctx, server, user, itemType, timestamp); err != nil {
+		log.Error().Str("server", server).Str("user", user).Err(err).Str("type", string(itemType)).Msg("could not upsert timestamp")
+	}
+
+	return len(updated), nil
+}
+
+// pushUserData sends the given updated UserData to the server and records each update in the changelog. In dry run
+// mode, the updates are only planned.
+func (a *App) pushUserData(ctx context.Context, itemType jellyfin.ItemType, server, user, userName string, updated []sqlite.ItemWithUpdatedUserData) error {
+	if len(updated) == 0 {
+		return nil
+	}
+
+	if a.dryRun {
+		for _, item := range updated {
+			a.planUpdate(server, user, itemType, item.LocalID, item.Name, item.SeriesName, item.AsUserData(a.finishedThreshold))
+		}
+		return nil
+	}
+
+	client := a.clients[server]
+	userId, err := client.GetUserId(ctx, userName)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, item := range updated {
+		if err := client.UpdateUserData(ctx, userId, item.LocalID, item.AsUserData(a.finishedThreshold)); err != nil {
 			errs = multierr.Append(errs, err)
-			log.Error().Err(err).Str("id", item.LocalID).Str("name", item.Name).Str("server", server).Str("type", string(itemType)).Msg("Could not update UserData for item")
+			log.Error().Err(err).Str("id", item.LocalID).Str("name", item.Name).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Could not update UserData for item")
 		} else {
-			log.Info().Str("id", item.LocalID).Str("name", item.Name).Time("ts", time.Unix(item.WatchedDate, 0)).Str("server", server).Str("type", string(itemType)).Msg("Updated UserData for item")
-			err := a.db.InsertChangelog(ctx, server, getChangelogData(item))
+			log.Info().Str("id", item.LocalID).Str("name", item.Name).Time("ts", time.Unix(item.WatchedDate, 0)).Bool("played", item.Played).Bool("in_progress", item.IsInProgress(a.finishedThreshold)).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Updated UserData for item")
+			err := a.db.InsertChangelog(ctx, server, user, getChangelogData(item, a.runID, a.finishedThreshold))
 			if err != nil {
-				log.Error().Str("server", server).Err(err).Msg("Could not insert changelog")
+				log.Error().Str("server", server).Str("user", user).Err(err).Msg("Could not insert changelog")
 			}
 		}
 	}
 
-	if !encounteredErrorsWhileUpdatingUserData {
-		timestamp := time.Unix(lowestTimestamp-1, 0)
-		log.Info().Str("server", server).Time("ts", timestamp).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Upsert state")
-		if err := a.db.UpsertState(ctx, server, itemType, timestamp); err != nil {
-			log.Error().Str("server", server).Err(err).Str("type", string(itemType)).Msg("could not upsert timestamp")
+	return errs
+}
+
+func (a *App) synchronizeSingleUpdatedFavorites(ctx context.Context, itemType jellyfin.ItemType, server, user, userName string) (int, error) {
+	updated, err := a.db.GetItemsWithUpdatedFavorite(ctx, server, user, itemType)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.ItemsUpdatedFavorite.WithLabelValues(server, user, strings.ToLower(string(itemType))).Set(float64(len(updated)))
+	if len(updated) == 0 {
+		return 0, nil
+	}
+
+	log.Info().Str("server", server).Str("user", user).Int("updated", len(updated)).Str("type", string(itemType)).Msg("Found items with updated favorite state")
+
+	return len(updated), a.pushFavorites(ctx, itemType, server, user, userName, updated)
+}
+
+// pushFavorites sends the given updated favorite states to the server and records each update in the changelog. In dry
+// run mode, the updates are only planned.
+func (a *App) pushFavorites(ctx context.Context, itemType jellyfin.ItemType, server, user, userName string, updated []sqlite.ItemWithUpdatedFavorite) error {
+	if len(updated) == 0 {
+		return nil
+	}
+
+	if a.dryRun {
+		for _, item := range updated {
+			a.planUpdate(server, user, itemType, item.LocalID, item.Name, item.SeriesName, item.AsUserData())
+		}
+		return nil
+	}
+
+	client := a.clients[server]
+	userId, err := client.GetUserId(ctx, userName)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, item := range updated {
+		if err := client.UpdateUserData(ctx, userId, item.LocalID, item.AsUserData()); err != nil {
+			errs = multierr.Append(errs, err)
+			log.Error().Err(err).Str("id", item.LocalID).Str("name", item.Name).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Could not update favorite state for item")
+		} else {
+			log.Info().Str("id", item.LocalID).Str("name", item.Name).Bool("favorite", item.IsFavorite).Str("server", server).Str("user", user).Str("type", string(itemType)).Msg("Updated favorite state for item")
+			if err := a.db.InsertChangelog(ctx, server, user, getFavoriteChangelogData(item, a.runID)); err != nil {
+				log.Error().Str("server", server).Str("user", user).Err(err).Msg("Could not insert changelog")
+			}
 		}
 	}
 
 	return errs
 }
 
-func (a *App) getQueryOpts(lastCheck time.Time, server string, itemType jellyfin.ItemType) jellyfin.ItemQueryOpts {
+// getQueryOpts returns the options to fetch either the full list of items or only the deltas since the last check.
+// Stale servers always fetch the full list, as they may have missed any number of changes. Deltas are determined by the
+// date an item has been played last, as Jellyfin does not expose when the UserData of an item has been saved. Changed
+// favorites and unplayed items that have not been played are therefore only fetched by full syncs.
+func (a *App) getQueryOpts(lastCheck time.Time, stale bool, server string, itemType jellyfin.ItemType) jellyfin.ItemQueryOpts {
 	cnt := a.counter.Load()
-	if lastCheck.IsZero() || cnt%(a.fullSyncIntervalMinutes/a.syncIntervalMinutes) == 0 {
+	full := a.syncMode == SyncModeFull || (a.syncMode != SyncModeDelta && cnt%(a.fullSyncIntervalMinutes/a.syncIntervalMinutes) == 0)
+	if lastCheck.IsZero() || stale || full {
 		log.Info().Str("server", server).Str("type", string(itemType)).Msg("Requesting full list of items")
 		// querying for full list
 		return jellyfin.ItemQueryOpts{
@@ -317,11 +624,12 @@ func (a *App) getQueryOpts(lastCheck time.Time, server string, itemType jellyfin
 			Since:      nil,
 			StartIndex: 0,
 			Type:       itemType,
+			Filter:     a.filters[server],
 		}
 	}
 
 	// querying for deltas only
-	log.Info().Str("server", server).Time("since", lastCheck).Msg("Not requesting full list of movies, only deltas since last check")
+	log.Info().Str("server", server).Time("since", lastCheck).Str("type", string(itemType)).Msg("Not requesting full list of items, only deltas since last check")
 	return jellyfin.ItemQueryOpts{
 		Limit:      25,
 		Since:      &lastCheck,
@@ -329,15 +637,55 @@ func (a *App) getQueryOpts(lastCheck time.Time, server string, itemType jellyfin
 		SortBy:     jellyfin.SortFieldDatePlayed,
 		SortOrder:  jellyfin.SortOrderDescending,
 		Type:       itemType,
+		Filter:     a.filters[server],
 	}
 }
 
-func getChangelogData(item sqlite.ItemWithUpdatedUserData) sqlite.ChangelogData {
+func getChangelogData(item sqlite.ItemWithUpdatedUserData, runID string, finishedThreshold float64) sqlite.ChangelogData {
+	return sqlite.ChangelogData{
+		LocalID:                      item.LocalID,
+		NewWatchedDate:               item.WatchedDate,
+		NewWatchedProgress:           item.WatchedProgress,
+		NewWatchedPositionTicks:      item.WatchedPositionTicks,
+		NewIsFavorite:                item.IsFavorite,
+		NewPlayed:                    item.Played,
+		SourceServer:                 item.SourceServer,
+		SourceLocalID:                item.SourceLocalID,
+		PreviousWatchedDate:          item.PreviousWatchedDate,
+		PreviousWatchedPositionTicks: item.PreviousWatchedPositionTicks,
+		PreviousIsFavorite:           item.PreviousIsFavorite,
+		PreviousPlayed:               item.PreviousPlayed,
+		Reason:                       item.Reason(finishedThreshold),
+		RunID:                        runID,
+	}
+}
+
+func getFavoriteChangelogData(item sqlite.ItemWithUpdatedFavorite, runID string) sqlite.ChangelogData {
 	return sqlite.ChangelogData{
 		LocalID:                 item.LocalID,
 		NewWatchedDate:          item.WatchedDate,
 		NewWatchedProgress:      item.WatchedProgress,
 		NewWatchedPositionTicks: item.WatchedPositionTicks,
 		NewIsFavorite:           item.IsFavorite,
+		NewPlayed:               item.Played,
+		SourceServer:            item.SourceServer,
+		SourceLocalID:           item.SourceLocalID,
+		// only the favorite state is updated, all other values remain unchanged
+		PreviousWatchedDate:          item.WatchedDate,
+		PreviousWatchedPositionTicks: item.WatchedPositionTicks,
+		PreviousIsFavorite:           item.PreviousIsFavorite,
+		PreviousPlayed:               item.Played,
+		Reason:                       sqlite.ReasonFavorite,
+		RunID:                        runID,
+	}
+}
+
+// newRunID returns a random ID that is used to identify a sync run in the changelog.
+func newRunID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand does not fail on supported platforms, fall back to the current time nonetheless
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
 	}
+	return hex.EncodeToString(buf)
 }
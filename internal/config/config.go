@@ -2,7 +2,10 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"gopkg.in/yaml.v3"
@@ -14,6 +17,22 @@ const (
 	DefaultFullSyncIntervalMinutes = 60 * 6
 	DefaultSyncIntervalMinutes     = 5
 	DefaultMetricsAddr             = "127.0.0.1:8972"
+	DefaultFinishedThreshold       = 0.9
+
+	ItemTypeMovie      = "Movie"
+	ItemTypeEpisode    = "Episode"
+	ItemTypeAudio      = "Audio"
+	ItemTypeAudioBook  = "AudioBook"
+	ItemTypeMusicVideo = "MusicVideo"
+
+	// ModeSource clients only send their UserData to other clients, ModeTarget clients only receive UserData from other
+	// clients and ModeBidirectional clients do both.
+	ModeSource        = "source"
+	ModeTarget        = "target"
+	ModeBidirectional = "bidirectional"
+
+	// DefaultUser is the name of the user that is synced when no explicit user mappings are configured.
+	DefaultUser = "default"
 )
 
 type Config struct {
@@ -22,27 +41,188 @@ type Config struct {
 	} `yaml:"database"`
 	Clients map[string]JellyfinServerConfig `yaml:"clients" validate:"dive"`
 
+	// Users maps the name of a user to the user's Jellyfin user name on each server. Servers that are not listed for
+	// a user are not synced for this user.
+	Users map[string]map[string]string `yaml:"users" validate:"omitempty,dive,keys,required,endkeys,min=1,dive,keys,required,endkeys,required"`
+
+	// ItemTypes are the types of items to sync, each type is synced on its own
+	ItemTypes []string `yaml:"item_types" validate:"min=1,unique,dive,oneof=Movie Episode Audio AudioBook MusicVideo"`
+
+	// ConflictPolicies selects the policy per item type that decides which server's UserData wins if an item differs
+	// across servers, item types without a policy let the most recent change win
+	ConflictPolicies map[string]ConflictPolicyConfig `yaml:"conflict_policies" validate:"dive,keys,oneof=Movie Episode Audio AudioBook MusicVideo,endkeys,required"`
+
+	// MatchPriorities selects per item type the strategies, in order of priority, that identify the same item across
+	// servers. Items that none of the strategies apply to are matched by their name and runtime.
+	MatchPriorities map[string][]string `yaml:"match_priorities" validate:"dive,keys,oneof=Movie Episode Audio AudioBook MusicVideo,endkeys,min=1,unique,dive,oneof=imdb tmdb tvdb anidb tvmaze musicbrainz series_imdb series_tmdb series_tvdb series_anidb series_tvmaze"`
+
+	// Replication optionally restricts which clients send UserData to which clients. If omitted, every client sends
+	// its UserData to all other clients that are allowed to receive it according to their mode.
+	Replication []ReplicationEdge `yaml:"replication" validate:"dive"`
+
 	EventSources *Events `yaml:"events"`
 
+	// Api is the optional API to control the daemon
+	Api *ApiConfig `yaml:"api"`
+
+	// SyncIntervalMinutes is the interval of incremental syncs, which only fetch the items that have been played since
+	// the last sync. Changed favorites and unplayed items that have not been played are picked up by full syncs only,
+	// unless an event source reports them.
 	SyncIntervalMinutes     int `yaml:"sync_interval_mins" validate:"gte=5,lt=1440"`
 	FullSyncIntervalMinutes int `yaml:"full_sync_interval_mins" validate:"gte=30,lt=1440"`
 
+	// FinishedThreshold is the share of an item's runtime after which an item that is in progress is considered finished
+	FinishedThreshold float64 `yaml:"finished_threshold" validate:"gt=0,lte=1"`
+
 	MetricsAddr string `yaml:"metrics_addr" validate:"omitempty,hostname_port"`
 	MetricsPath string `yaml:"metrics_path" validate:"omitempty,filepath"`
 }
 
+// ReplicationEdge allows the client From to send its UserData to the client To.
+type ReplicationEdge struct {
+	From string `yaml:"from" validate:"required,nefield=To"`
+	To   string `yaml:"to" validate:"required"`
+}
+
+type ConflictPolicyConfig struct {
+	Policy string `yaml:"policy" validate:"required,oneof=latest furthest_position played primary max_play_count"`
+	// Primary is the name of the client whose state is authoritative, required by the primary policy
+	Primary string `yaml:"primary" validate:"required_if=Policy primary,excluded_unless=Policy primary"`
+}
+
 type Events struct {
-	WebhookServer *struct {
-		Addr string `yaml:"addr" validate:"omitempty,hostname_port"`
-		Path string `yaml:"path"` // TODO: validate
-	} `yaml:"webhook"`
+	WebhookServer *WebhookConfig   `yaml:"webhook"`
+	Mqtt          *MqttConfig      `yaml:"mqtt"`
+	Websocket     *WebsocketConfig `yaml:"websocket"`
+}
+
+type WebsocketConfig struct {
+	// Clients are the names of the clients to connect to, defaults to all clients
+	Clients []string `yaml:"clients" validate:"dive,required"`
+}
+
+type MqttConfig struct {
+	// Broker is the URL of the broker, e.g. tcp://localhost:1883 or ssl://localhost:8883
+	Broker string   `yaml:"broker" validate:"required,url"`
+	Topics []string `yaml:"topics" validate:"min=1,dive,required"`
+	// ClientID defaults to "jellyporter"
+	ClientID     string `yaml:"client_id" validate:"omitempty,max=23"`
+	Username     string `yaml:"username" validate:"required_with=Password PasswordFile"`
+	Password     string `yaml:"password" validate:"excluded_with=PasswordFile"`
+	PasswordFile string `yaml:"password_file" validate:"omitempty,file"`
+	QoS          int    `yaml:"qos" validate:"gte=0,lte=1"`
+
+	// Optional TLS settings, TLS is used if the broker's scheme is ssl, tls or mqtts or any of the files is set
+	TLSCAFile   string `yaml:"tls_ca_file" validate:"omitempty,file"`
+	TLSCertFile string `yaml:"tls_cert_file" validate:"required_with=TLSKeyFile,omitempty,file"`
+	TLSKeyFile  string `yaml:"tls_key_file" validate:"required_with=TLSCertFile,omitempty,file"`
+}
+
+func (c *MqttConfig) GetPassword() (string, error) {
+	return readSecret(c.Password, c.PasswordFile)
+}
+
+type WebhookConfig struct {
+	Addr string `yaml:"addr" validate:"omitempty,hostname_port"`
+	Path string `yaml:"path"` // TODO: validate
+
+	// Optional TLS, certificates are reloaded automatically when their files change
+	TLSCertFile string `yaml:"tls_cert_file" validate:"required_with=TLSKeyFile,omitempty,file"`
+	TLSKeyFile  string `yaml:"tls_key_file" validate:"required_with=TLSCertFile,omitempty,file"`
+	// ClientCAFile enables mTLS, clients need to present a certificate signed by one of its CAs
+	ClientCAFile string `yaml:"client_ca_file" validate:"excluded_without=TLSCertFile,omitempty,file"`
+
+	// Optional authentication, all configured methods need to pass
+	BearerToken           string `yaml:"bearer_token" validate:"excluded_with=BearerTokenFile"`
+	BearerTokenFile       string `yaml:"bearer_token_file" validate:"omitempty,file"`
+	BasicAuthUser         string `yaml:"basic_auth_user" validate:"required_with=BasicAuthPassword BasicAuthPasswordFile"`
+	BasicAuthPassword     string `yaml:"basic_auth_password" validate:"excluded_with=BasicAuthPasswordFile"`
+	BasicAuthPasswordFile string `yaml:"basic_auth_password_file" validate:"omitempty,file"`
+	HmacSecret            string `yaml:"hmac_secret" validate:"excluded_with=HmacSecretFile"`
+	HmacSecretFile        string `yaml:"hmac_secret_file" validate:"omitempty,file"`
+	// HmacHeader is the header that holds the signature of the body
+	HmacHeader string `yaml:"hmac_header"`
+
+	// TrustedProxies are the networks whose X-Forwarded-For and X-Real-IP headers are honoured
+	TrustedProxies []string `yaml:"trusted_proxies" validate:"dive,cidr"`
+}
+
+type ApiConfig struct {
+	Addr      string `yaml:"addr" validate:"required,hostname_port"`
+	Token     string `yaml:"token" validate:"required_without=TokenFile,excluded_with=TokenFile"`
+	TokenFile string `yaml:"token_file" validate:"required_without=Token,omitempty,file"`
+
+	// Optional TLS settings
+	TLSCertFile string `yaml:"tls_cert_file" validate:"required_with=TLSKeyFile,omitempty,file"`
+	TLSKeyFile  string `yaml:"tls_key_file" validate:"required_with=TLSCertFile,omitempty,file"`
+}
+
+func (c *ApiConfig) GetToken() (string, error) {
+	return readSecret(c.Token, c.TokenFile)
+}
+
+func (c *WebhookConfig) GetBearerToken() (string, error) {
+	return readSecret(c.BearerToken, c.BearerTokenFile)
+}
+
+func (c *WebhookConfig) GetBasicAuthPassword() (string, error) {
+	return readSecret(c.BasicAuthPassword, c.BasicAuthPasswordFile)
+}
+
+func (c *WebhookConfig) GetHmacSecret() (string, error) {
+	return readSecret(c.HmacSecret, c.HmacSecretFile)
+}
+
+// readSecret returns the given value or, if it's empty, the content of the given file without surrounding whitespace.
+// Returns an empty string if neither is set.
+func readSecret(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
 }
 
 type JellyfinServerConfig struct {
 	Address    string `yaml:"url" validate:"http_url"`
-	User       string `yaml:"user" validate:"alphanum"`
+	User       string `yaml:"user" validate:"omitempty,alphanum"`
 	ApiKey     string `yaml:"api_key" validate:"required_without=ApiKeyFile,omitempty,alphanum"`
 	ApiKeyFile string `yaml:"api_key_file" validate:"required_without=ApiKey,omitempty,file"`
+	// Mode is either source, target or bidirectional (default)
+	Mode string `yaml:"mode" validate:"omitempty,oneof=source target bidirectional"`
+	// Filters optionally restrict the items that are synced
+	Filters *FilterConfig `yaml:"filters"`
+}
+
+type FilterConfig struct {
+	// Include restricts the items to the items that match any of the rules of each kind
+	Include FilterRules `yaml:"include"`
+	// Exclude skips the items that match any of the rules
+	Exclude FilterRules `yaml:"exclude"`
+}
+
+type FilterRules struct {
+	// Libraries are the names of the libraries
+	Libraries []string `yaml:"libraries" validate:"dive,required"`
+	// ParentIDs are the IDs of libraries, collections or folders
+	ParentIDs []string `yaml:"parent_ids" validate:"dive,required"`
+	Tags      []string `yaml:"tags" validate:"dive,required"`
+	Genres    []string `yaml:"genres" validate:"dive,required"`
+}
+
+// IsSource returns whether the client may send its UserData to other clients.
+func (c *JellyfinServerConfig) IsSource() bool {
+	return c.Mode != ModeTarget
+}
+
+// IsTarget returns whether the client may receive UserData from other clients.
+func (c *JellyfinServerConfig) IsTarget() bool {
+	return c.Mode != ModeSource
 }
 
 func (c *JellyfinServerConfig) GetApiKey() (string, error) {
@@ -81,9 +261,117 @@ func (c *Config) Validate() error {
 		return errors.New("full_sync_interval_mins must be divisible by sync_interval_mins but is not")
 	}
 
+	if c.EventSources != nil && c.EventSources.WebhookServer != nil {
+		webhook := c.EventSources.WebhookServer
+		if webhook.BasicAuthUser != "" && webhook.BasicAuthPassword == "" && webhook.BasicAuthPasswordFile == "" {
+			return errors.New("basic_auth_user requires either basic_auth_password or basic_auth_password_file")
+		}
+	}
+
+	if c.EventSources != nil && c.EventSources.Websocket != nil {
+		for _, client := range c.EventSources.Websocket.Clients {
+			if _, found := c.Clients[client]; !found {
+				return fmt.Errorf("websocket references unknown client %q", client)
+			}
+		}
+	}
+
+	for itemType, policy := range c.ConflictPolicies {
+		if _, found := c.Clients[policy.Primary]; policy.Primary != "" && !found {
+			return fmt.Errorf("conflict policy of %q references unknown client %q", itemType, policy.Primary)
+		}
+	}
+
+	for _, edge := range c.Replication {
+		from, found := c.Clients[edge.From]
+		if !found {
+			return fmt.Errorf("replication references unknown client %q", edge.From)
+		}
+		to, found := c.Clients[edge.To]
+		if !found {
+			return fmt.Errorf("replication references unknown client %q", edge.To)
+		}
+		if !from.IsSource() {
+			return fmt.Errorf("replication from %q to %q is not possible, %q is a target", edge.From, edge.To, edge.From)
+		}
+		if !to.IsTarget() {
+			return fmt.Errorf("replication from %q to %q is not possible, %q is a source", edge.From, edge.To, edge.To)
+		}
+	}
+
+	if len(c.Users) == 0 {
+		for name, client := range c.Clients {
+			if client.User == "" {
+				return fmt.Errorf("client %q has no user configured and no user mappings are defined", name)
+			}
+		}
+	}
+
+	for user, servers := range c.Users {
+		for server := range servers {
+			if _, found := c.Clients[server]; !found {
+				return fmt.Errorf("user %q references unknown client %q", user, server)
+			}
+		}
+	}
+
 	return nil
 }
 
+// GetUsers returns the configured user mappings. If no user mappings are configured, a single user named DefaultUser
+// is returned that is mapped to the user configured for each client.
+func (c *Config) GetUsers() map[string]map[string]string {
+	if len(c.Users) > 0 {
+		return c.Users
+	}
+
+	servers := make(map[string]string, len(c.Clients))
+	for name, client := range c.Clients {
+		servers[name] = client.User
+	}
+
+	return map[string]map[string]string{
+		DefaultUser: servers,
+	}
+}
+
+// GetReplicationSources returns the clients each client receives UserData from, based on the clients' modes and the
+// replication edges. Returns nil if every client exchanges UserData with every other client.
+func (c *Config) GetReplicationSources() map[string][]string {
+	restricted := len(c.Replication) > 0
+	for _, client := range c.Clients {
+		if !client.IsSource() || !client.IsTarget() {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return nil
+	}
+
+	edges := make(map[ReplicationEdge]bool, len(c.Replication))
+	for _, edge := range c.Replication {
+		edges[edge] = true
+	}
+
+	ret := make(map[string][]string, len(c.Clients))
+	for target, targetConf := range c.Clients {
+		sources := []string{}
+		for source, sourceConf := range c.Clients {
+			if source == target || !sourceConf.IsSource() || !targetConf.IsTarget() {
+				continue
+			}
+			if len(edges) > 0 && !edges[ReplicationEdge{From: source, To: target}] {
+				continue
+			}
+			sources = append(sources, source)
+		}
+		slices.Sort(sources)
+		ret[target] = sources
+	}
+
+	return ret
+}
+
 func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 	type Alias Config // Create an alias to avoid recursion during unmarshalling
 
@@ -92,6 +380,8 @@ func (c *Config) UnmarshalYAML(node *yaml.Node) error {
 		FullSyncIntervalMinutes: DefaultFullSyncIntervalMinutes,
 		SyncIntervalMinutes:     DefaultSyncIntervalMinutes,
 		MetricsAddr:             DefaultMetricsAddr,
+		FinishedThreshold:       DefaultFinishedThreshold,
+		ItemTypes:               []string{ItemTypeMovie, ItemTypeEpisode},
 	}
 
 	// Unmarshal the yaml data into the temporary struct
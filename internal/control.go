@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+	"go.uber.org/multierr"
+)
+
+// SyncMode controls whether a sync fetches the full list of items from Jellyfin or only the deltas since the last sync.
+type SyncMode string
+
+const (
+	// SyncModeAuto fetches the full list of items every full_sync_interval_mins and deltas otherwise
+	SyncModeAuto  SyncMode = "auto"
+	SyncModeFull  SyncMode = "full"
+	SyncModeDelta SyncMode = "delta"
+)
+
+var (
+	ErrPaused      = errors.New("syncing is paused")
+	ErrSyncPending = errors.New("a sync has already been triggered")
+)
+
+// ParseSyncMode parses the name of a sync mode, an empty string returns SyncModeAuto.
+func ParseSyncMode(mode string) (SyncMode, error) {
+	switch SyncMode(mode) {
+	case "", SyncModeAuto:
+		return SyncModeAuto, nil
+	case SyncModeFull, SyncModeDelta:
+		return SyncMode(mode), nil
+	default:
+		return "", fmt.Errorf("unknown sync mode %q", mode)
+	}
+}
+
+// SyncResult is the result of the last sync of a single type of items of a user on a server.
+type SyncResult struct {
+	RunID    string            `json:"run_id"`
+	Server   string            `json:"server"`
+	User     string            `json:"user"`
+	Type     jellyfin.ItemType `json:"type"`
+	Full     bool              `json:"full"`
+	Started  time.Time         `json:"started"`
+	Finished time.Time         `json:"finished"`
+	Fetched  int               `json:"fetched"`
+	Updated  int               `json:"updated"`
+	Success  bool              `json:"success"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+type syncResultKey struct {
+	server   string
+	user     string
+	itemType jellyfin.ItemType
+}
+
+// TriggerSync requests a sync from the sync loop. Returns ErrSyncPending if a sync has already been triggered but not
+// yet started and ErrPaused if syncing is paused.
+func (a *App) TriggerSync(mode SyncMode) error {
+	if a.paused.Load() {
+		return ErrPaused
+	}
+
+	select {
+	case a.triggers <- mode:
+		log.Info().Str("mode", string(mode)).Msg("Triggered sync")
+		return nil
+	default:
+		return ErrSyncPending
+	}
+}
+
+// Pause stops all syncs triggered by the ticker and by event sources until Resume is called. Events that arrive while
+// syncing is paused are queued. A sync that is already running is not interrupted.
+func (a *App) Pause() {
+	if a.paused.CompareAndSwap(false, true) {
+		metrics.Paused.Set(1)
+		log.Info().Msg("Paused syncing")
+	}
+}
+
+// Resume resumes syncing after Pause has been called, events that have been queued in the meantime are synced right
+// away.
+func (a *App) Resume() {
+	if a.paused.CompareAndSwap(true, false) {
+		metrics.Paused.Set(0)
+		log.Info().Msg("Resumed syncing")
+		select {
+		case a.resumed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (a *App) IsPaused() bool {
+	return a.paused.Load()
+}
+
+// QueuedSyncs returns the number of syncs requested by event sources that wait for the end of the cooldown phase.
+func (a *App) QueuedSyncs() int {
+	return a.queue.len()
+}
+
+// SyncResults returns the result of the last sync per server, user and type of items.
+func (a *App) SyncResults() []SyncResult {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	ret := make([]SyncResult, 0, len(a.results))
+	for _, result := range a.results {
+		result.Success = len(result.Errors) == 0
+		result.Errors = slices.Clone(result.Errors)
+		ret = append(ret, *result)
+	}
+
+	slices.SortFunc(ret, func(a, b SyncResult) int {
+		return strings.Compare(a.Server+"/"+a.User+"/"+string(a.Type), b.Server+"/"+b.User+"/"+string(b.Type))
+	})
+	return ret
+}
+
+// updateSyncResult applies the given update to the result of the current sync of the server, user and type of items.
+// A result of a previous run is replaced.
+func (a *App) updateSyncResult(server, user string, itemType jellyfin.ItemType, update func(result *SyncResult)) {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	key := syncResultKey{server: server, user: user, itemType: itemType}
+	result, found := a.results[key]
+	if !found || result.RunID != a.runID {
+		result = &SyncResult{
+			RunID:   a.runID,
+			Server:  server,
+			User:    user,
+			Type:    itemType,
+			Started: time.Now(),
+		}
+		a.results[key] = result
+	}
+
+	update(result)
+	result.Finished = time.Now()
+}
+
+func (r *SyncResult) addError(err error) {
+	for _, err := range multierr.Errors(err) {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+// PendingUpdates returns the updates that have been detected in the SQLite cache but have not been sent to Jellyfin
+// yet, e.g. because the sync is paused or sending them has failed.
+func (a *App) PendingUpdates(ctx context.Context) ([]PlannedUpdate, error) {
+	var errs error
+	var ret []PlannedUpdate
+	for _, user := range slices.Sorted(maps.Keys(a.users)) {
+		for _, server := range slices.Sorted(maps.Keys(a.users[user])) {
+			for _, itemType := range a.itemTypes {
+				updated, err := a.db.GetItemsWithUpdatedUserData(ctx, server, user, itemType)
+				if err != nil {
+					errs = multierr.Append(errs, err)
+					continue
+				}
+				for _, item := range updated {
+					ret = append(ret, getPlannedUpdates(server, user, itemType, item.LocalID, item.Name, item.SeriesName, item.AsUserData(a.finishedThreshold))...)
+				}
+
+				favorites, err := a.db.GetItemsWithUpdatedFavorite(ctx, server, user, itemType)
+				if err != nil {
+					errs = multierr.Append(errs, err)
+					continue
+				}
+				for _, item := range favorites {
+					ret = append(ret, getPlannedUpdates(server, user, itemType, item.LocalID, item.Name, item.SeriesName, item.AsUserData())...)
+				}
+			}
+		}
+	}
+
+	return ret, errs
+}
@@ -0,0 +1,455 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+func (q *SQLiteJellyDb) GetAudioWithUpdatedUserData(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error) {
+	start := time.Now()
+	policy := q.conflictPolicy(jellyfin.ItemAudio)
+	updated, err := q.generated.GetAudioWithGreatestWatchedDate(ctx, generated.GetAudioWithGreatestWatchedDateParams{
+		Server:        server,
+		User:          user,
+		Policy:        string(policy.Strategy),
+		PrimaryServer: policy.PrimaryServer,
+		Sources:       q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioWithGreatestWatchedDate").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioWithGreatestWatchedDate").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedUserData, len(updated))
+	for idx, track := range updated {
+		ret[idx] = ItemWithUpdatedUserData{
+			LocalID:                      track.LocalID,
+			Name:                         track.Name,
+			WatchedDate:                  track.WatchedDate,
+			WatchedProgress:              track.WatchedProgress,
+			WatchedPositionTicks:         track.WatchedPositionTicks,
+			IsFavorite:                   track.IsFavorite,
+			Played:                       track.Played,
+			Runtime:                      track.Runtime,
+			PlayCount:                    track.PlayCount,
+			SourceServer:                 track.SourceServer,
+			SourceLocalID:                track.SourceLocalID,
+			PreviousWatchedDate:          track.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: track.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           track.PreviousIsFavorite,
+			PreviousPlayed:               track.PreviousPlayed,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioWithUpdatedFavorite(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error) {
+	start := time.Now()
+	updated, err := q.generated.GetAudioWithUpdatedFavorite(ctx, generated.GetAudioWithUpdatedFavoriteParams{
+		Server:  server,
+		User:    user,
+		Sources: q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioWithUpdatedFavorite").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioWithUpdatedFavorite").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedFavorite, len(updated))
+	for idx, track := range updated {
+		ret[idx] = ItemWithUpdatedFavorite{
+			LocalID:              track.LocalID,
+			Name:                 track.Name,
+			WatchedDate:          track.WatchedDate,
+			WatchedProgress:      track.WatchedProgress,
+			WatchedPositionTicks: track.WatchedPositionTicks,
+			Played:               track.Played,
+			IsFavorite:           track.IsFavorite,
+			FavoriteChanged:      track.FavoriteChanged,
+			SourceServer:         track.SourceServer,
+			SourceLocalID:        track.SourceLocalID,
+			PreviousIsFavorite:   track.PreviousIsFavorite,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) InsertAudio(ctx context.Context, server, user string, tracks []jellyfin.Item) error {
+	start := time.Now()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertAudio").Inc()
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	queries := q.generated.WithTx(tx)
+	for _, track := range tracks {
+		if err := queries.InsertAudio(ctx, AudioToInsertAudioParam(server, user, track, q.matchers[jellyfin.ItemAudio])); err != nil {
+			metrics.DbQueryErrors.WithLabelValues("InsertAudio").Inc()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	metrics.DbQueriesTime.WithLabelValues("InsertAudio").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertAudio").Inc()
+	}
+	return err
+}
+
+func (q *SQLiteJellyDb) RemoveAudioNotSeenSince(ctx context.Context, server, user string, since time.Time) error {
+	start := time.Now()
+
+	if err := q.generated.RemoveAudioNotSeenSince(ctx, generated.RemoveAudioNotSeenSinceParams{
+		Server: server,
+		User:   user,
+		Since:  since.Unix(),
+	}); err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RemoveAudioNotSeenSince").Inc()
+		return err
+	}
+
+	metrics.DbQueriesTime.WithLabelValues("RemoveAudioNotSeenSince").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) GetAudioBooksWithUpdatedUserData(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error) {
+	start := time.Now()
+	policy := q.conflictPolicy(jellyfin.ItemAudioBook)
+	updated, err := q.generated.GetAudioBookWithGreatestWatchedDate(ctx, generated.GetAudioBookWithGreatestWatchedDateParams{
+		Server:        server,
+		User:          user,
+		Policy:        string(policy.Strategy),
+		PrimaryServer: policy.PrimaryServer,
+		Sources:       q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioBookWithGreatestWatchedDate").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioBookWithGreatestWatchedDate").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedUserData, len(updated))
+	for idx, audioBook := range updated {
+		ret[idx] = ItemWithUpdatedUserData{
+			LocalID:                      audioBook.LocalID,
+			Name:                         audioBook.Name,
+			WatchedDate:                  audioBook.WatchedDate,
+			WatchedProgress:              audioBook.WatchedProgress,
+			WatchedPositionTicks:         audioBook.WatchedPositionTicks,
+			IsFavorite:                   audioBook.IsFavorite,
+			Played:                       audioBook.Played,
+			Runtime:                      audioBook.Runtime,
+			PlayCount:                    audioBook.PlayCount,
+			SourceServer:                 audioBook.SourceServer,
+			SourceLocalID:                audioBook.SourceLocalID,
+			PreviousWatchedDate:          audioBook.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: audioBook.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           audioBook.PreviousIsFavorite,
+			PreviousPlayed:               audioBook.PreviousPlayed,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioBooksWithUpdatedFavorite(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error) {
+	start := time.Now()
+	updated, err := q.generated.GetAudioBookWithUpdatedFavorite(ctx, generated.GetAudioBookWithUpdatedFavoriteParams{
+		Server:  server,
+		User:    user,
+		Sources: q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioBookWithUpdatedFavorite").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioBookWithUpdatedFavorite").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedFavorite, len(updated))
+	for idx, audioBook := range updated {
+		ret[idx] = ItemWithUpdatedFavorite{
+			LocalID:              audioBook.LocalID,
+			Name:                 audioBook.Name,
+			WatchedDate:          audioBook.WatchedDate,
+			WatchedProgress:      audioBook.WatchedProgress,
+			WatchedPositionTicks: audioBook.WatchedPositionTicks,
+			Played:               audioBook.Played,
+			IsFavorite:           audioBook.IsFavorite,
+			FavoriteChanged:      audioBook.FavoriteChanged,
+			SourceServer:         audioBook.SourceServer,
+			SourceLocalID:        audioBook.SourceLocalID,
+			PreviousIsFavorite:   audioBook.PreviousIsFavorite,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) InsertAudioBooks(ctx context.Context, server, user string, audioBooks []jellyfin.Item) error {
+	start := time.Now()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertAudioBooks").Inc()
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	queries := q.generated.WithTx(tx)
+	for _, audioBook := range audioBooks {
+		if err := queries.InsertAudioBook(ctx, AudioBookToInsertAudioBookParam(server, user, audioBook, q.matchers[jellyfin.ItemAudioBook])); err != nil {
+			metrics.DbQueryErrors.WithLabelValues("InsertAudioBooks").Inc()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	metrics.DbQueriesTime.WithLabelValues("InsertAudioBooks").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertAudioBooks").Inc()
+	}
+	return err
+}
+
+func (q *SQLiteJellyDb) RemoveAudioBooksNotSeenSince(ctx context.Context, server, user string, since time.Time) error {
+	start := time.Now()
+
+	if err := q.generated.RemoveAudioBooksNotSeenSince(ctx, generated.RemoveAudioBooksNotSeenSinceParams{
+		Server: server,
+		User:   user,
+		Since:  since.Unix(),
+	}); err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RemoveAudioBooksNotSeenSince").Inc()
+		return err
+	}
+
+	metrics.DbQueriesTime.WithLabelValues("RemoveAudioBooksNotSeenSince").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) GetMusicVideosWithUpdatedUserData(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error) {
+	start := time.Now()
+	policy := q.conflictPolicy(jellyfin.ItemMusicVideo)
+	updated, err := q.generated.GetMusicVideoWithGreatestWatchedDate(ctx, generated.GetMusicVideoWithGreatestWatchedDateParams{
+		Server:        server,
+		User:          user,
+		Policy:        string(policy.Strategy),
+		PrimaryServer: policy.PrimaryServer,
+		Sources:       q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMusicVideoWithGreatestWatchedDate").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMusicVideoWithGreatestWatchedDate").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedUserData, len(updated))
+	for idx, musicVideo := range updated {
+		ret[idx] = ItemWithUpdatedUserData{
+			LocalID:                      musicVideo.LocalID,
+			Name:                         musicVideo.Name,
+			WatchedDate:                  musicVideo.WatchedDate,
+			WatchedProgress:              musicVideo.WatchedProgress,
+			WatchedPositionTicks:         musicVideo.WatchedPositionTicks,
+			IsFavorite:                   musicVideo.IsFavorite,
+			Played:                       musicVideo.Played,
+			Runtime:                      musicVideo.Runtime,
+			PlayCount:                    musicVideo.PlayCount,
+			SourceServer:                 musicVideo.SourceServer,
+			SourceLocalID:                musicVideo.SourceLocalID,
+			PreviousWatchedDate:          musicVideo.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: musicVideo.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           musicVideo.PreviousIsFavorite,
+			PreviousPlayed:               musicVideo.PreviousPlayed,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetMusicVideosWithUpdatedFavorite(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error) {
+	start := time.Now()
+	updated, err := q.generated.GetMusicVideoWithUpdatedFavorite(ctx, generated.GetMusicVideoWithUpdatedFavoriteParams{
+		Server:  server,
+		User:    user,
+		Sources: q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMusicVideoWithUpdatedFavorite").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMusicVideoWithUpdatedFavorite").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedFavorite, len(updated))
+	for idx, musicVideo := range updated {
+		ret[idx] = ItemWithUpdatedFavorite{
+			LocalID:              musicVideo.LocalID,
+			Name:                 musicVideo.Name,
+			WatchedDate:          musicVideo.WatchedDate,
+			WatchedProgress:      musicVideo.WatchedProgress,
+			WatchedPositionTicks: musicVideo.WatchedPositionTicks,
+			Played:               musicVideo.Played,
+			IsFavorite:           musicVideo.IsFavorite,
+			FavoriteChanged:      musicVideo.FavoriteChanged,
+			SourceServer:         musicVideo.SourceServer,
+			SourceLocalID:        musicVideo.SourceLocalID,
+			PreviousIsFavorite:   musicVideo.PreviousIsFavorite,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) InsertMusicVideos(ctx context.Context, server, user string, musicVideos []jellyfin.Item) error {
+	start := time.Now()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertMusicVideos").Inc()
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	queries := q.generated.WithTx(tx)
+	for _, musicVideo := range musicVideos {
+		if err := queries.InsertMusicVideo(ctx, MusicVideoToInsertMusicVideoParam(server, user, musicVideo, q.matchers[jellyfin.ItemMusicVideo])); err != nil {
+			metrics.DbQueryErrors.WithLabelValues("InsertMusicVideos").Inc()
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	metrics.DbQueriesTime.WithLabelValues("InsertMusicVideos").Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("InsertMusicVideos").Inc()
+	}
+	return err
+}
+
+func (q *SQLiteJellyDb) RemoveMusicVideosNotSeenSince(ctx context.Context, server, user string, since time.Time) error {
+	start := time.Now()
+
+	if err := q.generated.RemoveMusicVideosNotSeenSince(ctx, generated.RemoveMusicVideosNotSeenSinceParams{
+		Server: server,
+		User:   user,
+		Since:  since.Unix(),
+	}); err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RemoveMusicVideosNotSeenSince").Inc()
+		return err
+	}
+
+	metrics.DbQueriesTime.WithLabelValues("RemoveMusicVideosNotSeenSince").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func AudioToInsertAudioParam(server, user string, track jellyfin.Item, matcher *matching.Matcher) generated.InsertAudioParams {
+	watchedDate, playedChanged, favoriteChanged := getChangeTimestamps(track.UserData)
+	return generated.InsertAudioParams{
+		Server:               server,
+		User:                 user,
+		Name:                 track.Name,
+		LocalID:              track.ID,
+		Album:                track.Album,
+		AlbumArtist:          track.Artist(),
+		ProviderIds:          providerIDsJSON(track.ProviderIDs),
+		MatchKey:             matcher.Key(track),
+		WatchedDate:          watchedDate,
+		WatchedPositionTicks: track.UserData.PlaybackPositionTicks,
+		WatchedProgress:      track.UserData.PlayedPercentage,
+		Runtime:              track.Runtime,
+		PlayCount:            int64(track.UserData.PlayCount),
+		IsFavorite:           track.UserData.IsFavorite,
+		Played:               track.UserData.Played,
+		PlayedChanged:        playedChanged,
+		FavoriteChanged:      favoriteChanged,
+	}
+}
+
+func AudioBookToInsertAudioBookParam(server, user string, audioBook jellyfin.Item, matcher *matching.Matcher) generated.InsertAudioBookParams {
+	watchedDate, playedChanged, favoriteChanged := getChangeTimestamps(audioBook.UserData)
+	return generated.InsertAudioBookParams{
+		Server:               server,
+		User:                 user,
+		Name:                 audioBook.Name,
+		LocalID:              audioBook.ID,
+		Album:                audioBook.Album,
+		AlbumArtist:          audioBook.Artist(),
+		ProviderIds:          providerIDsJSON(audioBook.ProviderIDs),
+		MatchKey:             matcher.Key(audioBook),
+		WatchedDate:          watchedDate,
+		WatchedPositionTicks: audioBook.UserData.PlaybackPositionTicks,
+		WatchedProgress:      audioBook.UserData.PlayedPercentage,
+		Runtime:              audioBook.Runtime,
+		PlayCount:            int64(audioBook.UserData.PlayCount),
+		IsFavorite:           audioBook.UserData.IsFavorite,
+		Played:               audioBook.UserData.Played,
+		PlayedChanged:        playedChanged,
+		FavoriteChanged:      favoriteChanged,
+	}
+}
+
+func MusicVideoToInsertMusicVideoParam(server, user string, musicVideo jellyfin.Item, matcher *matching.Matcher) generated.InsertMusicVideoParams {
+	watchedDate, playedChanged, favoriteChanged := getChangeTimestamps(musicVideo.UserData)
+	return generated.InsertMusicVideoParams{
+		Server:               server,
+		User:                 user,
+		Name:                 musicVideo.Name,
+		LocalID:              musicVideo.ID,
+		Album:                musicVideo.Album,
+		Artist:               musicVideo.Artist(),
+		ProviderIds:          providerIDsJSON(musicVideo.ProviderIDs),
+		MatchKey:             matcher.Key(musicVideo),
+		WatchedDate:          watchedDate,
+		WatchedPositionTicks: musicVideo.UserData.PlaybackPositionTicks,
+		WatchedProgress:      musicVideo.UserData.PlayedPercentage,
+		Runtime:              musicVideo.Runtime,
+		PlayCount:            int64(musicVideo.UserData.PlayCount),
+		IsFavorite:           musicVideo.UserData.IsFavorite,
+		Played:               musicVideo.UserData.Played,
+		PlayedChanged:        playedChanged,
+		FavoriteChanged:      favoriteChanged,
+	}
+}
+
+// providerIDsJSON returns the provider IDs as a JSON object, which allows to look up items by any of their IDs
+// regardless of the strategy that has derived their match key.
+func providerIDsJSON(ids jellyfin.ProviderIDs) string {
+	// marshalling a map of strings can not fail
+	data, _ := json.Marshal(matching.ProviderIDs(ids))
+	return string(data)
+}
+
+// getChangeTimestamps returns the date the item has been watched and the initial timestamps of the changes of its
+// played and favorite state.
+func getChangeTimestamps(userData jellyfin.UserData) (watchedDate, playedChanged, favoriteChanged int64) {
+	if !userData.LastPlayedDate.IsZero() {
+		watchedDate = userData.LastPlayedDate.Unix()
+	}
+
+	if userData.Played {
+		playedChanged = watchedDate
+	}
+
+	if userData.IsFavorite {
+		favoriteChanged = time.Now().Unix()
+	}
+
+	return watchedDate, playedChanged, favoriteChanged
+}
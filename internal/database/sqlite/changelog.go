@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+const (
+	FieldWatchedDate     = "watched_date"
+	FieldPositionTicks   = "position"
+	FieldPlayed          = "played"
+	FieldFavorite        = "favorite"
+	defaultChangelogSize = 100
+)
+
+// ChangelogFilter restricts the changelog entries to return. Empty fields are not used for filtering.
+type ChangelogFilter struct {
+	Server string
+	User   string
+	// RunID is the ID of the sync run that has written the entries
+	RunID string
+	// FromID and ToID restrict the IDs of the entries, both are inclusive
+	FromID int64
+	ToID   int64
+	// Item is either the local ID of an item or a part of its name or its series' name
+	Item  string
+	Since time.Time
+	Until time.Time
+	// Field only returns entries that changed the given field compared to the previous values of the item, one of
+	// FieldWatchedDate, FieldPositionTicks, FieldPlayed or FieldFavorite
+	Field string
+	Limit int
+}
+
+// ChangelogEntry is an update of an item's UserData that has been sent to a server.
+type ChangelogEntry struct {
+	ID         int64     `json:"id"`
+	Date       time.Time `json:"date"`
+	Server     string    `json:"server"`
+	User       string    `json:"user"`
+	LocalID    string    `json:"local_id"`
+	Type       string    `json:"type,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	SeriesName string    `json:"series_name,omitempty"`
+
+	NewWatchedDate          int64   `json:"new_watched_date"`
+	NewWatchedProgress      float64 `json:"new_watched_progress"`
+	NewWatchedPositionTicks int64   `json:"new_watched_position_ticks"`
+	NewIsFavorite           bool    `json:"new_is_favorite"`
+	NewPlayed               bool    `json:"new_played"`
+
+	SourceServer                 string `json:"source_server,omitempty"`
+	SourceLocalID                string `json:"source_local_id,omitempty"`
+	PreviousWatchedDate          int64  `json:"previous_watched_date"`
+	PreviousWatchedPositionTicks int64  `json:"previous_watched_position_ticks"`
+	PreviousIsFavorite           bool   `json:"previous_is_favorite"`
+	PreviousPlayed               bool   `json:"previous_played"`
+
+	// Reason is empty for entries that have been written before the previous values have been recorded
+	Reason string `json:"reason,omitempty"`
+
+	RunID string `json:"run_id,omitempty"`
+	// Reverts is the ID of the entry that has been reverted by this entry
+	Reverts int64 `json:"reverts,omitempty"`
+	// RevertedBy is the ID of the newest entry that has reverted this entry
+	RevertedBy int64 `json:"reverted_by,omitempty"`
+}
+
+// HasPrevious returns true if the entry has recorded the values of the item before it has been updated.
+func (e ChangelogEntry) HasPrevious() bool {
+	return e.Reason != ""
+}
+
+// ChangedFields returns the fields that have been changed compared to the previous values of the item. If the
+// previous values are unknown, all fields are considered to be changed.
+func (e ChangelogEntry) ChangedFields() []string {
+	var ret []string
+	if !e.HasPrevious() || e.NewWatchedDate != e.PreviousWatchedDate {
+		ret = append(ret, FieldWatchedDate)
+	}
+	if !e.HasPrevious() || e.NewWatchedPositionTicks != e.PreviousWatchedPositionTicks {
+		ret = append(ret, FieldPositionTicks)
+	}
+	if !e.HasPrevious() || e.NewPlayed != e.PreviousPlayed {
+		ret = append(ret, FieldPlayed)
+	}
+	if !e.HasPrevious() || e.NewIsFavorite != e.PreviousIsFavorite {
+		ret = append(ret, FieldFavorite)
+	}
+	return ret
+}
+
+func (q *SQLiteJellyDb) GetChangelog(ctx context.Context, filter ChangelogFilter) ([]ChangelogEntry, error) {
+	until := int64(math.MaxInt64)
+	if !filter.Until.IsZero() {
+		until = filter.Until.Unix()
+	}
+
+	var since int64
+	if !filter.Since.IsZero() {
+		since = filter.Since.Unix()
+	}
+
+	toId := int64(math.MaxInt64)
+	if filter.ToID > 0 {
+		toId = filter.ToID
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultChangelogSize
+	}
+
+	start := time.Now()
+	rows, err := q.generated.GetChangelog(ctx, generated.GetChangelogParams{
+		Server: filter.Server,
+		User:   filter.User,
+		RunID:  filter.RunID,
+		FromID: filter.FromID,
+		ToID:   toId,
+		Item:   filter.Item,
+		Field:  filter.Field,
+		Since:  since,
+		Until:  until,
+		Limit:  int64(limit),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetChangelog").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetChangelog").Observe(time.Since(start).Seconds())
+
+	ret := make([]ChangelogEntry, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ChangelogEntry{
+			ID:                           row.ID,
+			Date:                         time.Unix(row.Date, 0),
+			Server:                       row.Server,
+			User:                         row.User,
+			LocalID:                      row.LocalID,
+			Type:                         row.Type,
+			Name:                         row.Name,
+			SeriesName:                   row.SeriesName,
+			NewWatchedDate:               row.NewWatchedDate,
+			NewWatchedProgress:           row.NewWatchedProgress,
+			NewWatchedPositionTicks:      row.NewWatchedPositionTicks,
+			NewIsFavorite:                row.NewIsFavorite,
+			NewPlayed:                    row.NewPlayed,
+			SourceServer:                 row.SourceServer,
+			SourceLocalID:                row.SourceLocalID,
+			PreviousWatchedDate:          row.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: row.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           row.PreviousIsFavorite,
+			PreviousPlayed:               row.PreviousPlayed,
+			Reason:                       row.Reason,
+			RunID:                        row.RunID,
+			Reverts:                      row.Reverts,
+			RevertedBy:                   row.RevertedBy,
+		}
+	}
+
+	return ret, nil
+}
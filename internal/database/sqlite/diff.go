@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+const (
+	DiffMissing        = "missing"
+	DiffWatchedState   = "watched_state"
+	DiffResumePosition = "resume_position"
+	DiffFavorite       = "favorite"
+)
+
+// ItemState is the cached UserData of an item on a single server.
+type ItemState struct {
+	LocalID              string `json:"local_id"`
+	WatchedDate          int64  `json:"watched_date"`
+	WatchedPositionTicks int64  `json:"watched_position_ticks"`
+	Played               bool   `json:"played"`
+	IsFavorite           bool   `json:"is_favorite"`
+}
+
+// IsMissing returns true if the item does not exist on the server.
+func (s ItemState) IsMissing() bool {
+	return s.LocalID == ""
+}
+
+// ItemDiff holds the cached UserData of the same item on two servers.
+type ItemDiff struct {
+	MatchKey   string    `json:"match_key"`
+	Name       string    `json:"name"`
+	SeriesName string    `json:"series_name,omitempty"`
+	A          ItemState `json:"a"`
+	B          ItemState `json:"b"`
+}
+
+// Differences returns the kinds of differences between both servers. An item that is missing on one of the servers
+// has no other differences.
+func (d ItemDiff) Differences() []string {
+	if d.A.IsMissing() || d.B.IsMissing() {
+		return []string{DiffMissing}
+	}
+
+	var ret []string
+	if d.A.Played != d.B.Played {
+		ret = append(ret, DiffWatchedState)
+	}
+	if d.A.WatchedPositionTicks != d.B.WatchedPositionTicks {
+		ret = append(ret, DiffResumePosition)
+	}
+	if d.A.IsFavorite != d.B.IsFavorite {
+		ret = append(ret, DiffFavorite)
+	}
+	return ret
+}
+
+func (q *SQLiteJellyDb) GetMoviesDiff(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error) {
+	start := time.Now()
+	rows, err := q.generated.GetMovieDiff(ctx, generated.GetMovieDiffParams{
+		User:    user,
+		ServerA: serverA,
+		ServerB: serverB,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMovieDiff").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMovieDiff").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemDiff, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemDiff{
+			MatchKey: row.MatchKey,
+			Name:     row.Name,
+			A: ItemState{
+				LocalID:              row.ALocalID,
+				WatchedDate:          row.AWatchedDate,
+				WatchedPositionTicks: row.AWatchedPositionTicks,
+				Played:               row.APlayed,
+				IsFavorite:           row.AIsFavorite,
+			},
+			B: ItemState{
+				LocalID:              row.BLocalID,
+				WatchedDate:          row.BWatchedDate,
+				WatchedPositionTicks: row.BWatchedPositionTicks,
+				Played:               row.BPlayed,
+				IsFavorite:           row.BIsFavorite,
+			},
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetEpisodesDiff(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error) {
+	start := time.Now()
+	rows, err := q.generated.GetEpisodeDiff(ctx, generated.GetEpisodeDiffParams{
+		User:    user,
+		ServerA: serverA,
+		ServerB: serverB,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetEpisodeDiff").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetEpisodeDiff").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemDiff, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemDiff{
+			MatchKey:   row.MatchKey,
+			Name:       row.Name,
+			SeriesName: row.SeriesName,
+			A: ItemState{
+				LocalID:              row.ALocalID,
+				WatchedDate:          row.AWatchedDate,
+				WatchedPositionTicks: row.AWatchedPositionTicks,
+				Played:               row.APlayed,
+				IsFavorite:           row.AIsFavorite,
+			},
+			B: ItemState{
+				LocalID:              row.BLocalID,
+				WatchedDate:          row.BWatchedDate,
+				WatchedPositionTicks: row.BWatchedPositionTicks,
+				Played:               row.BPlayed,
+				IsFavorite:           row.BIsFavorite,
+			},
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioDiff(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error) {
+	start := time.Now()
+	rows, err := q.generated.GetAudioDiff(ctx, generated.GetAudioDiffParams{
+		User:    user,
+		ServerA: serverA,
+		ServerB: serverB,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioDiff").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioDiff").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemDiff, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemDiff{
+			MatchKey: row.MatchKey,
+			Name:     row.Name,
+			A: ItemState{
+				LocalID:              row.ALocalID,
+				WatchedDate:          row.AWatchedDate,
+				WatchedPositionTicks: row.AWatchedPositionTicks,
+				Played:               row.APlayed,
+				IsFavorite:           row.AIsFavorite,
+			},
+			B: ItemState{
+				LocalID:              row.BLocalID,
+				WatchedDate:          row.BWatchedDate,
+				WatchedPositionTicks: row.BWatchedPositionTicks,
+				Played:               row.BPlayed,
+				IsFavorite:           row.BIsFavorite,
+			},
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioBooksDiff(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error) {
+	start := time.Now()
+	rows, err := q.generated.GetAudioBookDiff(ctx, generated.GetAudioBookDiffParams{
+		User:    user,
+		ServerA: serverA,
+		ServerB: serverB,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioBookDiff").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioBookDiff").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemDiff, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemDiff{
+			MatchKey: row.MatchKey,
+			Name:     row.Name,
+			A: ItemState{
+				LocalID:              row.ALocalID,
+				WatchedDate:          row.AWatchedDate,
+				WatchedPositionTicks: row.AWatchedPositionTicks,
+				Played:               row.APlayed,
+				IsFavorite:           row.AIsFavorite,
+			},
+			B: ItemState{
+				LocalID:              row.BLocalID,
+				WatchedDate:          row.BWatchedDate,
+				WatchedPositionTicks: row.BWatchedPositionTicks,
+				Played:               row.BPlayed,
+				IsFavorite:           row.BIsFavorite,
+			},
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetMusicVideosDiff(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error) {
+	start := time.Now()
+	rows, err := q.generated.GetMusicVideoDiff(ctx, generated.GetMusicVideoDiffParams{
+		User:    user,
+		ServerA: serverA,
+		ServerB: serverB,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMusicVideoDiff").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMusicVideoDiff").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemDiff, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemDiff{
+			MatchKey: row.MatchKey,
+			Name:     row.Name,
+			A: ItemState{
+				LocalID:              row.ALocalID,
+				WatchedDate:          row.AWatchedDate,
+				WatchedPositionTicks: row.AWatchedPositionTicks,
+				Played:               row.APlayed,
+				IsFavorite:           row.AIsFavorite,
+			},
+			B: ItemState{
+				LocalID:              row.BLocalID,
+				WatchedDate:          row.BWatchedDate,
+				WatchedPositionTicks: row.BWatchedPositionTicks,
+				Played:               row.BPlayed,
+				IsFavorite:           row.BIsFavorite,
+			},
+		}
+	}
+
+	return ret, nil
+}
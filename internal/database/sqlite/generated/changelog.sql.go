@@ -9,15 +9,183 @@ import (
 	"context"
 )
 
+const GetChangelog = `-- name: GetChangelog :many
+SELECT
+    CAST(e.id AS INTEGER) as id,
+    CAST(e.date AS INTEGER) as date,
+    CAST(e.server AS TEXT) as server,
+    CAST(e.user AS TEXT) as user,
+    CAST(e.local_id AS TEXT) as local_id,
+    -- The changelog does not know the type of an item, so it's looked up in the cached items
+    CAST(CASE
+        WHEN m.local_id IS NOT NULL THEN 'Movie'
+        WHEN ep.local_id IS NOT NULL THEN 'Episode'
+        WHEN a.local_id IS NOT NULL THEN 'Audio'
+        WHEN ab.local_id IS NOT NULL THEN 'AudioBook'
+        WHEN mv.local_id IS NOT NULL THEN 'MusicVideo'
+        ELSE ''
+    END AS TEXT) as type,
+    CAST(COALESCE(m.name, ep.name, a.name, ab.name, mv.name, '') AS TEXT) as name,
+    CAST(COALESCE(ep.series_name, '') AS TEXT) as series_name,
+    CAST(e.new_watched_date AS INTEGER) as new_watched_date,
+    CAST(e.new_watched_progress AS REAL) as new_watched_progress,
+    CAST(e.new_watched_position_ticks AS INTEGER) as new_watched_position_ticks,
+    CAST(e.new_is_favorite AS BOOL) as new_is_favorite,
+    CAST(e.new_played AS BOOL) as new_played,
+    CAST(e.source_server AS TEXT) as source_server,
+    CAST(e.source_local_id AS TEXT) as source_local_id,
+    CAST(e.previous_watched_date AS INTEGER) as previous_watched_date,
+    CAST(e.previous_watched_position_ticks AS INTEGER) as previous_watched_position_ticks,
+    CAST(e.previous_is_favorite AS BOOL) as previous_is_favorite,
+    CAST(e.previous_played AS BOOL) as previous_played,
+    CAST(e.reason AS TEXT) as reason,
+    CAST(e.run_id AS TEXT) as run_id,
+    CAST(e.reverts AS INTEGER) as reverts,
+    -- The ID of the newest entry that has reverted this entry
+    CAST(COALESCE((SELECT MAX(r.id) FROM changelog r WHERE r.reverts = e.id), 0) AS INTEGER) as reverted_by
+FROM changelog e
+         LEFT JOIN movies m ON m.server = e.server AND m.user = e.user AND m.local_id = e.local_id
+         LEFT JOIN episodes ep ON ep.server = e.server AND ep.user = e.user AND ep.local_id = e.local_id
+         LEFT JOIN audio a ON a.server = e.server AND a.user = e.user AND a.local_id = e.local_id
+         LEFT JOIN audiobooks ab ON ab.server = e.server AND ab.user = e.user AND ab.local_id = e.local_id
+         LEFT JOIN music_videos mv ON mv.server = e.server AND mv.user = e.user AND mv.local_id = e.local_id
+WHERE (?1 = '' OR e.server = ?1)
+  AND (?2 = '' OR e.user = ?2)
+  AND (?3 = '' OR e.run_id = ?3)
+  AND e.id >= ?4
+  AND e.id <= ?5
+  AND (?6 = '' OR e.local_id = ?6 OR COALESCE(m.name, ep.name, a.name, ab.name, mv.name) LIKE '%' || ?6 || '%' OR ep.series_name LIKE '%' || ?6 || '%')
+  AND (?7 = ''
+    -- entries without a reason have been written before previous values have been recorded
+    OR e.reason = ''
+    OR (?7 = 'watched_date' AND e.new_watched_date != e.previous_watched_date)
+    OR (?7 = 'position' AND e.new_watched_position_ticks != e.previous_watched_position_ticks)
+    OR (?7 = 'played' AND e.new_played != e.previous_played)
+    OR (?7 = 'favorite' AND e.new_is_favorite != e.previous_is_favorite))
+  AND e.date >= ?8
+  AND e.date <= ?9
+ORDER BY e.id DESC
+LIMIT ?10
+`
+
+type GetChangelogParams struct {
+	Server string
+	User   string
+	RunID  string
+	FromID int64
+	ToID   int64
+	Item   string
+	Field  string
+	Since  int64
+	Until  int64
+	Limit  int64
+}
+
+type GetChangelogRow struct {
+	ID                           int64
+	Date                         int64
+	Server                       string
+	User                         string
+	LocalID                      string
+	Type                         string
+	Name                         string
+	SeriesName                   string
+	NewWatchedDate               int64
+	NewWatchedProgress           float64
+	NewWatchedPositionTicks      int64
+	NewIsFavorite                bool
+	NewPlayed                    bool
+	SourceServer                 string
+	SourceLocalID                string
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
+	Reason                       string
+	RunID                        string
+	Reverts                      int64
+	RevertedBy                   int64
+}
+
+// Get changelog entries, newest first
+func (q *Queries) GetChangelog(ctx context.Context, arg GetChangelogParams) ([]GetChangelogRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetChangelog,
+		arg.Server,
+		arg.User,
+		arg.RunID,
+		arg.FromID,
+		arg.ToID,
+		arg.Item,
+		arg.Field,
+		arg.Since,
+		arg.Until,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChangelogRow
+	for rows.Next() {
+		var i GetChangelogRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Date,
+			&i.Server,
+			&i.User,
+			&i.LocalID,
+			&i.Type,
+			&i.Name,
+			&i.SeriesName,
+			&i.NewWatchedDate,
+			&i.NewWatchedProgress,
+			&i.NewWatchedPositionTicks,
+			&i.NewIsFavorite,
+			&i.NewPlayed,
+			&i.SourceServer,
+			&i.SourceLocalID,
+			&i.PreviousWatchedDate,
+			&i.PreviousWatchedPositionTicks,
+			&i.PreviousIsFavorite,
+			&i.PreviousPlayed,
+			&i.Reason,
+			&i.RunID,
+			&i.Reverts,
+			&i.RevertedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const InsertChangelog = `-- name: InsertChangelog :exec
 INSERT INTO changelog (
 	server,
+	user,
 	local_id,
 	date,
 	new_watched_date,
 	new_watched_progress,
 	new_watched_position_ticks,
-	new_is_favorite
+	new_is_favorite,
+	new_played,
+	source_server,
+	source_local_id,
+	previous_watched_date,
+	previous_watched_position_ticks,
+	previous_is_favorite,
+	previous_played,
+	reason,
+	run_id,
+	reverts
 )
 VALUES (
 	?1,
@@ -26,29 +194,62 @@ VALUES (
 	?4,
 	?5,
 	?6,
-	?7
+	?7,
+	?8,
+	?9,
+	?10,
+	?11,
+	?12,
+	?13,
+	?14,
+	?15,
+	?16,
+	?17,
+	?18
 )
 `
 
 type InsertChangelogParams struct {
-	Server                  string
-	LocalID                 string
-	Date                    int64
-	NewWatchedDate          int64
-	NewWatchedProgress      float64
-	NewWatchedPositionTicks int64
-	NewIsFavorite           bool
+	Server                       string
+	User                         string
+	LocalID                      string
+	Date                         int64
+	NewWatchedDate               int64
+	NewWatchedProgress           float64
+	NewWatchedPositionTicks      int64
+	NewIsFavorite                bool
+	NewPlayed                    bool
+	SourceServer                 string
+	SourceLocalID                string
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
+	Reason                       string
+	RunID                        string
+	Reverts                      int64
 }
 
 func (q *Queries) InsertChangelog(ctx context.Context, arg InsertChangelogParams) error {
 	_, err := q.db.ExecContext(ctx, InsertChangelog,
 		arg.Server,
+		arg.User,
 		arg.LocalID,
 		arg.Date,
 		arg.NewWatchedDate,
 		arg.NewWatchedProgress,
 		arg.NewWatchedPositionTicks,
 		arg.NewIsFavorite,
+		arg.NewPlayed,
+		arg.SourceServer,
+		arg.SourceLocalID,
+		arg.PreviousWatchedDate,
+		arg.PreviousWatchedPositionTicks,
+		arg.PreviousIsFavorite,
+		arg.PreviousPlayed,
+		arg.Reason,
+		arg.RunID,
+		arg.Reverts,
 	)
 	return err
 }
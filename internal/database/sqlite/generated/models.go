@@ -4,52 +4,137 @@
 
 package generated
 
-import (
-	"database/sql"
-)
+type Audio struct {
+	ID                   int64
+	Server               string
+	User                 string
+	LocalID              string
+	Name                 string
+	Album                string
+	AlbumArtist          string
+	Runtime              int64
+	WatchedDate          int64
+	WatchedProgress      float64
+	WatchedPositionTicks int64
+	PlayCount            int64
+	IsFavorite           bool
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
+	LastSeen             int64
+	ProviderIds          string
+	MatchKey             string
+}
+
+type Audiobook struct {
+	ID                   int64
+	Server               string
+	User                 string
+	LocalID              string
+	Name                 string
+	Album                string
+	AlbumArtist          string
+	Runtime              int64
+	WatchedDate          int64
+	WatchedProgress      float64
+	WatchedPositionTicks int64
+	PlayCount            int64
+	IsFavorite           bool
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
+	LastSeen             int64
+	ProviderIds          string
+	MatchKey             string
+}
 
 type Changelog struct {
-	ID                      int64
-	Server                  string
-	LocalID                 string
-	Date                    int64
-	NewWatchedDate          int64
-	NewWatchedProgress      float64
-	NewWatchedPositionTicks int64
-	NewIsFavorite           bool
+	ID                           int64
+	Server                       string
+	LocalID                      string
+	Date                         int64
+	NewWatchedDate               int64
+	NewWatchedProgress           float64
+	NewWatchedPositionTicks      int64
+	NewIsFavorite                bool
+	User                         string
+	NewPlayed                    bool
+	SourceServer                 string
+	SourceLocalID                string
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
+	Reason                       string
+	RunID                        string
+	Reverts                      int64
 }
 
 type Episode struct {
 	ID                   int64
 	Server               string
+	User                 string
 	LocalID              string
 	Name                 string
 	SeriesName           string
 	SeasonName           string
-	ImdbID               sql.NullInt64
-	TmdbID               sql.NullInt64
-	TvdbID               sql.NullInt64
 	Runtime              int64
 	WatchedDate          int64
 	WatchedProgress      float64
 	WatchedPositionTicks int64
 	IsFavorite           bool
 	LastSeen             int64
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
+	PlayCount            int64
+	ProviderIds          string
+	MatchKey             string
+	SeasonNumber         int64
+	EpisodeNumber        int64
+	SeriesProviderIds    string
 }
 
 type Movie struct {
 	ID                   int64
 	Server               string
+	User                 string
+	LocalID              string
+	Name                 string
+	Runtime              int64
+	WatchedDate          int64
+	WatchedProgress      float64
+	WatchedPositionTicks int64
+	IsFavorite           bool
+	LastSeen             int64
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
+	PlayCount            int64
+	ProviderIds          string
+	MatchKey             string
+}
+
+type MusicVideo struct {
+	ID                   int64
+	Server               string
+	User                 string
 	LocalID              string
 	Name                 string
-	ImdbID               sql.NullInt64
-	TmdbID               sql.NullInt64
+	Album                string
+	Artist               string
 	Runtime              int64
 	WatchedDate          int64
 	WatchedProgress      float64
 	WatchedPositionTicks int64
+	PlayCount            int64
 	IsFavorite           bool
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
 	LastSeen             int64
+	ProviderIds          string
+	MatchKey             string
 }
 
 type SchemaVersion struct {
@@ -59,6 +144,8 @@ type SchemaVersion struct {
 type State struct {
 	ID       int64
 	Server   string
+	User     string
 	Type     string
 	LastSync int64
+	Stale    int64
 }
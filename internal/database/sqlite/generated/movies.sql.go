@@ -10,6 +10,179 @@ import (
 	"database/sql"
 )
 
+const GetMovieDiff = `-- name: GetMovieDiff :many
+WITH movie_groups AS (
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(name AS TEXT) as name,
+        CAST(runtime AS INTEGER) as runtime,
+        CAST(watched_date AS INTEGER) as watched_date,
+        CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(played AS BOOL) as played,
+        CAST(is_favorite AS BOOL) as is_favorite,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = ?1
+),
+     a AS (
+         SELECT * FROM movie_groups WHERE server = ?2
+     ),
+     b AS (
+         SELECT * FROM movie_groups WHERE server = ?3
+     ),
+     matched AS (
+         -- SQLite only supports FULL OUTER JOIN since 3.39, so it's emulated using two LEFT JOINs
+         SELECT a.match_key as match_key, a.local_id as a_local_id, b.local_id as b_local_id FROM a LEFT JOIN b ON a.match_key = b.match_key
+         UNION ALL
+         SELECT b.match_key as match_key, NULL as a_local_id, b.local_id as b_local_id FROM b LEFT JOIN a ON a.match_key = b.match_key WHERE a.match_key IS NULL
+     )
+SELECT
+    CAST(m.match_key AS TEXT) as match_key,
+    CAST(COALESCE(a.name, b.name) AS TEXT) as name,
+    CAST(COALESCE(a.local_id, '') AS TEXT) as a_local_id,
+    CAST(COALESCE(a.watched_date, 0) AS INTEGER) as a_watched_date,
+    CAST(COALESCE(a.watched_position_ticks, 0) AS INTEGER) as a_watched_position_ticks,
+    CAST(COALESCE(a.played, 0) AS BOOL) as a_played,
+    CAST(COALESCE(a.is_favorite, 0) AS BOOL) as a_is_favorite,
+    CAST(COALESCE(b.local_id, '') AS TEXT) as b_local_id,
+    CAST(COALESCE(b.watched_date, 0) AS INTEGER) as b_watched_date,
+    CAST(COALESCE(b.watched_position_ticks, 0) AS INTEGER) as b_watched_position_ticks,
+    CAST(COALESCE(b.played, 0) AS BOOL) as b_played,
+    CAST(COALESCE(b.is_favorite, 0) AS BOOL) as b_is_favorite
+FROM matched m
+         LEFT JOIN a ON a.local_id = m.a_local_id
+         LEFT JOIN b ON b.local_id = m.b_local_id
+ORDER BY 2
+`
+
+type GetMovieDiffParams struct {
+	User    string
+	ServerA string
+	ServerB string
+}
+
+type GetMovieDiffRow struct {
+	MatchKey              string
+	Name                  string
+	ALocalID              string
+	AWatchedDate          int64
+	AWatchedPositionTicks int64
+	APlayed               bool
+	AIsFavorite           bool
+	BLocalID              string
+	BWatchedDate          int64
+	BWatchedPositionTicks int64
+	BPlayed               bool
+	BIsFavorite           bool
+}
+
+// Get the cached UserData of movies on two servers side by side, matched by the same keys that are used for syncing
+func (q *Queries) GetMovieDiff(ctx context.Context, arg GetMovieDiffParams) ([]GetMovieDiffRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetMovieDiff, arg.User, arg.ServerA, arg.ServerB)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMovieDiffRow
+	for rows.Next() {
+		var i GetMovieDiffRow
+		if err := rows.Scan(
+			&i.MatchKey,
+			&i.Name,
+			&i.ALocalID,
+			&i.AWatchedDate,
+			&i.AWatchedPositionTicks,
+			&i.APlayed,
+			&i.AIsFavorite,
+			&i.BLocalID,
+			&i.BWatchedDate,
+			&i.BWatchedPositionTicks,
+			&i.BPlayed,
+			&i.BIsFavorite,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetMovieMatches = `-- name: GetMovieMatches :many
+WITH movie_groups AS (
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(provider_ids AS TEXT) as provider_ids,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = ?1
+)
+SELECT
+    CAST(server AS TEXT) as server,
+    CAST(local_id AS TEXT) as local_id,
+    CAST(match_key AS TEXT) as match_key
+FROM movie_groups
+WHERE match_key IN (
+    SELECT match_key
+    FROM movie_groups
+    WHERE (server = ?2 AND local_id = ?3) OR match_key = ?4
+       -- Items whose key has been derived by another strategy are found by their provider IDs
+       OR EXISTS (SELECT 1 FROM json_each(provider_ids) WHERE key || '_' || value = ?4)
+)
+ORDER BY server, local_id
+`
+
+type GetMovieMatchesParams struct {
+	User     string
+	Server   string
+	LocalID  string
+	MatchKey string
+}
+
+type GetMovieMatchesRow struct {
+	Server   string
+	LocalID  string
+	MatchKey string
+}
+
+// Get all movies that are identical to the specified item or that match the specified key, including the item itself
+func (q *Queries) GetMovieMatches(ctx context.Context, arg GetMovieMatchesParams) ([]GetMovieMatchesRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetMovieMatches,
+		arg.User,
+		arg.Server,
+		arg.LocalID,
+		arg.MatchKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMovieMatchesRow
+	for rows.Next() {
+		var i GetMovieMatchesRow
+		if err := rows.Scan(&i.Server, &i.LocalID, &i.MatchKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const GetMovieWithGreatestWatchedDate = `-- name: GetMovieWithGreatestWatchedDate :many
 WITH movie_groups AS (
     -- Step 1: Normalize all movie data and create matching keys
@@ -19,21 +192,35 @@ WITH movie_groups AS (
         CAST(server AS TEXT) as server,
         CAST(local_id AS TEXT) as local_id,
         CAST(name AS TEXT) as name,
-        CAST(imdb_id AS INTEGER) as imdb_id,
-        CAST(tmdb_id AS INTEGER) as tmdb_id,
         CAST(runtime AS INTEGER) as runtime,
         CAST(watched_date AS INTEGER) as watched_date,
         CAST(watched_progress AS REAL) as watched_progress,
         CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(play_count AS INTEGER) as play_count,
         CAST(is_favorite AS BOOL) as is_favorite,
-        -- Create a unique matching key to identify the same movie across different servers
-        -- Priority: IMDB ID > TMDB ID > Name+Runtime combination
-        CASE
-            WHEN imdb_id IS NOT NULL AND imdb_id != '' THEN CONCAT('imdb_', imdb_id)
-            WHEN tmdb_id IS NOT NULL AND tmdb_id != '' THEN CONCAT('tmdb_', tmdb_id)
-            ELSE CONCAT('name_', name, '_', CAST(runtime AS VARCHAR))
-            END as match_key
+        CAST(played AS BOOL) as played,
+        CAST(played_changed AS INTEGER) as played_changed,
+        -- The most recent change of either the playback or the played state
+        CAST(MAX(watched_date, played_changed) AS INTEGER) as last_changed,
+        -- The priority of the row according to the conflict policy. Rows with a higher priority win regardless of their
+        -- last change, rows with the same priority are resolved by their most recent change.
+        CAST(CASE ?1
+            WHEN 'played' THEN played
+            WHEN 'furthest_position' THEN CASE WHEN played THEN 9223372036854775807 ELSE watched_position_ticks END
+            WHEN 'max_play_count' THEN play_count
+            WHEN 'primary' THEN server = ?2 AND MAX(watched_date, played_changed) > 0
+            ELSE 0
+            END AS INTEGER) as priority,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
     FROM movies
+    WHERE user = ?3
+      -- Rows of stale servers are outdated and therefore never used as source, only the server itself may use them
+      AND (server = ?4 OR server NOT IN (
+          SELECT server FROM state WHERE user = ?3 AND type = 'Movie' AND stale > 0
+      ))
+      -- Only servers that may send updates to the server are used as source, an empty list allows all servers
+      AND (server = ?4 OR ?5 = '' OR server IN (SELECT value FROM json_each(?5)))
 ),
      local_movies AS (
          -- Step 2: Get watch status from the local server (the one we're syncing TO)
@@ -43,34 +230,33 @@ WITH movie_groups AS (
              local_id,
              name,
              watched_date as local_watched_date,
-             watched_progress as local_watched_progress
+             watched_progress as local_watched_progress,
+             watched_position_ticks as local_watched_position_ticks,
+             is_favorite as local_is_favorite,
+             played as local_played,
+             last_changed as local_last_changed,
+             priority as local_priority
          FROM movie_groups
-         WHERE server = ?1
+         WHERE server = ?4
      ),
-     max_remote_movies AS (
-         -- Step 3: Find the most recent watch date for each movie on remote servers
-         -- This identifies which remote server has the most up-to-date watch progress
-         SELECT
-             match_key,
-             MAX(watched_date) as max_remote_watched_date
-         FROM movie_groups
-         WHERE server != ?1
-    AND watched_date > 0  -- Only consider movies that have been watched
-GROUP BY match_key
-    ),
-    best_remote_movies AS (
+     best_remote_movies AS (
 SELECT DISTINCT
     eg.match_key,
-    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_local_id,
-    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_name,
-    FIRST_VALUE(eg.watched_date) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_watched_date,
-    FIRST_VALUE(eg.watched_progress) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_watched_progress,
-    FIRST_VALUE(eg.watched_position_ticks) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as watched_position_ticks,
-    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as is_favorite
+    FIRST_VALUE(eg.server) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_server,
+    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_local_id,
+    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_name,
+    FIRST_VALUE(eg.watched_date) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_watched_date,
+    FIRST_VALUE(eg.watched_progress) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_watched_progress,
+    FIRST_VALUE(eg.watched_position_ticks) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as watched_position_ticks,
+    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as is_favorite,
+    FIRST_VALUE(eg.play_count) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_play_count,
+    FIRST_VALUE(eg.runtime) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_runtime,
+    FIRST_VALUE(eg.played) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_played,
+    FIRST_VALUE(eg.last_changed) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_last_changed,
+    FIRST_VALUE(eg.priority) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_priority
 FROM movie_groups eg
-    INNER JOIN max_remote_movies mre ON eg.match_key = mre.match_key
-    AND eg.watched_date = mre.max_remote_watched_date
-WHERE eg.server != ?1
+WHERE eg.server != ?4
+  AND eg.last_changed > 0  -- Only consider movies that have been watched or whose played state has been changed
     )
 SELECT
     CAST(le.local_id AS TEXT) as local_id, -- ! Use local_id from local_episodes !
@@ -78,43 +264,219 @@ SELECT
     CAST(bre.remote_watched_date AS INTEGER) as watched_date,
     CAST(bre.remote_watched_progress AS REAL) as watched_progress,
     CAST(bre.watched_position_ticks AS INTEGER) as watched_position_ticks,
-    CAST(bre.is_favorite AS BOOL) as is_favorite
+    CAST(bre.is_favorite AS BOOL) as is_favorite,
+    CAST(bre.remote_played AS BOOL) as played,
+    CAST(bre.remote_runtime AS INTEGER) as runtime,
+    CAST(bre.remote_play_count AS INTEGER) as play_count,
+    CAST(bre.remote_server AS TEXT) as source_server,
+    CAST(bre.remote_local_id AS TEXT) as source_local_id,
+    CAST(le.local_watched_date AS INTEGER) as previous_watched_date,
+    CAST(le.local_watched_position_ticks AS INTEGER) as previous_watched_position_ticks,
+    CAST(le.local_is_favorite AS BOOL) as previous_is_favorite,
+    CAST(le.local_played AS BOOL) as previous_played
 FROM best_remote_movies bre
          INNER JOIN local_movies le ON bre.match_key = le.match_key
-WHERE bre.remote_watched_date > COALESCE(le.local_watched_date, 0)
-  AND bre.remote_watched_date > 0
+WHERE (bre.remote_priority > le.local_priority
+    AND (bre.remote_watched_date != le.local_watched_date
+        OR bre.remote_played != le.local_played
+        OR bre.watched_position_ticks != le.local_watched_position_ticks))
+   OR (bre.remote_priority = le.local_priority
+    AND bre.remote_last_changed > COALESCE(le.local_last_changed, 0)
+    AND (bre.remote_watched_date > COALESCE(le.local_watched_date, 0) OR bre.remote_played != le.local_played))
 `
 
+type GetMovieWithGreatestWatchedDateParams struct {
+	Policy        string
+	PrimaryServer string
+	User          string
+	Server        string
+	Sources       string
+}
+
 type GetMovieWithGreatestWatchedDateRow struct {
+	LocalID                      string
+	Name                         string
+	WatchedDate                  int64
+	WatchedProgress              float64
+	WatchedPositionTicks         int64
+	IsFavorite                   bool
+	Played                       bool
+	Runtime                      int64
+	PlayCount                    int64
+	SourceServer                 string
+	SourceLocalID                string
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
+}
+
+// Get movies with greatest watched_date among identical movies, excluding specified server
+// Step 3: Get the complete record of the winning movie on remote servers, which is the one with the highest priority
+// according to the conflict policy and the most recent change among those
+// Using window functions to get all details from the "winning" remote server
+// Step 4: Final result - Return movies that need their watch status updated
+// A remote movie with a higher priority than the local one wins as long as its state differs. Otherwise, only return
+// movies where the remote change is newer than the local change and either the remote watch progress is newer than the
+// local watch progress or the played state differs
+func (q *Queries) GetMovieWithGreatestWatchedDate(ctx context.Context, arg GetMovieWithGreatestWatchedDateParams) ([]GetMovieWithGreatestWatchedDateRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetMovieWithGreatestWatchedDate,
+		arg.Policy,
+		arg.PrimaryServer,
+		arg.User,
+		arg.Server,
+		arg.Sources,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMovieWithGreatestWatchedDateRow
+	for rows.Next() {
+		var i GetMovieWithGreatestWatchedDateRow
+		if err := rows.Scan(
+			&i.LocalID,
+			&i.Name,
+			&i.WatchedDate,
+			&i.WatchedProgress,
+			&i.WatchedPositionTicks,
+			&i.IsFavorite,
+			&i.Played,
+			&i.Runtime,
+			&i.PlayCount,
+			&i.SourceServer,
+			&i.SourceLocalID,
+			&i.PreviousWatchedDate,
+			&i.PreviousWatchedPositionTicks,
+			&i.PreviousIsFavorite,
+			&i.PreviousPlayed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const GetMovieWithUpdatedFavorite = `-- name: GetMovieWithUpdatedFavorite :many
+WITH movie_groups AS (
+    -- Step 1: Normalize all movie data and create matching keys
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(name AS TEXT) as name,
+        CAST(runtime AS INTEGER) as runtime,
+        CAST(watched_date AS INTEGER) as watched_date,
+        CAST(watched_progress AS REAL) as watched_progress,
+        CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(played AS BOOL) as played,
+        CAST(is_favorite AS BOOL) as is_favorite,
+        CAST(favorite_changed AS INTEGER) as favorite_changed,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = ?1
+      -- Rows of stale servers are outdated and therefore never used as source, only the server itself may use them
+      AND (server = ?2 OR server NOT IN (
+          SELECT server FROM state WHERE user = ?1 AND type = 'Movie' AND stale > 0
+      ))
+      -- Only servers that may send updates to the server are used as source, an empty list allows all servers
+      AND (server = ?2 OR ?3 = '' OR server IN (SELECT value FROM json_each(?3)))
+),
+     local_movies AS (
+         -- Step 2: Get the favorite state from the local server (the one we're syncing TO)
+         SELECT
+             match_key,
+             local_id,
+             watched_date as local_watched_date,
+             watched_progress as local_watched_progress,
+             watched_position_ticks as local_watched_position_ticks,
+             played as local_played,
+             is_favorite as local_is_favorite,
+             favorite_changed as local_favorite_changed
+         FROM movie_groups
+         WHERE server = ?2
+     ),
+     best_remote_movies AS (
+SELECT DISTINCT
+    eg.match_key,
+    FIRST_VALUE(eg.server) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_server,
+    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_local_id,
+    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_name,
+    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_is_favorite,
+    FIRST_VALUE(eg.favorite_changed) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_favorite_changed
+FROM movie_groups eg
+WHERE eg.server != ?2
+  AND eg.favorite_changed > 0
+    )
+SELECT
+    CAST(le.local_id AS TEXT) as local_id,
+    CAST(bre.remote_name AS TEXT) as name,
+    CAST(le.local_watched_date AS INTEGER) as watched_date,
+    CAST(le.local_watched_progress AS REAL) as watched_progress,
+    CAST(le.local_watched_position_ticks AS INTEGER) as watched_position_ticks,
+    CAST(le.local_played AS BOOL) as played,
+    CAST(bre.remote_is_favorite AS BOOL) as is_favorite,
+    CAST(bre.remote_favorite_changed AS INTEGER) as favorite_changed,
+    CAST(bre.remote_server AS TEXT) as source_server,
+    CAST(bre.remote_local_id AS TEXT) as source_local_id,
+    CAST(le.local_is_favorite AS BOOL) as previous_is_favorite
+FROM best_remote_movies bre
+         INNER JOIN local_movies le ON bre.match_key = le.match_key
+WHERE bre.remote_is_favorite != le.local_is_favorite
+  AND bre.remote_favorite_changed > le.local_favorite_changed
+`
+
+type GetMovieWithUpdatedFavoriteParams struct {
+	User    string
+	Server  string
+	Sources string
+}
+
+type GetMovieWithUpdatedFavoriteRow struct {
 	LocalID              string
 	Name                 string
 	WatchedDate          int64
 	WatchedProgress      float64
 	WatchedPositionTicks int64
+	Played               bool
 	IsFavorite           bool
+	FavoriteChanged      int64
+	SourceServer         string
+	SourceLocalID        string
+	PreviousIsFavorite   bool
 }
 
-// Get movies with greatest watched_date among identical movies, excluding specified server
-// Step 4: Get the complete record for the movie with the highest watch date on remote servers
-// Using window functions to get all details from the "winning" remote server
-// Step 5: Final result - Return movies that need their watch status updated
-// Only return movies where remote watch progress is newer than local watch progress
-func (q *Queries) GetMovieWithGreatestWatchedDate(ctx context.Context, server string) ([]GetMovieWithGreatestWatchedDateRow, error) {
-	rows, err := q.db.QueryContext(ctx, GetMovieWithGreatestWatchedDate, server)
+// Get movies whose favorite state has been changed more recently on another server than on the specified server
+// Step 3: Get the record with the most recent change of the favorite state on remote servers
+// Step 4: Final result - Return movies where the remote favorite state differs and is newer than the local one
+func (q *Queries) GetMovieWithUpdatedFavorite(ctx context.Context, arg GetMovieWithUpdatedFavoriteParams) ([]GetMovieWithUpdatedFavoriteRow, error) {
+	rows, err := q.db.QueryContext(ctx, GetMovieWithUpdatedFavorite, arg.User, arg.Server, arg.Sources)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetMovieWithGreatestWatchedDateRow
+	var items []GetMovieWithUpdatedFavoriteRow
 	for rows.Next() {
-		var i GetMovieWithGreatestWatchedDateRow
+		var i GetMovieWithUpdatedFavoriteRow
 		if err := rows.Scan(
 			&i.LocalID,
 			&i.Name,
 			&i.WatchedDate,
 			&i.WatchedProgress,
 			&i.WatchedPositionTicks,
+			&i.Played,
 			&i.IsFavorite,
+			&i.FavoriteChanged,
+			&i.SourceServer,
+			&i.SourceLocalID,
+			&i.PreviousIsFavorite,
 		); err != nil {
 			return nil, err
 		}
@@ -133,15 +495,20 @@ const InsertMovie = `-- name: InsertMovie :exec
 INSERT INTO
     movies (
         server,
+        user,
         name,
         local_id,
-        imdb_id,
-        tmdb_id,
+        provider_ids,
+        match_key,
         runtime,
         watched_date,
         watched_progress,
         watched_position_ticks,
+        play_count,
         is_favorite,
+        played,
+        played_changed,
+        favorite_changed,
         last_seen
     )
 VALUES (
@@ -155,45 +522,73 @@ VALUES (
         ?8,
         ?9,
         ?10,
+        ?11,
+        ?12,
+        ?13,
+        ?14,
+        ?15,
         strftime('%s', 'now')
 )
-ON CONFLICT(server, local_id) DO UPDATE SET
+ON CONFLICT(server, user, local_id) DO UPDATE SET
         name = excluded.name,
-        imdb_id = excluded.imdb_id,
-        tmdb_id = excluded.tmdb_id,
+        provider_ids = excluded.provider_ids,
+        match_key = excluded.match_key,
         runtime = excluded.runtime,
         watched_date = excluded.watched_date,
         watched_progress  = excluded.watched_progress,
         watched_position_ticks  = excluded.watched_position_ticks,
+        play_count = excluded.play_count,
         is_favorite = excluded.is_favorite,
+        played = excluded.played,
+        -- Jellyfin does not keep track of when an item has been marked as (un)played, so a transition to played is
+        -- dated by its watched_date while a transition to unplayed is dated by the time it has been noticed.
+        played_changed = CASE
+            WHEN movies.played = excluded.played THEN movies.played_changed
+            WHEN excluded.played AND excluded.watched_date > 0 THEN excluded.watched_date
+            ELSE strftime('%s', 'now')
+        END,
+        favorite_changed = CASE
+            WHEN movies.is_favorite = excluded.is_favorite THEN movies.favorite_changed
+            ELSE strftime('%s', 'now')
+        END,
         last_seen = strftime('%s', 'now')
 `
 
 type InsertMovieParams struct {
 	Server               string
+	User                 string
 	Name                 string
 	LocalID              string
-	ImdbID               sql.NullInt64
-	TmdbID               sql.NullInt64
+	ProviderIds          string
+	MatchKey             string
 	Runtime              int64
 	WatchedDate          int64
 	WatchedProgress      float64
 	WatchedPositionTicks int64
+	PlayCount            int64
 	IsFavorite           bool
+	Played               bool
+	PlayedChanged        int64
+	FavoriteChanged      int64
 }
 
 func (q *Queries) InsertMovie(ctx context.Context, arg InsertMovieParams) error {
 	_, err := q.db.ExecContext(ctx, InsertMovie,
 		arg.Server,
+		arg.User,
 		arg.Name,
 		arg.LocalID,
-		arg.ImdbID,
-		arg.TmdbID,
+		arg.ProviderIds,
+		arg.MatchKey,
 		arg.Runtime,
 		arg.WatchedDate,
 		arg.WatchedProgress,
 		arg.WatchedPositionTicks,
+		arg.PlayCount,
 		arg.IsFavorite,
+		arg.Played,
+		arg.PlayedChanged,
+		arg.FavoriteChanged,
 	)
 	return err
 }
@@ -204,15 +599,67 @@ DELETE FROM
 WHERE
     server = ?1
 AND
-    last_seen < ?2
+    user = ?2
+AND
+    last_seen < ?3
 `
 
 type RemoveMoviesNotSeenSinceParams struct {
 	Server string
+	User   string
 	Since  int64
 }
 
 func (q *Queries) RemoveMoviesNotSeenSince(ctx context.Context, arg RemoveMoviesNotSeenSinceParams) error {
-	_, err := q.db.ExecContext(ctx, RemoveMoviesNotSeenSince, arg.Server, arg.Since)
+	_, err := q.db.ExecContext(ctx, RemoveMoviesNotSeenSince, arg.Server, arg.User, arg.Since)
+	return err
+}
+
+const RevertMovieUserData = `-- name: RevertMovieUserData :exec
+UPDATE movies SET
+    watched_date = COALESCE(?4, watched_date),
+    watched_position_ticks = COALESCE(?5, watched_position_ticks),
+    is_favorite = COALESCE(?6, is_favorite),
+    played = COALESCE(?7, played),
+    played_changed = CASE
+        WHEN ?7 IS NULL OR played = ?7 THEN played_changed
+        WHEN ?7 THEN COALESCE(?4, watched_date)
+        ELSE 0
+    END,
+    favorite_changed = CASE
+        WHEN ?6 IS NULL OR is_favorite = ?6 THEN favorite_changed
+        ELSE 0
+    END
+WHERE
+    server = ?1
+AND
+    user = ?2
+AND
+    local_id = ?3
+`
+
+type RevertMovieUserDataParams struct {
+	Server               string
+	User                 string
+	LocalID              string
+	WatchedDate          sql.NullInt64
+	WatchedPositionTicks sql.NullInt64
+	IsFavorite           sql.NullBool
+	Played               sql.NullBool
+}
+
+// Restore the reverted UserData of a cached item, fields that are null are kept. The restored values must never be
+// propagated as the most recent change, so they are dated by their original timestamps: a transition to played by its
+// watched_date while all other transitions are considered to have never been changed.
+func (q *Queries) RevertMovieUserData(ctx context.Context, arg RevertMovieUserDataParams) error {
+	_, err := q.db.ExecContext(ctx, RevertMovieUserData,
+		arg.Server,
+		arg.User,
+		arg.LocalID,
+		arg.WatchedDate,
+		arg.WatchedPositionTicks,
+		arg.IsFavorite,
+		arg.Played,
+	)
 	return err
 }
@@ -9,49 +9,138 @@ import (
 	"context"
 )
 
+const ClearStale = `-- name: ClearStale :exec
+UPDATE state SET stale = 0
+WHERE
+    server = ?1 AND
+    user = ?2 AND
+    type = ?3
+`
+
+type ClearStaleParams struct {
+	Server string
+	User   string
+	Type   string
+}
+
+func (q *Queries) ClearStale(ctx context.Context, arg ClearStaleParams) error {
+	_, err := q.db.ExecContext(ctx, ClearStale, arg.Server, arg.User, arg.Type)
+	return err
+}
+
 const GetLastCheck = `-- name: GetLastCheck :one
 SELECT
     last_sync
 FROM state
 WHERE
     server = ?1 AND
-    type = ?2
+    user = ?2 AND
+    type = ?3
 `
 
 type GetLastCheckParams struct {
 	Server string
+	User   string
 	Type   string
 }
 
 func (q *Queries) GetLastCheck(ctx context.Context, arg GetLastCheckParams) (int64, error) {
-	row := q.db.QueryRowContext(ctx, GetLastCheck, arg.Server, arg.Type)
+	row := q.db.QueryRowContext(ctx, GetLastCheck, arg.Server, arg.User, arg.Type)
 	var last_sync int64
 	err := row.Scan(&last_sync)
 	return last_sync, err
 }
 
+const GetStale = `-- name: GetStale :one
+SELECT
+    stale
+FROM state
+WHERE
+    server = ?1 AND
+    user = ?2 AND
+    type = ?3
+`
+
+type GetStaleParams struct {
+	Server string
+	User   string
+	Type   string
+}
+
+func (q *Queries) GetStale(ctx context.Context, arg GetStaleParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, GetStale, arg.Server, arg.User, arg.Type)
+	var stale int64
+	err := row.Scan(&stale)
+	return stale, err
+}
+
+const MarkStale = `-- name: MarkStale :exec
+INSERT INTO state (
+    server,
+    user,
+    type,
+    last_sync,
+    stale
+)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?4
+)
+
+ON CONFLICT(server, user, type) DO UPDATE SET stale = CASE WHEN state.stale > 0 THEN state.stale ELSE excluded.stale END
+`
+
+type MarkStaleParams struct {
+	Server string
+	User   string
+	Type   string
+	Stale  int64
+}
+
+// Marks the server as stale, a server that is already stale keeps the time it has been marked as stale first
+func (q *Queries) MarkStale(ctx context.Context, arg MarkStaleParams) error {
+	_, err := q.db.ExecContext(ctx, MarkStale,
+		arg.Server,
+		arg.User,
+		arg.Type,
+		arg.Stale,
+	)
+	return err
+}
+
 const UpsertState = `-- name: UpsertState :exec
 INSERT INTO state (
     server,
+    user,
     type,
     last_sync
 )
 VALUES (
     ?1,
     ?2,
-    ?3
+    ?3,
+    ?4
 )
 
-ON CONFLICT(server, type) DO UPDATE SET last_sync = excluded.last_sync
+ON CONFLICT(server, user, type) DO UPDATE SET last_sync = excluded.last_sync
 `
 
 type UpsertStateParams struct {
 	Server   string
+	User     string
 	Type     string
 	LastSync int64
 }
 
 func (q *Queries) UpsertState(ctx context.Context, arg UpsertStateParams) error {
-	_, err := q.db.ExecContext(ctx, UpsertState, arg.Server, arg.Type, arg.LastSync)
+	_, err := q.db.ExecContext(ctx, UpsertState,
+		arg.Server,
+		arg.User,
+		arg.Type,
+		arg.LastSync,
+	)
 	return err
 }
@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+// itemTypeStore bundles the queries to cache and match the items of a single item type. Each item type is stored in a
+// table of its own and uses its own strategy to identify the same item across different servers.
+type itemTypeStore struct {
+	insert                 func(ctx context.Context, server, user string, items []jellyfin.Item) error
+	removeNotSeenSince     func(ctx context.Context, server, user string, since time.Time) error
+	getWithUpdatedUserData func(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error)
+	getWithUpdatedFavorite func(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error)
+	getDiff                func(ctx context.Context, user, serverA, serverB string) ([]ItemDiff, error)
+	getMatches             func(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error)
+	revertUserData         func(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error
+}
+
+func (q *SQLiteJellyDb) itemTypeStores() map[jellyfin.ItemType]itemTypeStore {
+	return map[jellyfin.ItemType]itemTypeStore{
+		jellyfin.ItemMovie: {
+			insert:                 q.InsertMovies,
+			removeNotSeenSince:     q.RemoveMoviesNotSeenSince,
+			getWithUpdatedUserData: q.GetMoviesWithUpdatedUserData,
+			getWithUpdatedFavorite: q.GetMoviesWithUpdatedFavorite,
+			getDiff:                q.GetMoviesDiff,
+			getMatches:             q.GetMoviesMatches,
+			revertUserData:         q.RevertMoviesUserData,
+		},
+		jellyfin.ItemEpisode: {
+			insert:                 q.InsertEpisodes,
+			removeNotSeenSince:     q.RemoveEpisodesNotSeenSince,
+			getWithUpdatedUserData: q.GetEpisodesWithUpdatedUserData,
+			getWithUpdatedFavorite: q.GetEpisodesWithUpdatedFavorite,
+			getDiff:                q.GetEpisodesDiff,
+			getMatches:             q.GetEpisodesMatches,
+			revertUserData:         q.RevertEpisodesUserData,
+		},
+		jellyfin.ItemAudio: {
+			insert:                 q.InsertAudio,
+			removeNotSeenSince:     q.RemoveAudioNotSeenSince,
+			getWithUpdatedUserData: q.GetAudioWithUpdatedUserData,
+			getWithUpdatedFavorite: q.GetAudioWithUpdatedFavorite,
+			getDiff:                q.GetAudioDiff,
+			getMatches:             q.GetAudioMatches,
+			revertUserData:         q.RevertAudioUserData,
+		},
+		jellyfin.ItemAudioBook: {
+			insert:                 q.InsertAudioBooks,
+			removeNotSeenSince:     q.RemoveAudioBooksNotSeenSince,
+			getWithUpdatedUserData: q.GetAudioBooksWithUpdatedUserData,
+			getWithUpdatedFavorite: q.GetAudioBooksWithUpdatedFavorite,
+			getDiff:                q.GetAudioBooksDiff,
+			getMatches:             q.GetAudioBooksMatches,
+			revertUserData:         q.RevertAudioBooksUserData,
+		},
+		jellyfin.ItemMusicVideo: {
+			insert:                 q.InsertMusicVideos,
+			removeNotSeenSince:     q.RemoveMusicVideosNotSeenSince,
+			getWithUpdatedUserData: q.GetMusicVideosWithUpdatedUserData,
+			getWithUpdatedFavorite: q.GetMusicVideosWithUpdatedFavorite,
+			getDiff:                q.GetMusicVideosDiff,
+			getMatches:             q.GetMusicVideosMatches,
+			revertUserData:         q.RevertMusicVideosUserData,
+		},
+	}
+}
+
+func (q *SQLiteJellyDb) getStore(itemType jellyfin.ItemType) (itemTypeStore, error) {
+	store, found := q.stores[itemType]
+	if !found {
+		return itemTypeStore{}, fmt.Errorf("unknown item type: %s", itemType)
+	}
+
+	return store, nil
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+// ItemMatch is a cached item that has been identified as the same item as another item.
+type ItemMatch struct {
+	Server   string
+	LocalID  string
+	MatchKey string
+}
+
+func (q *SQLiteJellyDb) GetMoviesMatches(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error) {
+	start := time.Now()
+	rows, err := q.generated.GetMovieMatches(ctx, generated.GetMovieMatchesParams{
+		User:     user,
+		Server:   server,
+		LocalID:  localID,
+		MatchKey: matchKey,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMovieMatches").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMovieMatches").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemMatch, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemMatch{
+			Server:   row.Server,
+			LocalID:  row.LocalID,
+			MatchKey: row.MatchKey,
+		}
+	}
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetEpisodesMatches(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error) {
+	start := time.Now()
+	rows, err := q.generated.GetEpisodeMatches(ctx, generated.GetEpisodeMatchesParams{
+		User:     user,
+		Server:   server,
+		LocalID:  localID,
+		MatchKey: matchKey,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetEpisodeMatches").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetEpisodeMatches").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemMatch, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemMatch{
+			Server:   row.Server,
+			LocalID:  row.LocalID,
+			MatchKey: row.MatchKey,
+		}
+	}
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioMatches(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error) {
+	start := time.Now()
+	rows, err := q.generated.GetAudioMatches(ctx, generated.GetAudioMatchesParams{
+		User:     user,
+		Server:   server,
+		LocalID:  localID,
+		MatchKey: matchKey,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioMatches").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioMatches").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemMatch, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemMatch{
+			Server:   row.Server,
+			LocalID:  row.LocalID,
+			MatchKey: row.MatchKey,
+		}
+	}
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetAudioBooksMatches(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error) {
+	start := time.Now()
+	rows, err := q.generated.GetAudioBookMatches(ctx, generated.GetAudioBookMatchesParams{
+		User:     user,
+		Server:   server,
+		LocalID:  localID,
+		MatchKey: matchKey,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetAudioBookMatches").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetAudioBookMatches").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemMatch, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemMatch{
+			Server:   row.Server,
+			LocalID:  row.LocalID,
+			MatchKey: row.MatchKey,
+		}
+	}
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetMusicVideosMatches(ctx context.Context, user, server, localID, matchKey string) ([]ItemMatch, error) {
+	start := time.Now()
+	rows, err := q.generated.GetMusicVideoMatches(ctx, generated.GetMusicVideoMatchesParams{
+		User:     user,
+		Server:   server,
+		LocalID:  localID,
+		MatchKey: matchKey,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMusicVideoMatches").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMusicVideoMatches").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemMatch, len(rows))
+	for idx, row := range rows {
+		ret[idx] = ItemMatch{
+			Server:   row.Server,
+			LocalID:  row.LocalID,
+			MatchKey: row.MatchKey,
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,70 @@
+-- movies, episodes and state only act as a cache of the Jellyfin servers' data and are repopulated by the next
+-- full sync, so they can be recreated instead of being migrated.
+DROP TABLE IF EXISTS movies;
+DROP TABLE IF EXISTS episodes;
+DROP TABLE IF EXISTS state;
+
+CREATE TABLE IF NOT EXISTS movies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server TEXT NOT NULL,
+    user TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    imdb_id INTEGER,
+    tmdb_id INTEGER,
+    runtime INTEGER NOT NULL,
+    watched_date INTEGER NOT NULL,
+    watched_progress FLOAT NOT NULL,
+    watched_position_ticks INTEGER NOT NULL,
+    is_favorite BOOL NOT NULL,
+    last_seen INTEGER NOT NULL,
+
+    UNIQUE (server, user, local_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_movies_server_user ON movies(server, user);
+CREATE INDEX IF NOT EXISTS idx_movies_server_watched_date ON movies(server, watched_date);
+CREATE INDEX IF NOT EXISTS idx_movies_imdb_id ON movies(imdb_id) WHERE imdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_movies_tmdb_id ON movies(tmdb_id) WHERE tmdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_movies_watched_date ON movies(watched_date);
+
+CREATE TABLE IF NOT EXISTS episodes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server TEXT NOT NULL,
+    user TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    series_name TEXT NOT NULL,
+    season_name TEXT NOT NULL,
+    imdb_id INTEGER,
+    tmdb_id INTEGER,
+    tvdb_id INTEGER,
+    runtime INTEGER NOT NULL,
+    watched_date INTEGER NOT NULL,
+    watched_progress REAL NOT NULL,
+    watched_position_ticks INTEGER NOT NULL,
+    is_favorite BOOL NOT NULL,
+    last_seen INTEGER NOT NULL,
+
+    UNIQUE (server, user, local_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_episodes_server_user ON episodes(server, user);
+CREATE INDEX IF NOT EXISTS idx_episodes_server_watched_date ON episodes(server, watched_date);
+CREATE INDEX IF NOT EXISTS idx_episodes_imdb_id ON episodes(imdb_id) WHERE imdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_episodes_tmdb_id ON episodes(tmdb_id) WHERE tmdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_episodes_tvdb_id ON episodes(tvdb_id) WHERE tvdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_episodes_watched_date ON episodes(watched_date);
+
+CREATE TABLE IF NOT EXISTS state (
+     id INTEGER PRIMARY KEY AUTOINCREMENT,
+     server TEXT NOT NULL,
+     user TEXT NOT NULL,
+     type TEXT NOT NULL,
+     last_sync INTEGER NOT NULL CHECK (last_sync > 0),
+
+     UNIQUE (server, user, type)
+);
+
+-- Changelog entries written before multi-user support belong to the single user that has been configured per server.
+ALTER TABLE changelog ADD COLUMN user TEXT NOT NULL DEFAULT 'default';
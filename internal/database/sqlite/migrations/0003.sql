@@ -0,0 +1,8 @@
+-- The played state of existing items is unknown and gets updated by the next sync.
+ALTER TABLE movies ADD COLUMN played BOOL NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN played_changed INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE episodes ADD COLUMN played BOOL NOT NULL DEFAULT 0;
+ALTER TABLE episodes ADD COLUMN played_changed INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE changelog ADD COLUMN new_played BOOL NOT NULL DEFAULT 1;
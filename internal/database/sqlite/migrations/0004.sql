@@ -0,0 +1,7 @@
+ALTER TABLE movies ADD COLUMN favorite_changed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE episodes ADD COLUMN favorite_changed INTEGER NOT NULL DEFAULT 0;
+
+-- Jellyfin does not keep track of when an item has been marked as favorite, so existing favorites are considered to be
+-- changed now to propagate them to all servers.
+UPDATE movies SET favorite_changed = strftime('%s', 'now') WHERE is_favorite;
+UPDATE episodes SET favorite_changed = strftime('%s', 'now') WHERE is_favorite;
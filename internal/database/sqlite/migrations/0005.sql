@@ -0,0 +1,82 @@
+ALTER TABLE movies ADD COLUMN play_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE episodes ADD COLUMN play_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS audio (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server TEXT NOT NULL,
+    user TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    album TEXT NOT NULL,
+    album_artist TEXT NOT NULL,
+    musicbrainz_track_id TEXT NOT NULL,
+    runtime INTEGER NOT NULL,
+    watched_date INTEGER NOT NULL,
+    watched_progress REAL NOT NULL,
+    watched_position_ticks INTEGER NOT NULL,
+    play_count INTEGER NOT NULL DEFAULT 0,
+    is_favorite BOOL NOT NULL,
+    played BOOL NOT NULL DEFAULT 0,
+    played_changed INTEGER NOT NULL DEFAULT 0,
+    favorite_changed INTEGER NOT NULL DEFAULT 0,
+    last_seen INTEGER NOT NULL,
+
+    UNIQUE (server, user, local_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audio_server_user ON audio(server, user);
+CREATE INDEX IF NOT EXISTS idx_audio_musicbrainz_track_id ON audio(musicbrainz_track_id) WHERE musicbrainz_track_id != '';
+
+CREATE TABLE IF NOT EXISTS audiobooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server TEXT NOT NULL,
+    user TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    album TEXT NOT NULL,
+    album_artist TEXT NOT NULL,
+    musicbrainz_track_id TEXT NOT NULL,
+    runtime INTEGER NOT NULL,
+    watched_date INTEGER NOT NULL,
+    watched_progress REAL NOT NULL,
+    watched_position_ticks INTEGER NOT NULL,
+    play_count INTEGER NOT NULL DEFAULT 0,
+    is_favorite BOOL NOT NULL,
+    played BOOL NOT NULL DEFAULT 0,
+    played_changed INTEGER NOT NULL DEFAULT 0,
+    favorite_changed INTEGER NOT NULL DEFAULT 0,
+    last_seen INTEGER NOT NULL,
+
+    UNIQUE (server, user, local_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audiobooks_server_user ON audiobooks(server, user);
+CREATE INDEX IF NOT EXISTS idx_audiobooks_musicbrainz_track_id ON audiobooks(musicbrainz_track_id) WHERE musicbrainz_track_id != '';
+
+CREATE TABLE IF NOT EXISTS music_videos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server TEXT NOT NULL,
+    user TEXT NOT NULL,
+    local_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    album TEXT NOT NULL,
+    artist TEXT NOT NULL,
+    imdb_id INTEGER,
+    musicbrainz_track_id TEXT NOT NULL,
+    runtime INTEGER NOT NULL,
+    watched_date INTEGER NOT NULL,
+    watched_progress REAL NOT NULL,
+    watched_position_ticks INTEGER NOT NULL,
+    play_count INTEGER NOT NULL DEFAULT 0,
+    is_favorite BOOL NOT NULL,
+    played BOOL NOT NULL DEFAULT 0,
+    played_changed INTEGER NOT NULL DEFAULT 0,
+    favorite_changed INTEGER NOT NULL DEFAULT 0,
+    last_seen INTEGER NOT NULL,
+
+    UNIQUE (server, user, local_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_music_videos_server_user ON music_videos(server, user);
+CREATE INDEX IF NOT EXISTS idx_music_videos_imdb_id ON music_videos(imdb_id) WHERE imdb_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_music_videos_musicbrainz_track_id ON music_videos(musicbrainz_track_id) WHERE musicbrainz_track_id != '';
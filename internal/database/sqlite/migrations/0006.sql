@@ -0,0 +1,8 @@
+ALTER TABLE changelog ADD COLUMN source_server TEXT NOT NULL DEFAULT '';
+ALTER TABLE changelog ADD COLUMN source_local_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE changelog ADD COLUMN previous_watched_date INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE changelog ADD COLUMN previous_watched_position_ticks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE changelog ADD COLUMN previous_is_favorite BOOL NOT NULL DEFAULT 0;
+ALTER TABLE changelog ADD COLUMN previous_played BOOL NOT NULL DEFAULT 0;
+-- Entries written before the reason has been recorded have an empty reason and no previous values.
+ALTER TABLE changelog ADD COLUMN reason TEXT NOT NULL DEFAULT '';
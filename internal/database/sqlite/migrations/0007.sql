@@ -0,0 +1,5 @@
+ALTER TABLE changelog ADD COLUMN run_id TEXT NOT NULL DEFAULT '';
+-- The ID of the changelog entry that has been reverted by this entry
+ALTER TABLE changelog ADD COLUMN reverts INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_changelog_run_id ON changelog(run_id);
@@ -0,0 +1,3 @@
+-- Servers that could not be reached are marked as stale. Their cached items are not used as source for other servers
+-- until a full fetch has refreshed them. Holds the time the server has been marked as stale, 0 if it is not stale.
+ALTER TABLE state ADD COLUMN stale INTEGER NOT NULL DEFAULT 0;
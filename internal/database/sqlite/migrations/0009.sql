@@ -0,0 +1,50 @@
+-- Provider IDs are stored as text to keep their prefixes and leading zeros, e.g. of IMDB IDs. The match key is derived
+-- by the configured match strategies when an item is inserted.
+DROP INDEX IF EXISTS idx_movies_imdb_id;
+DROP INDEX IF EXISTS idx_movies_tmdb_id;
+ALTER TABLE movies DROP COLUMN imdb_id;
+ALTER TABLE movies DROP COLUMN tmdb_id;
+ALTER TABLE movies ADD COLUMN provider_ids TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE movies ADD COLUMN match_key TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_episodes_imdb_id;
+DROP INDEX IF EXISTS idx_episodes_tmdb_id;
+DROP INDEX IF EXISTS idx_episodes_tvdb_id;
+ALTER TABLE episodes DROP COLUMN imdb_id;
+ALTER TABLE episodes DROP COLUMN tmdb_id;
+ALTER TABLE episodes DROP COLUMN tvdb_id;
+ALTER TABLE episodes ADD COLUMN provider_ids TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE episodes ADD COLUMN match_key TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_audio_musicbrainz_track_id;
+ALTER TABLE audio DROP COLUMN musicbrainz_track_id;
+ALTER TABLE audio ADD COLUMN provider_ids TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE audio ADD COLUMN match_key TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_audiobooks_musicbrainz_track_id;
+ALTER TABLE audiobooks DROP COLUMN musicbrainz_track_id;
+ALTER TABLE audiobooks ADD COLUMN provider_ids TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE audiobooks ADD COLUMN match_key TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_music_videos_imdb_id;
+DROP INDEX IF EXISTS idx_music_videos_musicbrainz_track_id;
+ALTER TABLE music_videos DROP COLUMN imdb_id;
+ALTER TABLE music_videos DROP COLUMN musicbrainz_track_id;
+ALTER TABLE music_videos ADD COLUMN provider_ids TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE music_videos ADD COLUMN match_key TEXT NOT NULL DEFAULT '';
+
+-- The IDs of existing items are unknown until they have been fetched again, so they get a key that does not match any
+-- other item and all items are fetched by the next sync. Stale servers fetch all items anyway, their rows are kept to
+-- not lose the stale flag. The time of the last sync can not be reset to 0 instead, as it is required to be positive.
+UPDATE movies SET match_key = 'unmatched_' || server || '_' || local_id;
+UPDATE episodes SET match_key = 'unmatched_' || server || '_' || local_id;
+UPDATE audio SET match_key = 'unmatched_' || server || '_' || local_id;
+UPDATE audiobooks SET match_key = 'unmatched_' || server || '_' || local_id;
+UPDATE music_videos SET match_key = 'unmatched_' || server || '_' || local_id;
+DELETE FROM state WHERE stale = 0;
+
+CREATE INDEX IF NOT EXISTS idx_movies_user_match_key ON movies(user, match_key);
+CREATE INDEX IF NOT EXISTS idx_episodes_user_match_key ON episodes(user, match_key);
+CREATE INDEX IF NOT EXISTS idx_audio_user_match_key ON audio(user, match_key);
+CREATE INDEX IF NOT EXISTS idx_audiobooks_user_match_key ON audiobooks(user, match_key);
+CREATE INDEX IF NOT EXISTS idx_music_videos_user_match_key ON music_videos(user, match_key);
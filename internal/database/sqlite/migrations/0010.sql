@@ -0,0 +1,10 @@
+-- The numbers of the season and the episode, -1 if they are unknown
+ALTER TABLE episodes ADD COLUMN season_number INTEGER NOT NULL DEFAULT -1;
+ALTER TABLE episodes ADD COLUMN episode_number INTEGER NOT NULL DEFAULT -1;
+ALTER TABLE episodes ADD COLUMN series_provider_ids TEXT NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_episodes_user_series_name ON episodes(user, series_name);
+
+-- Episodes are matched by the IDs of their series by default, which requires all episodes to be fetched again. Stale
+-- servers fetch all episodes anyway and keep their stale flag.
+DELETE FROM state WHERE type = 'Episode' AND stale = 0;
@@ -0,0 +1,2 @@
+-- Speeds up looking up whether a changelog entry has already been reverted
+CREATE INDEX IF NOT EXISTS idx_changelog_reverts ON changelog(reverts);
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
+)
+
+// WithConflictPolicy sets the policy that resolves conflicting UserData of the given item type. Item types without a
+// policy use the DefaultConflictPolicy.
+func WithConflictPolicy(itemType jellyfin.ItemType, policy ConflictPolicy) SQLiteJellyDbOpts {
+	return func(q *SQLiteJellyDb) error {
+		if _, found := q.stores[itemType]; !found {
+			return fmt.Errorf("unknown item type: %s", itemType)
+		}
+
+		q.policies[itemType] = policy
+		return nil
+	}
+}
+
+// WithReplicationSources restricts the servers each server receives updates from. Sources maps a server to the
+// servers it may receive updates from, servers that are not listed receive updates from all servers. A server that
+// is mapped to an empty list does not receive any updates.
+func WithReplicationSources(sources map[string][]string) SQLiteJellyDbOpts {
+	return func(q *SQLiteJellyDb) error {
+		q.sources = sources
+		return nil
+	}
+}
+
+// WithMatchPriority sets the strategies, in order of priority, that derive the key identifying the same item of the
+// given item type across servers. Item types without a priority use the default strategies of the item type.
+func WithMatchPriority(itemType jellyfin.ItemType, priority []string) SQLiteJellyDbOpts {
+	return func(q *SQLiteJellyDb) error {
+		if _, found := q.stores[itemType]; !found {
+			return fmt.Errorf("unknown item type: %s", itemType)
+		}
+
+		matcher, err := matching.NewMatcher(itemType, priority)
+		if err != nil {
+			return fmt.Errorf("invalid match priority for %s: %w", itemType, err)
+		}
+
+		q.matchers[itemType] = matcher
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConflictStrategy is the rule that decides which server's UserData wins if an item differs across servers.
+type ConflictStrategy string
+
+const (
+	// ConflictLatest lets the most recent change win
+	ConflictLatest ConflictStrategy = "latest"
+	// ConflictFurthestPosition lets the furthest playback position win, played items are considered furthest
+	ConflictFurthestPosition ConflictStrategy = "furthest_position"
+	// ConflictPlayed lets an item that has been played on any server win over unplayed items
+	ConflictPlayed ConflictStrategy = "played"
+	// ConflictPrimary lets the state of a designated primary server win over the state of all other servers
+	ConflictPrimary ConflictStrategy = "primary"
+	// ConflictMaxPlayCount lets the item with the highest play count win
+	ConflictMaxPlayCount ConflictStrategy = "max_play_count"
+)
+
+// ConflictPolicy decides which server's UserData is copied to the other servers. Items whose state is equal according
+// to the strategy, e.g. items with the same play count, fall back to the most recent change.
+type ConflictPolicy struct {
+	Strategy ConflictStrategy
+	// PrimaryServer is the authoritative server of ConflictPrimary. Its state only wins once the item has been played
+	// or its played state has been changed on the primary server.
+	PrimaryServer string
+}
+
+// DefaultConflictPolicy lets the most recent change win.
+var DefaultConflictPolicy = ConflictPolicy{Strategy: ConflictLatest}
+
+// ParseConflictPolicy parses the name of a strategy, an empty name returns the DefaultConflictPolicy.
+func ParseConflictPolicy(strategy, primaryServer string) (ConflictPolicy, error) {
+	switch ConflictStrategy(strategy) {
+	case "":
+		return DefaultConflictPolicy, nil
+	case ConflictLatest, ConflictFurthestPosition, ConflictPlayed, ConflictMaxPlayCount:
+		if primaryServer != "" {
+			return ConflictPolicy{}, fmt.Errorf("conflict policy %q does not support a primary server", strategy)
+		}
+		return ConflictPolicy{Strategy: ConflictStrategy(strategy)}, nil
+	case ConflictPrimary:
+		if primaryServer == "" {
+			return ConflictPolicy{}, errors.New("conflict policy \"primary\" requires a primary server")
+		}
+		return ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: primaryServer}, nil
+	default:
+		return ConflictPolicy{}, fmt.Errorf("unknown conflict policy %q", strategy)
+	}
+}
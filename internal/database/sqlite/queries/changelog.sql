@@ -1,19 +1,100 @@
 -- name: InsertChangelog :exec
 INSERT INTO changelog (
 	server,
+	user,
 	local_id,
 	date,
 	new_watched_date,
 	new_watched_progress,
 	new_watched_position_ticks,
-	new_is_favorite
+	new_is_favorite,
+	new_played,
+	source_server,
+	source_local_id,
+	previous_watched_date,
+	previous_watched_position_ticks,
+	previous_is_favorite,
+	previous_played,
+	reason,
+	run_id,
+	reverts
 )
 VALUES (
 	sqlc.arg(server),
+	sqlc.arg(user),
 	sqlc.arg(local_id),
 	sqlc.arg(date),
 	sqlc.arg(new_watched_date),
 	sqlc.arg(new_watched_progress),
 	sqlc.arg(new_watched_position_ticks),
-	sqlc.arg(new_is_favorite)
+	sqlc.arg(new_is_favorite),
+	sqlc.arg(new_played),
+	sqlc.arg(source_server),
+	sqlc.arg(source_local_id),
+	sqlc.arg(previous_watched_date),
+	sqlc.arg(previous_watched_position_ticks),
+	sqlc.arg(previous_is_favorite),
+	sqlc.arg(previous_played),
+	sqlc.arg(reason),
+	sqlc.arg(run_id),
+	sqlc.arg(reverts)
 )
+
+-- name: GetChangelog :many
+-- Get changelog entries, newest first
+SELECT
+    CAST(e.id AS INTEGER) as id,
+    CAST(e.date AS INTEGER) as date,
+    CAST(e.server AS TEXT) as server,
+    CAST(e.user AS TEXT) as user,
+    CAST(e.local_id AS TEXT) as local_id,
+    -- The changelog does not know the type of an item, so it's looked up in the cached items
+    CAST(CASE
+        WHEN m.local_id IS NOT NULL THEN 'Movie'
+        WHEN ep.local_id IS NOT NULL THEN 'Episode'
+        WHEN a.local_id IS NOT NULL THEN 'Audio'
+        WHEN ab.local_id IS NOT NULL THEN 'AudioBook'
+        WHEN mv.local_id IS NOT NULL THEN 'MusicVideo'
+        ELSE ''
+    END AS TEXT) as type,
+    CAST(COALESCE(m.name, ep.name, a.name, ab.name, mv.name, '') AS TEXT) as name,
+    CAST(COALESCE(ep.series_name, '') AS TEXT) as series_name,
+    CAST(e.new_watched_date AS INTEGER) as new_watched_date,
+    CAST(e.new_watched_progress AS REAL) as new_watched_progress,
+    CAST(e.new_watched_position_ticks AS INTEGER) as new_watched_position_ticks,
+    CAST(e.new_is_favorite AS BOOL) as new_is_favorite,
+    CAST(e.new_played AS BOOL) as new_played,
+    CAST(e.source_server AS TEXT) as source_server,
+    CAST(e.source_local_id AS TEXT) as source_local_id,
+    CAST(e.previous_watched_date AS INTEGER) as previous_watched_date,
+    CAST(e.previous_watched_position_ticks AS INTEGER) as previous_watched_position_ticks,
+    CAST(e.previous_is_favorite AS BOOL) as previous_is_favorite,
+    CAST(e.previous_played AS BOOL) as previous_played,
+    CAST(e.reason AS TEXT) as reason,
+    CAST(e.run_id AS TEXT) as run_id,
+    CAST(e.reverts AS INTEGER) as reverts,
+    -- The ID of the newest entry that has reverted this entry
+    CAST(COALESCE((SELECT MAX(r.id) FROM changelog r WHERE r.reverts = e.id), 0) AS INTEGER) as reverted_by
+FROM changelog e
+         LEFT JOIN movies m ON m.server = e.server AND m.user = e.user AND m.local_id = e.local_id
+         LEFT JOIN episodes ep ON ep.server = e.server AND ep.user = e.user AND ep.local_id = e.local_id
+         LEFT JOIN audio a ON a.server = e.server AND a.user = e.user AND a.local_id = e.local_id
+         LEFT JOIN audiobooks ab ON ab.server = e.server AND ab.user = e.user AND ab.local_id = e.local_id
+         LEFT JOIN music_videos mv ON mv.server = e.server AND mv.user = e.user AND mv.local_id = e.local_id
+WHERE (sqlc.arg(server) = '' OR e.server = sqlc.arg(server))
+  AND (sqlc.arg(user) = '' OR e.user = sqlc.arg(user))
+  AND (sqlc.arg(run_id) = '' OR e.run_id = sqlc.arg(run_id))
+  AND e.id >= sqlc.arg(from_id)
+  AND e.id <= sqlc.arg(to_id)
+  AND (sqlc.arg(item) = '' OR e.local_id = sqlc.arg(item) OR COALESCE(m.name, ep.name, a.name, ab.name, mv.name) LIKE '%' || sqlc.arg(item) || '%' OR ep.series_name LIKE '%' || sqlc.arg(item) || '%')
+  AND (sqlc.arg(field) = ''
+    -- entries without a reason have been written before previous values have been recorded
+    OR e.reason = ''
+    OR (sqlc.arg(field) = 'watched_date' AND e.new_watched_date != e.previous_watched_date)
+    OR (sqlc.arg(field) = 'position' AND e.new_watched_position_ticks != e.previous_watched_position_ticks)
+    OR (sqlc.arg(field) = 'played' AND e.new_played != e.previous_played)
+    OR (sqlc.arg(field) = 'favorite' AND e.new_is_favorite != e.previous_is_favorite))
+  AND e.date >= sqlc.arg(since)
+  AND e.date <= sqlc.arg(until)
+ORDER BY e.id DESC
+LIMIT sqlc.arg(limit);
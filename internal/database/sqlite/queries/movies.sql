@@ -8,21 +8,35 @@ WITH movie_groups AS (
         CAST(server AS TEXT) as server,
         CAST(local_id AS TEXT) as local_id,
         CAST(name AS TEXT) as name,
-        CAST(imdb_id AS INTEGER) as imdb_id,
-        CAST(tmdb_id AS INTEGER) as tmdb_id,
         CAST(runtime AS INTEGER) as runtime,
         CAST(watched_date AS INTEGER) as watched_date,
         CAST(watched_progress AS REAL) as watched_progress,
         CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(play_count AS INTEGER) as play_count,
         CAST(is_favorite AS BOOL) as is_favorite,
-        -- Create a unique matching key to identify the same movie across different servers
-        -- Priority: IMDB ID > TMDB ID > Name+Runtime combination
-        CASE
-            WHEN imdb_id IS NOT NULL AND imdb_id != '' THEN CONCAT('imdb_', imdb_id)
-            WHEN tmdb_id IS NOT NULL AND tmdb_id != '' THEN CONCAT('tmdb_', tmdb_id)
-            ELSE CONCAT('name_', name, '_', CAST(runtime AS VARCHAR))
-            END as match_key
+        CAST(played AS BOOL) as played,
+        CAST(played_changed AS INTEGER) as played_changed,
+        -- The most recent change of either the playback or the played state
+        CAST(MAX(watched_date, played_changed) AS INTEGER) as last_changed,
+        -- The priority of the row according to the conflict policy. Rows with a higher priority win regardless of their
+        -- last change, rows with the same priority are resolved by their most recent change.
+        CAST(CASE sqlc.arg(policy)
+            WHEN 'played' THEN played
+            WHEN 'furthest_position' THEN CASE WHEN played THEN 9223372036854775807 ELSE watched_position_ticks END
+            WHEN 'max_play_count' THEN play_count
+            WHEN 'primary' THEN server = sqlc.arg(primary_server) AND MAX(watched_date, played_changed) > 0
+            ELSE 0
+            END AS INTEGER) as priority,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
     FROM movies
+    WHERE user = sqlc.arg(user)
+      -- Rows of stale servers are outdated and therefore never used as source, only the server itself may use them
+      AND (server = sqlc.arg(server) OR server NOT IN (
+          SELECT server FROM state WHERE user = sqlc.arg(user) AND type = 'Movie' AND stale > 0
+      ))
+      -- Only servers that may send updates to the server are used as source, an empty list allows all servers
+      AND (server = sqlc.arg(server) OR sqlc.arg(sources) = '' OR server IN (SELECT value FROM json_each(sqlc.arg(sources))))
 ),
      local_movies AS (
          -- Step 2: Get watch status from the local server (the one we're syncing TO)
@@ -32,88 +46,245 @@ WITH movie_groups AS (
              local_id,
              name,
              watched_date as local_watched_date,
-             watched_progress as local_watched_progress
+             watched_progress as local_watched_progress,
+             watched_position_ticks as local_watched_position_ticks,
+             is_favorite as local_is_favorite,
+             played as local_played,
+             last_changed as local_last_changed,
+             priority as local_priority
          FROM movie_groups
          WHERE server = sqlc.arg(server)
      ),
-     max_remote_movies AS (
-         -- Step 3: Find the most recent watch date for each movie on remote servers
-         -- This identifies which remote server has the most up-to-date watch progress
-         SELECT
-             match_key,
-             MAX(watched_date) as max_remote_watched_date
-         FROM movie_groups
-         WHERE server != sqlc.arg(server)
-    AND watched_date > 0  -- Only consider movies that have been watched
-GROUP BY match_key
-    ),
-    best_remote_movies AS (
--- Step 4: Get the complete record for the movie with the highest watch date on remote servers
+     best_remote_movies AS (
+-- Step 3: Get the complete record of the winning movie on remote servers, which is the one with the highest priority
+-- according to the conflict policy and the most recent change among those
 -- Using window functions to get all details from the "winning" remote server
 SELECT DISTINCT
     eg.match_key,
-    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_local_id,
-    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_name,
-    FIRST_VALUE(eg.watched_date) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_watched_date,
-    FIRST_VALUE(eg.watched_progress) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as remote_watched_progress,
-    FIRST_VALUE(eg.watched_position_ticks) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as watched_position_ticks,
-    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.watched_date DESC) as is_favorite
+    FIRST_VALUE(eg.server) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_server,
+    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_local_id,
+    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_name,
+    FIRST_VALUE(eg.watched_date) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_watched_date,
+    FIRST_VALUE(eg.watched_progress) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_watched_progress,
+    FIRST_VALUE(eg.watched_position_ticks) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as watched_position_ticks,
+    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as is_favorite,
+    FIRST_VALUE(eg.play_count) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_play_count,
+    FIRST_VALUE(eg.runtime) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_runtime,
+    FIRST_VALUE(eg.played) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_played,
+    FIRST_VALUE(eg.last_changed) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_last_changed,
+    FIRST_VALUE(eg.priority) OVER (PARTITION BY eg.match_key ORDER BY eg.priority DESC, eg.last_changed DESC) as remote_priority
 FROM movie_groups eg
-    INNER JOIN max_remote_movies mre ON eg.match_key = mre.match_key
-    AND eg.watched_date = mre.max_remote_watched_date
 WHERE eg.server != sqlc.arg(server)
+  AND eg.last_changed > 0  -- Only consider movies that have been watched or whose played state has been changed
     )
--- Step 5: Final result - Return movies that need their watch status updated
--- Only return movies where remote watch progress is newer than local watch progress
+-- Step 4: Final result - Return movies that need their watch status updated
+-- A remote movie with a higher priority than the local one wins as long as its state differs. Otherwise, only return
+-- movies where the remote change is newer than the local change and either the remote watch progress is newer than the
+-- local watch progress or the played state differs
 SELECT
     CAST(le.local_id AS TEXT) as local_id, -- ! Use local_id from local_episodes !
     CAST(bre.remote_name AS TEXT) as name,
     CAST(bre.remote_watched_date AS INTEGER) as watched_date,
     CAST(bre.remote_watched_progress AS REAL) as watched_progress,
     CAST(bre.watched_position_ticks AS INTEGER) as watched_position_ticks,
-    CAST(bre.is_favorite AS BOOL) as is_favorite
+    CAST(bre.is_favorite AS BOOL) as is_favorite,
+    CAST(bre.remote_played AS BOOL) as played,
+    CAST(bre.remote_runtime AS INTEGER) as runtime,
+    CAST(bre.remote_play_count AS INTEGER) as play_count,
+    CAST(bre.remote_server AS TEXT) as source_server,
+    CAST(bre.remote_local_id AS TEXT) as source_local_id,
+    CAST(le.local_watched_date AS INTEGER) as previous_watched_date,
+    CAST(le.local_watched_position_ticks AS INTEGER) as previous_watched_position_ticks,
+    CAST(le.local_is_favorite AS BOOL) as previous_is_favorite,
+    CAST(le.local_played AS BOOL) as previous_played
+FROM best_remote_movies bre
+         INNER JOIN local_movies le ON bre.match_key = le.match_key
+WHERE (bre.remote_priority > le.local_priority
+    AND (bre.remote_watched_date != le.local_watched_date
+        OR bre.remote_played != le.local_played
+        OR bre.watched_position_ticks != le.local_watched_position_ticks))
+   OR (bre.remote_priority = le.local_priority
+    AND bre.remote_last_changed > COALESCE(le.local_last_changed, 0)
+    AND (bre.remote_watched_date > COALESCE(le.local_watched_date, 0) OR bre.remote_played != le.local_played));
+
+-- name: GetMovieWithUpdatedFavorite :many
+-- Get movies whose favorite state has been changed more recently on another server than on the specified server
+WITH movie_groups AS (
+    -- Step 1: Normalize all movie data and create matching keys
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(name AS TEXT) as name,
+        CAST(runtime AS INTEGER) as runtime,
+        CAST(watched_date AS INTEGER) as watched_date,
+        CAST(watched_progress AS REAL) as watched_progress,
+        CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(played AS BOOL) as played,
+        CAST(is_favorite AS BOOL) as is_favorite,
+        CAST(favorite_changed AS INTEGER) as favorite_changed,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = sqlc.arg(user)
+      -- Rows of stale servers are outdated and therefore never used as source, only the server itself may use them
+      AND (server = sqlc.arg(server) OR server NOT IN (
+          SELECT server FROM state WHERE user = sqlc.arg(user) AND type = 'Movie' AND stale > 0
+      ))
+      -- Only servers that may send updates to the server are used as source, an empty list allows all servers
+      AND (server = sqlc.arg(server) OR sqlc.arg(sources) = '' OR server IN (SELECT value FROM json_each(sqlc.arg(sources))))
+),
+     local_movies AS (
+         -- Step 2: Get the favorite state from the local server (the one we're syncing TO)
+         SELECT
+             match_key,
+             local_id,
+             watched_date as local_watched_date,
+             watched_progress as local_watched_progress,
+             watched_position_ticks as local_watched_position_ticks,
+             played as local_played,
+             is_favorite as local_is_favorite,
+             favorite_changed as local_favorite_changed
+         FROM movie_groups
+         WHERE server = sqlc.arg(server)
+     ),
+     best_remote_movies AS (
+-- Step 3: Get the record with the most recent change of the favorite state on remote servers
+SELECT DISTINCT
+    eg.match_key,
+    FIRST_VALUE(eg.server) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_server,
+    FIRST_VALUE(eg.local_id) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_local_id,
+    FIRST_VALUE(eg.name) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_name,
+    FIRST_VALUE(eg.is_favorite) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_is_favorite,
+    FIRST_VALUE(eg.favorite_changed) OVER (PARTITION BY eg.match_key ORDER BY eg.favorite_changed DESC) as remote_favorite_changed
+FROM movie_groups eg
+WHERE eg.server != sqlc.arg(server)
+  AND eg.favorite_changed > 0
+    )
+-- Step 4: Final result - Return movies where the remote favorite state differs and is newer than the local one
+SELECT
+    CAST(le.local_id AS TEXT) as local_id,
+    CAST(bre.remote_name AS TEXT) as name,
+    CAST(le.local_watched_date AS INTEGER) as watched_date,
+    CAST(le.local_watched_progress AS REAL) as watched_progress,
+    CAST(le.local_watched_position_ticks AS INTEGER) as watched_position_ticks,
+    CAST(le.local_played AS BOOL) as played,
+    CAST(bre.remote_is_favorite AS BOOL) as is_favorite,
+    CAST(bre.remote_favorite_changed AS INTEGER) as favorite_changed,
+    CAST(bre.remote_server AS TEXT) as source_server,
+    CAST(bre.remote_local_id AS TEXT) as source_local_id,
+    CAST(le.local_is_favorite AS BOOL) as previous_is_favorite
 FROM best_remote_movies bre
          INNER JOIN local_movies le ON bre.match_key = le.match_key
-WHERE bre.remote_watched_date > COALESCE(le.local_watched_date, 0)
-  AND bre.remote_watched_date > 0;
+WHERE bre.remote_is_favorite != le.local_is_favorite
+  AND bre.remote_favorite_changed > le.local_favorite_changed;
+
+-- name: GetMovieDiff :many
+-- Get the cached UserData of movies on two servers side by side, matched by the same keys that are used for syncing
+WITH movie_groups AS (
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(name AS TEXT) as name,
+        CAST(runtime AS INTEGER) as runtime,
+        CAST(watched_date AS INTEGER) as watched_date,
+        CAST(watched_position_ticks AS INTEGER) as watched_position_ticks,
+        CAST(played AS BOOL) as played,
+        CAST(is_favorite AS BOOL) as is_favorite,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = sqlc.arg(user)
+),
+     a AS (
+         SELECT * FROM movie_groups WHERE server = sqlc.arg(server_a)
+     ),
+     b AS (
+         SELECT * FROM movie_groups WHERE server = sqlc.arg(server_b)
+     ),
+     matched AS (
+         -- SQLite only supports FULL OUTER JOIN since 3.39, so it's emulated using two LEFT JOINs
+         SELECT a.match_key as match_key, a.local_id as a_local_id, b.local_id as b_local_id FROM a LEFT JOIN b ON a.match_key = b.match_key
+         UNION ALL
+         SELECT b.match_key as match_key, NULL as a_local_id, b.local_id as b_local_id FROM b LEFT JOIN a ON a.match_key = b.match_key WHERE a.match_key IS NULL
+     )
+SELECT
+    CAST(m.match_key AS TEXT) as match_key,
+    CAST(COALESCE(a.name, b.name) AS TEXT) as name,
+    CAST(COALESCE(a.local_id, '') AS TEXT) as a_local_id,
+    CAST(COALESCE(a.watched_date, 0) AS INTEGER) as a_watched_date,
+    CAST(COALESCE(a.watched_position_ticks, 0) AS INTEGER) as a_watched_position_ticks,
+    CAST(COALESCE(a.played, 0) AS BOOL) as a_played,
+    CAST(COALESCE(a.is_favorite, 0) AS BOOL) as a_is_favorite,
+    CAST(COALESCE(b.local_id, '') AS TEXT) as b_local_id,
+    CAST(COALESCE(b.watched_date, 0) AS INTEGER) as b_watched_date,
+    CAST(COALESCE(b.watched_position_ticks, 0) AS INTEGER) as b_watched_position_ticks,
+    CAST(COALESCE(b.played, 0) AS BOOL) as b_played,
+    CAST(COALESCE(b.is_favorite, 0) AS BOOL) as b_is_favorite
+FROM matched m
+         LEFT JOIN a ON a.local_id = m.a_local_id
+         LEFT JOIN b ON b.local_id = m.b_local_id
+ORDER BY 2;
 
 -- name: InsertMovie :exec
 INSERT INTO
     movies (
         server,
+        user,
         name,
         local_id,
-        imdb_id,
-        tmdb_id,
+        provider_ids,
+        match_key,
         runtime,
         watched_date,
         watched_progress,
         watched_position_ticks,
+        play_count,
         is_favorite,
+        played,
+        played_changed,
+        favorite_changed,
         last_seen
     )
 VALUES (
         sqlc.arg(server),
+        sqlc.arg(user),
         sqlc.arg(name),
         sqlc.arg(local_id),
-        sqlc.arg(imdb_id),
-        sqlc.arg(tmdb_id),
+        sqlc.arg(provider_ids),
+        sqlc.arg(match_key),
         sqlc.arg(runtime),
         sqlc.arg(watched_date),
         sqlc.arg(watched_progress),
         sqlc.arg(watched_position_ticks),
+        sqlc.arg(play_count),
         sqlc.arg(is_favorite),
+        sqlc.arg(played),
+        sqlc.arg(played_changed),
+        sqlc.arg(favorite_changed),
         strftime('%s', 'now')
 )
-ON CONFLICT(server, local_id) DO UPDATE SET
+ON CONFLICT(server, user, local_id) DO UPDATE SET
         name = excluded.name,
-        imdb_id = excluded.imdb_id,
-        tmdb_id = excluded.tmdb_id,
+        provider_ids = excluded.provider_ids,
+        match_key = excluded.match_key,
         runtime = excluded.runtime,
         watched_date = excluded.watched_date,
         watched_progress  = excluded.watched_progress,
         watched_position_ticks  = excluded.watched_position_ticks,
+        play_count = excluded.play_count,
         is_favorite = excluded.is_favorite,
+        played = excluded.played,
+        -- Jellyfin does not keep track of when an item has been marked as (un)played, so a transition to played is
+        -- dated by its watched_date while a transition to unplayed is dated by the time it has been noticed.
+        played_changed = CASE
+            WHEN movies.played = excluded.played THEN movies.played_changed
+            WHEN excluded.played AND excluded.watched_date > 0 THEN excluded.watched_date
+            ELSE strftime('%s', 'now')
+        END,
+        favorite_changed = CASE
+            WHEN movies.is_favorite = excluded.is_favorite THEN movies.favorite_changed
+            ELSE strftime('%s', 'now')
+        END,
         last_seen = strftime('%s', 'now');
 
 -- name: RemoveMoviesNotSeenSince :exec
@@ -121,5 +292,58 @@ DELETE FROM
     movies
 WHERE
     server = sqlc.arg(server)
+AND
+    user = sqlc.arg(user)
 AND
     last_seen < sqlc.arg(since);
+
+-- name: GetMovieMatches :many
+-- Get all movies that are identical to the specified item or that match the specified key, including the item itself
+WITH movie_groups AS (
+    SELECT
+        CAST(server AS TEXT) as server,
+        CAST(local_id AS TEXT) as local_id,
+        CAST(provider_ids AS TEXT) as provider_ids,
+        -- The key that identifies the same item across servers, derived by the match strategies on insert
+        CAST(match_key AS TEXT) as match_key
+    FROM movies
+    WHERE user = sqlc.arg(user)
+)
+SELECT
+    CAST(server AS TEXT) as server,
+    CAST(local_id AS TEXT) as local_id,
+    CAST(match_key AS TEXT) as match_key
+FROM movie_groups
+WHERE match_key IN (
+    SELECT match_key
+    FROM movie_groups
+    WHERE (server = sqlc.arg(server) AND local_id = sqlc.arg(local_id)) OR match_key = sqlc.arg(match_key)
+       -- Items whose key has been derived by another strategy are found by their provider IDs
+       OR EXISTS (SELECT 1 FROM json_each(provider_ids) WHERE key || '_' || value = sqlc.arg(match_key))
+)
+ORDER BY server, local_id;
+
+-- name: RevertMovieUserData :exec
+-- Restore the reverted UserData of a cached item, fields that are null are kept. The restored values must never be
+-- propagated as the most recent change, so they are dated by their original timestamps: a transition to played by its
+-- watched_date while all other transitions are considered to have never been changed.
+UPDATE movies SET
+    watched_date = COALESCE(sqlc.narg(watched_date), watched_date),
+    watched_position_ticks = COALESCE(sqlc.narg(watched_position_ticks), watched_position_ticks),
+    is_favorite = COALESCE(sqlc.narg(is_favorite), is_favorite),
+    played = COALESCE(sqlc.narg(played), played),
+    played_changed = CASE
+        WHEN sqlc.narg(played) IS NULL OR played = sqlc.narg(played) THEN played_changed
+        WHEN sqlc.narg(played) THEN COALESCE(sqlc.narg(watched_date), watched_date)
+        ELSE 0
+    END,
+    favorite_changed = CASE
+        WHEN sqlc.narg(is_favorite) IS NULL OR is_favorite = sqlc.narg(is_favorite) THEN favorite_changed
+        ELSE 0
+    END
+WHERE
+    server = sqlc.arg(server)
+AND
+    user = sqlc.arg(user)
+AND
+    local_id = sqlc.arg(local_id);
@@ -1,16 +1,18 @@
 -- name: UpsertState :exec
 INSERT INTO state (
     server,
+    user,
     type,
     last_sync
 )
 VALUES (
     sqlc.arg(server),
+    sqlc.arg(user),
     sqlc.arg(type),
     sqlc.arg(last_sync)
 )
 
-ON CONFLICT(server, type) DO UPDATE SET last_sync = excluded.last_sync;
+ON CONFLICT(server, user, type) DO UPDATE SET last_sync = excluded.last_sync;
 
 -- name: GetLastCheck :one
 SELECT
@@ -18,4 +20,40 @@ SELECT
 FROM state
 WHERE
     server = sqlc.arg(server) AND
+    user = sqlc.arg(user) AND
+    type = sqlc.arg(type);
+
+-- name: MarkStale :exec
+-- Marks the server as stale, a server that is already stale keeps the time it has been marked as stale first
+INSERT INTO state (
+    server,
+    user,
+    type,
+    last_sync,
+    stale
+)
+VALUES (
+    sqlc.arg(server),
+    sqlc.arg(user),
+    sqlc.arg(type),
+    sqlc.arg(stale),
+    sqlc.arg(stale)
+)
+
+ON CONFLICT(server, user, type) DO UPDATE SET stale = CASE WHEN state.stale > 0 THEN state.stale ELSE excluded.stale END;
+
+-- name: ClearStale :exec
+UPDATE state SET stale = 0
+WHERE
+    server = sqlc.arg(server) AND
+    user = sqlc.arg(user) AND
+    type = sqlc.arg(type);
+
+-- name: GetStale :one
+SELECT
+    stale
+FROM state
+WHERE
+    server = sqlc.arg(server) AND
+    user = sqlc.arg(user) AND
     type = sqlc.arg(type);
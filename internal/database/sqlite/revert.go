@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+// revertedUserData holds the fields of a reverted UserData update, fields that have not been reverted are null.
+type revertedUserData struct {
+	watchedDate          sql.NullInt64
+	watchedPositionTicks sql.NullInt64
+	isFavorite           sql.NullBool
+	played               sql.NullBool
+}
+
+func getRevertedUserData(data jellyfin.UserDataUpdate) revertedUserData {
+	var ret revertedUserData
+	if data.LastPlayedDate != nil {
+		ret.watchedDate = sql.NullInt64{Int64: data.LastPlayedDate.Unix(), Valid: true}
+	}
+	if data.PlaybackPositionTicks != nil {
+		ret.watchedPositionTicks = sql.NullInt64{Int64: *data.PlaybackPositionTicks, Valid: true}
+	}
+	if data.IsFavorite != nil {
+		ret.isFavorite = sql.NullBool{Bool: *data.IsFavorite, Valid: true}
+	}
+	if data.Played != nil {
+		ret.played = sql.NullBool{Bool: *data.Played, Valid: true}
+	}
+	return ret
+}
+
+func (q *SQLiteJellyDb) RevertMoviesUserData(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error {
+	reverted := getRevertedUserData(data)
+	start := time.Now()
+	err := q.generated.RevertMovieUserData(ctx, generated.RevertMovieUserDataParams{
+		Server:               server,
+		User:                 user,
+		LocalID:              localID,
+		WatchedDate:          reverted.watchedDate,
+		WatchedPositionTicks: reverted.watchedPositionTicks,
+		IsFavorite:           reverted.isFavorite,
+		Played:               reverted.played,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RevertMovieUserData").Inc()
+		return err
+	}
+	metrics.DbQueriesTime.WithLabelValues("RevertMovieUserData").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) RevertEpisodesUserData(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error {
+	reverted := getRevertedUserData(data)
+	start := time.Now()
+	err := q.generated.RevertEpisodeUserData(ctx, generated.RevertEpisodeUserDataParams{
+		Server:               server,
+		User:                 user,
+		LocalID:              localID,
+		WatchedDate:          reverted.watchedDate,
+		WatchedPositionTicks: reverted.watchedPositionTicks,
+		IsFavorite:           reverted.isFavorite,
+		Played:               reverted.played,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RevertEpisodeUserData").Inc()
+		return err
+	}
+	metrics.DbQueriesTime.WithLabelValues("RevertEpisodeUserData").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) RevertAudioUserData(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error {
+	reverted := getRevertedUserData(data)
+	start := time.Now()
+	err := q.generated.RevertAudioUserData(ctx, generated.RevertAudioUserDataParams{
+		Server:               server,
+		User:                 user,
+		LocalID:              localID,
+		WatchedDate:          reverted.watchedDate,
+		WatchedPositionTicks: reverted.watchedPositionTicks,
+		IsFavorite:           reverted.isFavorite,
+		Played:               reverted.played,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RevertAudioUserData").Inc()
+		return err
+	}
+	metrics.DbQueriesTime.WithLabelValues("RevertAudioUserData").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) RevertAudioBooksUserData(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error {
+	reverted := getRevertedUserData(data)
+	start := time.Now()
+	err := q.generated.RevertAudioBookUserData(ctx, generated.RevertAudioBookUserDataParams{
+		Server:               server,
+		User:                 user,
+		LocalID:              localID,
+		WatchedDate:          reverted.watchedDate,
+		WatchedPositionTicks: reverted.watchedPositionTicks,
+		IsFavorite:           reverted.isFavorite,
+		Played:               reverted.played,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RevertAudioBookUserData").Inc()
+		return err
+	}
+	metrics.DbQueriesTime.WithLabelValues("RevertAudioBookUserData").Observe(time.Since(start).Seconds())
+	return nil
+}
+
+func (q *SQLiteJellyDb) RevertMusicVideosUserData(ctx context.Context, server, user, localID string, data jellyfin.UserDataUpdate) error {
+	reverted := getRevertedUserData(data)
+	start := time.Now()
+	err := q.generated.RevertMusicVideoUserData(ctx, generated.RevertMusicVideoUserDataParams{
+		Server:               server,
+		User:                 user,
+		LocalID:              localID,
+		WatchedDate:          reverted.watchedDate,
+		WatchedPositionTicks: reverted.watchedPositionTicks,
+		IsFavorite:           reverted.isFavorite,
+		Played:               reverted.played,
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("RevertMusicVideoUserData").Inc()
+		return err
+	}
+	metrics.DbQueriesTime.WithLabelValues("RevertMusicVideoUserData").Observe(time.Since(start).Seconds())
+	return nil
+}
@@ -3,25 +3,38 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"time"
-	"unicode"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/jellyporter/internal/database/sqlite/generated"
 	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
 	"github.com/soerenschneider/jellyporter/internal/metrics"
+	"go.uber.org/multierr"
 )
 
 type SQLiteJellyDb struct {
 	db        *sql.DB
 	generated *generated.Queries
+
+	// stores holds the queries for each supported item type
+	stores map[jellyfin.ItemType]itemTypeStore
+	// policies holds the conflict policy for each item type that does not use the DefaultConflictPolicy
+	policies map[jellyfin.ItemType]ConflictPolicy
+	// sources holds the servers each server may receive updates from, servers that are not listed receive updates from
+	// all servers
+	sources map[string][]string
+	// matchers derive the keys that identify the same item across servers for each item type
+	matchers map[jellyfin.ItemType]*matching.Matcher
 }
 
-func New(dbPath string) (*SQLiteJellyDb, error) {
+type SQLiteJellyDbOpts func(*SQLiteJellyDb) error
+
+func New(dbPath string, opts ...SQLiteJellyDbOpts) (*SQLiteJellyDb, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
@@ -31,13 +44,29 @@ func New(dbPath string) (*SQLiteJellyDb, error) {
 	ret := &SQLiteJellyDb{
 		db:        db,
 		generated: gen,
+		policies:  map[jellyfin.ItemType]ConflictPolicy{},
+		matchers:  map[jellyfin.ItemType]*matching.Matcher{},
+	}
+	ret.stores = ret.itemTypeStores()
+	for itemType := range ret.stores {
+		ret.matchers[itemType] = matching.MustNewMatcher(itemType)
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(ret); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+	if errs != nil {
+		return nil, multierr.Append(errs, db.Close())
 	}
 
 	return ret, ret.Migrate(context.Background())
 }
 
-func MustNew(dbPath string) *SQLiteJellyDb {
-	db, err := New(dbPath)
+func MustNew(dbPath string, opts ...SQLiteJellyDbOpts) *SQLiteJellyDb {
+	db, err := New(dbPath, opts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not create new database")
 	}
@@ -45,9 +74,40 @@ func MustNew(dbPath string) *SQLiteJellyDb {
 	return db
 }
 
-func (q *SQLiteJellyDb) GetMoviesWithUpdatedUserData(ctx context.Context, server string) ([]ItemWithUpdatedUserData, error) {
+// conflictPolicy returns the policy to resolve conflicting UserData of the given item type.
+func (q *SQLiteJellyDb) conflictPolicy(itemType jellyfin.ItemType) ConflictPolicy {
+	if policy, found := q.policies[itemType]; found {
+		return policy
+	}
+
+	return DefaultConflictPolicy
+}
+
+// replicationSources returns the servers the given server may receive updates from as a JSON array, or an empty
+// string if it receives updates from all servers.
+func (q *SQLiteJellyDb) replicationSources(server string) string {
+	sources, found := q.sources[server]
+	if !found {
+		return ""
+	}
+
+	if sources == nil {
+		sources = []string{}
+	}
+	data, _ := json.Marshal(sources) // a slice of strings can always be marshalled
+	return string(data)
+}
+
+func (q *SQLiteJellyDb) GetMoviesWithUpdatedUserData(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error) {
 	start := time.Now()
-	unwatched, err := q.generated.GetMovieWithGreatestWatchedDate(ctx, server)
+	policy := q.conflictPolicy(jellyfin.ItemMovie)
+	unwatched, err := q.generated.GetMovieWithGreatestWatchedDate(ctx, generated.GetMovieWithGreatestWatchedDateParams{
+		Server:        server,
+		User:          user,
+		Policy:        string(policy.Strategy),
+		PrimaryServer: policy.PrimaryServer,
+		Sources:       q.replicationSources(server),
+	})
 	if err != nil {
 		metrics.DbQueryErrors.WithLabelValues("GetMovieWithGreatestWatchedDate").Inc()
 		return nil, err
@@ -57,45 +117,85 @@ func (q *SQLiteJellyDb) GetMoviesWithUpdatedUserData(ctx context.Context, server
 	ret := make([]ItemWithUpdatedUserData, len(unwatched))
 	for idx, movie := range unwatched {
 		ret[idx] = ItemWithUpdatedUserData{
-			Name:                 movie.Name,
+			Name:                         movie.Name,
+			LocalID:                      movie.LocalID,
+			WatchedDate:                  movie.WatchedDate,
+			WatchedProgress:              movie.WatchedProgress,
+			WatchedPositionTicks:         movie.WatchedPositionTicks,
+			IsFavorite:                   movie.IsFavorite,
+			Played:                       movie.Played,
+			Runtime:                      movie.Runtime,
+			PlayCount:                    movie.PlayCount,
+			SourceServer:                 movie.SourceServer,
+			SourceLocalID:                movie.SourceLocalID,
+			PreviousWatchedDate:          movie.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: movie.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           movie.PreviousIsFavorite,
+			PreviousPlayed:               movie.PreviousPlayed,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetMoviesWithUpdatedFavorite(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error) {
+	start := time.Now()
+	updated, err := q.generated.GetMovieWithUpdatedFavorite(ctx, generated.GetMovieWithUpdatedFavoriteParams{
+		Server:  server,
+		User:    user,
+		Sources: q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetMovieWithUpdatedFavorite").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetMovieWithUpdatedFavorite").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedFavorite, len(updated))
+	for idx, movie := range updated {
+		ret[idx] = ItemWithUpdatedFavorite{
 			LocalID:              movie.LocalID,
+			Name:                 movie.Name,
 			WatchedDate:          movie.WatchedDate,
 			WatchedProgress:      movie.WatchedProgress,
 			WatchedPositionTicks: movie.WatchedPositionTicks,
+			Played:               movie.Played,
 			IsFavorite:           movie.IsFavorite,
+			FavoriteChanged:      movie.FavoriteChanged,
+			SourceServer:         movie.SourceServer,
+			SourceLocalID:        movie.SourceLocalID,
+			PreviousIsFavorite:   movie.PreviousIsFavorite,
 		}
 	}
 
 	return ret, nil
 }
 
-func (q *SQLiteJellyDb) InsertMovie(ctx context.Context, server string, movie jellyfin.Item) error {
-	params := MovieToInsertMovieParam(server, movie)
+func (q *SQLiteJellyDb) InsertMovie(ctx context.Context, server, user string, movie jellyfin.Item) error {
+	params := MovieToInsertMovieParam(server, user, movie, q.matchers[jellyfin.ItemMovie])
 	return q.generated.InsertMovie(ctx, params)
 }
 
-func (q *SQLiteJellyDb) RemoveItemsNotSeenSince(ctx context.Context, server string, itemType jellyfin.ItemType, notSeenSince time.Time) error {
+func (q *SQLiteJellyDb) RemoveItemsNotSeenSince(ctx context.Context, server, user string, itemType jellyfin.ItemType, notSeenSince time.Time) error {
 	if notSeenSince.IsZero() {
 		return errors.New("notSeenSince must not be zero")
 	}
 
-	log.Info().Int64("not_seen_since", notSeenSince.Unix()).Msgf("Deleting %ss not seen since %v", itemType, notSeenSince.Format("2006-01-02 15:04:05"))
-
-	switch itemType {
-	case jellyfin.ItemEpisode:
-		return q.RemoveEpisodesNotSeenSince(ctx, server, notSeenSince)
-	case jellyfin.ItemMovie:
-		return q.RemoveMoviesNotSeenSince(ctx, server, notSeenSince)
-	default:
-		return fmt.Errorf("unknown itemtype: %v", itemType)
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return err
 	}
+
+	log.Info().Int64("not_seen_since", notSeenSince.Unix()).Msgf("Deleting %ss not seen since %v", itemType, notSeenSince.Format("2006-01-02 15:04:05"))
+	return store.removeNotSeenSince(ctx, server, user, notSeenSince)
 }
 
-func (q *SQLiteJellyDb) RemoveMoviesNotSeenSince(ctx context.Context, server string, since time.Time) error {
+func (q *SQLiteJellyDb) RemoveMoviesNotSeenSince(ctx context.Context, server, user string, since time.Time) error {
 	start := time.Now()
 
 	if err := q.generated.RemoveMoviesNotSeenSince(ctx, generated.RemoveMoviesNotSeenSinceParams{
 		Server: server,
+		User:   user,
 		Since:  since.Unix(),
 	}); err != nil {
 		metrics.DbQueryErrors.WithLabelValues("RemoveMoviesNotSeenSince").Inc()
@@ -106,11 +206,12 @@ func (q *SQLiteJellyDb) RemoveMoviesNotSeenSince(ctx context.Context, server str
 	return nil
 }
 
-func (q *SQLiteJellyDb) RemoveEpisodesNotSeenSince(ctx context.Context, server string, since time.Time) error {
+func (q *SQLiteJellyDb) RemoveEpisodesNotSeenSince(ctx context.Context, server, user string, since time.Time) error {
 	start := time.Now()
 
 	if err := q.generated.RemoveEpisodesNotSeenSince(ctx, generated.RemoveEpisodesNotSeenSinceParams{
 		Server: server,
+		User:   user,
 		Since:  since.Unix(),
 	}); err != nil {
 		metrics.DbQueryErrors.WithLabelValues("RemoveEpisodesNotSeenSince").Inc()
@@ -121,7 +222,7 @@ func (q *SQLiteJellyDb) RemoveEpisodesNotSeenSince(ctx context.Context, server s
 	return nil
 }
 
-func (q *SQLiteJellyDb) InsertMovies(ctx context.Context, server string, movies []jellyfin.Item) error {
+func (q *SQLiteJellyDb) InsertMovies(ctx context.Context, server, user string, movies []jellyfin.Item) error {
 	start := time.Now()
 	tx, err := q.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -134,7 +235,7 @@ func (q *SQLiteJellyDb) InsertMovies(ctx context.Context, server string, movies
 
 	queries := q.generated.WithTx(tx)
 	for _, movie := range movies {
-		params := MovieToInsertMovieParam(server, movie)
+		params := MovieToInsertMovieParam(server, user, movie, q.matchers[jellyfin.ItemMovie])
 		if err := queries.InsertMovie(ctx, params); err != nil {
 			metrics.DbQueryErrors.WithLabelValues("InsertMovies").Inc()
 			return err
@@ -149,9 +250,16 @@ func (q *SQLiteJellyDb) InsertMovies(ctx context.Context, server string, movies
 	return err
 }
 
-func (q *SQLiteJellyDb) GetEpisodesWithUpdatedUserData(ctx context.Context, server string) ([]ItemWithUpdatedUserData, error) {
+func (q *SQLiteJellyDb) GetEpisodesWithUpdatedUserData(ctx context.Context, server, user string) ([]ItemWithUpdatedUserData, error) {
 	start := time.Now()
-	unwatched, err := q.generated.GetEpisodeWithGreatestWatchedDate(ctx, server)
+	policy := q.conflictPolicy(jellyfin.ItemEpisode)
+	unwatched, err := q.generated.GetEpisodeWithGreatestWatchedDate(ctx, generated.GetEpisodeWithGreatestWatchedDateParams{
+		Server:        server,
+		User:          user,
+		Policy:        string(policy.Strategy),
+		PrimaryServer: policy.PrimaryServer,
+		Sources:       q.replicationSources(server),
+	})
 	if err != nil {
 		metrics.DbQueryErrors.WithLabelValues("GetEpisodesWithUpdatedUserData").Inc()
 		return nil, err
@@ -161,31 +269,123 @@ func (q *SQLiteJellyDb) GetEpisodesWithUpdatedUserData(ctx context.Context, serv
 	ret := make([]ItemWithUpdatedUserData, len(unwatched))
 	for idx, episode := range unwatched {
 		ret[idx] = ItemWithUpdatedUserData{
+			LocalID:                      episode.LocalID,
+			Name:                         episode.Name,
+			SeriesName:                   episode.SeriesName,
+			WatchedDate:                  episode.WatchedDate,
+			WatchedProgress:              episode.WatchedProgress,
+			WatchedPositionTicks:         episode.WatchedPositionTicks,
+			IsFavorite:                   episode.IsFavorite,
+			Played:                       episode.Played,
+			Runtime:                      episode.Runtime,
+			PlayCount:                    episode.PlayCount,
+			SourceServer:                 episode.SourceServer,
+			SourceLocalID:                episode.SourceLocalID,
+			PreviousWatchedDate:          episode.PreviousWatchedDate,
+			PreviousWatchedPositionTicks: episode.PreviousWatchedPositionTicks,
+			PreviousIsFavorite:           episode.PreviousIsFavorite,
+			PreviousPlayed:               episode.PreviousPlayed,
+		}
+	}
+
+	return ret, nil
+}
+
+func (q *SQLiteJellyDb) GetEpisodesWithUpdatedFavorite(ctx context.Context, server, user string) ([]ItemWithUpdatedFavorite, error) {
+	start := time.Now()
+	updated, err := q.generated.GetEpisodeWithUpdatedFavorite(ctx, generated.GetEpisodeWithUpdatedFavoriteParams{
+		Server:  server,
+		User:    user,
+		Sources: q.replicationSources(server),
+	})
+	if err != nil {
+		metrics.DbQueryErrors.WithLabelValues("GetEpisodeWithUpdatedFavorite").Inc()
+		return nil, err
+	}
+	metrics.DbQueriesTime.WithLabelValues("GetEpisodeWithUpdatedFavorite").Observe(time.Since(start).Seconds())
+
+	ret := make([]ItemWithUpdatedFavorite, len(updated))
+	for idx, episode := range updated {
+		ret[idx] = ItemWithUpdatedFavorite{
 			LocalID:              episode.LocalID,
 			Name:                 episode.Name,
 			SeriesName:           episode.SeriesName,
 			WatchedDate:          episode.WatchedDate,
 			WatchedProgress:      episode.WatchedProgress,
 			WatchedPositionTicks: episode.WatchedPositionTicks,
+			Played:               episode.Played,
 			IsFavorite:           episode.IsFavorite,
+			FavoriteChanged:      episode.FavoriteChanged,
+			SourceServer:         episode.SourceServer,
+			SourceLocalID:        episode.SourceLocalID,
+			PreviousIsFavorite:   episode.PreviousIsFavorite,
 		}
 	}
 
 	return ret, nil
 }
 
-func (q *SQLiteJellyDb) InsertItems(ctx context.Context, server string, itemType jellyfin.ItemType, items []jellyfin.Item) error {
-	switch itemType {
-	case jellyfin.ItemEpisode:
-		return q.InsertEpisodes(ctx, server, items)
-	case jellyfin.ItemMovie:
-		return q.InsertMovies(ctx, server, items)
-	default:
-		return fmt.Errorf("unknown type: %s", itemType)
+func (q *SQLiteJellyDb) InsertItems(ctx context.Context, server, user string, itemType jellyfin.ItemType, items []jellyfin.Item) error {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return err
+	}
+
+	return store.insert(ctx, server, user, items)
+}
+
+func (q *SQLiteJellyDb) GetItemsWithUpdatedUserData(ctx context.Context, server, user string, itemType jellyfin.ItemType) ([]ItemWithUpdatedUserData, error) {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return nil, err
 	}
+
+	return store.getWithUpdatedUserData(ctx, server, user)
 }
 
-func (q *SQLiteJellyDb) InsertEpisodes(ctx context.Context, server string, episodes []jellyfin.Item) error {
+func (q *SQLiteJellyDb) GetItemsWithUpdatedFavorite(ctx context.Context, server, user string, itemType jellyfin.ItemType) ([]ItemWithUpdatedFavorite, error) {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.getWithUpdatedFavorite(ctx, server, user)
+}
+
+// GetItemDiff returns the cached UserData of all items of the given type on two servers side by side.
+func (q *SQLiteJellyDb) GetItemDiff(ctx context.Context, user, serverA, serverB string, itemType jellyfin.ItemType) ([]ItemDiff, error) {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.getDiff(ctx, user, serverA, serverB)
+}
+
+// GetItemMatches returns all cached items of the given type that are identical to the item with the given local ID on
+// the given server or that match the given key, including the item itself.
+func (q *SQLiteJellyDb) GetItemMatches(ctx context.Context, user string, itemType jellyfin.ItemType, server, localID, matchKey string) ([]ItemMatch, error) {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.getMatches(ctx, user, server, localID, matchKey)
+}
+
+// RevertUserData restores the reverted UserData of a cached item, so the cache holds the values that have been sent
+// to the server. The restored values are dated by their original timestamps and are therefore never propagated to
+// other servers as the most recent change.
+func (q *SQLiteJellyDb) RevertUserData(ctx context.Context, server, user string, itemType jellyfin.ItemType, localID string, data jellyfin.UserDataUpdate) error {
+	store, err := q.getStore(itemType)
+	if err != nil {
+		return err
+	}
+
+	return store.revertUserData(ctx, server, user, localID, data)
+}
+
+func (q *SQLiteJellyDb) InsertEpisodes(ctx context.Context, server, user string, episodes []jellyfin.Item) error {
 	start := time.Now()
 	tx, err := q.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -198,7 +398,11 @@ func (q *SQLiteJellyDb) InsertEpisodes(ctx context.Context, server string, episo
 
 	queries := q.generated.WithTx(tx)
 	for _, episode := range episodes {
-		params := EpisodeToInsertEpisodeParam(server, episode)
+		params := EpisodeToInsertEpisodeParam(server, user, episode, q.matchers[jellyfin.ItemEpisode])
+		if err := fuzzyMatchEpisode(ctx, queries, &params); err != nil {
+			metrics.DbQueryErrors.WithLabelValues("InsertEpisodes").Inc()
+			return err
+		}
 		if err := queries.InsertEpisode(ctx, params); err != nil {
 			metrics.DbQueryErrors.WithLabelValues("InsertEpisodes").Inc()
 			return err
@@ -214,22 +418,67 @@ func (q *SQLiteJellyDb) InsertEpisodes(ctx context.Context, server string, episo
 	return nil
 }
 
-func (q *SQLiteJellyDb) InsertEpisode(ctx context.Context, server string, episode jellyfin.Item) error {
-	params := EpisodeToInsertEpisodeParam(server, episode)
+func (q *SQLiteJellyDb) InsertEpisode(ctx context.Context, server, user string, episode jellyfin.Item) error {
+	params := EpisodeToInsertEpisodeParam(server, user, episode, q.matchers[jellyfin.ItemEpisode])
+	if err := fuzzyMatchEpisode(ctx, q.generated, &params); err != nil {
+		return err
+	}
 	return q.generated.InsertEpisode(ctx, params)
 }
 
-func (q *SQLiteJellyDb) InsertChangelog(ctx context.Context, server string, change ChangelogData) error {
+// fuzzyMatchEpisode is the last resort for episodes that none of the match strategies apply to. Instead of requiring
+// the exact name and runtime, it adopts the key of the same episode on another server whose runtime is within the
+// matching.RuntimeTolerance.
+func fuzzyMatchEpisode(ctx context.Context, queries *generated.Queries, params *generated.InsertEpisodeParams) error {
+	if !matching.IsNameKey(params.MatchKey) {
+		return nil
+	}
+
+	matchKey, err := queries.GetEpisodeFuzzyMatch(ctx, generated.GetEpisodeFuzzyMatchParams{
+		User:          params.User,
+		Server:        params.Server,
+		SeriesName:    params.SeriesName,
+		SeasonNumber:  params.SeasonNumber,
+		EpisodeNumber: params.EpisodeNumber,
+		Name:          params.Name,
+		Runtime:       params.Runtime,
+		// runtimes are measured in ticks of 100 nanoseconds
+		Tolerance: matching.RuntimeTolerance.Nanoseconds() / 100,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	params.MatchKey = matchKey
+	return nil
+}
+
+func (q *SQLiteJellyDb) InsertChangelog(ctx context.Context, server, user string, change ChangelogData) error {
 	start := time.Now()
 
 	params := generated.InsertChangelogParams{
 		Server:                  server,
+		User:                    user,
 		LocalID:                 change.LocalID,
 		Date:                    start.Unix(),
 		NewWatchedDate:          change.NewWatchedDate,
 		NewWatchedProgress:      change.NewWatchedProgress,
 		NewWatchedPositionTicks: change.NewWatchedPositionTicks,
 		NewIsFavorite:           change.NewIsFavorite,
+		NewPlayed:               change.NewPlayed,
+
+		SourceServer:                 change.SourceServer,
+		SourceLocalID:                change.SourceLocalID,
+		PreviousWatchedDate:          change.PreviousWatchedDate,
+		PreviousWatchedPositionTicks: change.PreviousWatchedPositionTicks,
+		PreviousIsFavorite:           change.PreviousIsFavorite,
+		PreviousPlayed:               change.PreviousPlayed,
+		Reason:                       change.Reason,
+		RunID:                        change.RunID,
+		Reverts:                      change.Reverts,
 	}
 
 	if err := q.generated.InsertChangelog(ctx, params); err != nil {
@@ -241,9 +490,10 @@ func (q *SQLiteJellyDb) InsertChangelog(ctx context.Context, server string, chan
 	return nil
 }
 
-func (q *SQLiteJellyDb) UpsertState(ctx context.Context, server string, itemType jellyfin.ItemType, ts time.Time) error {
+func (q *SQLiteJellyDb) UpsertState(ctx context.Context, server, user string, itemType jellyfin.ItemType, ts time.Time) error {
 	args := generated.UpsertStateParams{
 		Server:   server,
+		User:     user,
 		Type:     string(itemType),
 		LastSync: ts.Unix(),
 	}
@@ -251,9 +501,10 @@ func (q *SQLiteJellyDb) UpsertState(ctx context.Context, server string, itemType
 	return q.generated.UpsertState(ctx, args)
 }
 
-func (q *SQLiteJellyDb) GetState(ctx context.Context, server string, itemType jellyfin.ItemType) (time.Time, error) {
+func (q *SQLiteJellyDb) GetState(ctx context.Context, server, user string, itemType jellyfin.ItemType) (time.Time, error) {
 	arg := generated.GetLastCheckParams{
 		Server: server,
+		User:   user,
 		Type:   string(itemType),
 	}
 	lastSync, err := q.generated.GetLastCheck(ctx, arg)
@@ -264,12 +515,81 @@ func (q *SQLiteJellyDb) GetState(ctx context.Context, server string, itemType je
 	return time.Unix(lastSync, 0), nil
 }
 
+// MarkStale marks the server as stale for the user and type of items, e.g. because the server could not be reached.
+// Items of a stale server are not used as source for other servers until the server is no longer stale.
+func (q *SQLiteJellyDb) MarkStale(ctx context.Context, server, user string, itemType jellyfin.ItemType, since time.Time) error {
+	args := generated.MarkStaleParams{
+		Server: server,
+		User:   user,
+		Type:   string(itemType),
+		Stale:  since.Unix(),
+	}
+
+	return q.generated.MarkStale(ctx, args)
+}
+
+func (q *SQLiteJellyDb) ClearStale(ctx context.Context, server, user string, itemType jellyfin.ItemType) error {
+	args := generated.ClearStaleParams{
+		Server: server,
+		User:   user,
+		Type:   string(itemType),
+	}
+
+	return q.generated.ClearStale(ctx, args)
+}
+
+// IsStale returns whether the server has been marked as stale for the user and type of items.
+func (q *SQLiteJellyDb) IsStale(ctx context.Context, server, user string, itemType jellyfin.ItemType) (bool, error) {
+	arg := generated.GetStaleParams{
+		Server: server,
+		User:   user,
+		Type:   string(itemType),
+	}
+	stale, err := q.generated.GetStale(ctx, arg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return stale > 0, nil
+}
+
+const (
+	ReasonPlayed         = "played"
+	ReasonUnplayed       = "unplayed"
+	ReasonResumePosition = "resume_position"
+	ReasonFavorite       = "favorite"
+	ReasonRevert         = "revert"
+)
+
 type ChangelogData struct {
 	LocalID                 string
 	NewWatchedDate          int64
 	NewWatchedProgress      float64
 	NewWatchedPositionTicks int64
 	NewIsFavorite           bool
+	NewPlayed               bool
+
+	// SourceServer and SourceLocalID identify the item whose UserData has been copied
+	SourceServer  string
+	SourceLocalID string
+
+	// Previous values of the item before it has been updated
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
+
+	// Reason is the reason for the change, one of ReasonPlayed, ReasonUnplayed, ReasonResumePosition, ReasonFavorite or
+	// ReasonRevert
+	Reason string
+
+	// RunID is the ID of the sync run that has made the change
+	RunID string
+	// Reverts is the ID of the changelog entry that is reverted by this change
+	Reverts int64
 }
 
 type ItemWithUpdatedUserData struct {
@@ -280,97 +600,186 @@ type ItemWithUpdatedUserData struct {
 	WatchedProgress      float64
 	WatchedPositionTicks int64
 	IsFavorite           bool
+	Played               bool
+	Runtime              int64
+	PlayCount            int64
+
+	// SourceServer and SourceLocalID identify the item on the server that has the most recent change
+	SourceServer  string
+	SourceLocalID string
+
+	// Previous values of the local item that is updated
+	PreviousWatchedDate          int64
+	PreviousWatchedPositionTicks int64
+	PreviousIsFavorite           bool
+	PreviousPlayed               bool
 }
 
-func (m *ItemWithUpdatedUserData) AsUserData() jellyfin.UserDataUpdate {
-	return jellyfin.UserDataUpdate{
-		PlaybackPositionTicks: &m.WatchedPositionTicks,
-		PlayedPercentage:      &m.WatchedProgress,
-		LastPlayedDate:        time.Unix(m.WatchedDate, 0),
-		Played:                true,
-		IsFavorite:            &m.IsFavorite,
+// Reason returns the reason the item is updated for.
+func (m *ItemWithUpdatedUserData) Reason(finishedThreshold float64) string {
+	if m.IsInProgress(finishedThreshold) {
+		return ReasonResumePosition
+	}
+
+	if m.Played || m.WatchedPositionTicks > 0 {
+		return ReasonPlayed
+	}
+
+	return ReasonUnplayed
+}
+
+// IsInProgress returns true if the item has been started but is not considered finished. An item is considered finished
+// if it has been played or its playback position exceeds the finishedThreshold share of its runtime.
+func (m *ItemWithUpdatedUserData) IsInProgress(finishedThreshold float64) bool {
+	if m.Played || m.WatchedPositionTicks <= 0 {
+		return false
 	}
+
+	if m.Runtime <= 0 {
+		return true
+	}
+
+	return float64(m.WatchedPositionTicks) < float64(m.Runtime)*finishedThreshold
 }
 
-func SanitizeAndParseInt64(input string) int64 {
-	var filtered []rune
-	for _, r := range input {
-		if unicode.IsDigit(r) || r == '-' { // Include digits and negative sign
-			filtered = append(filtered, r)
+// AsUserData returns the UserData to update the item with. Items that are in progress are updated with their resume
+// position and are marked as unplayed, all other items are updated with their played state.
+func (m *ItemWithUpdatedUserData) AsUserData(finishedThreshold float64) jellyfin.UserDataUpdate {
+	var ret jellyfin.UserDataUpdate
+	if m.IsInProgress(finishedThreshold) {
+		played := false
+		ret = jellyfin.UserDataUpdate{
+			PlaybackPositionTicks: &m.WatchedPositionTicks,
+			PlayedPercentage:      &m.WatchedProgress,
+			Played:                &played,
+		}
+	} else {
+		played := m.Played || m.WatchedPositionTicks > 0
+		var position int64 = 0
+		ret = jellyfin.UserDataUpdate{
+			PlaybackPositionTicks: &position,
+			Played:                &played,
 		}
 	}
 
-	cleaned := string(filtered)
-	if cleaned == "" || cleaned == "-" {
-		return 0
+	if m.PlayCount > 0 {
+		playCount := int(m.PlayCount)
+		ret.PlayCount = &playCount
 	}
 
-	result, err := strconv.ParseInt(cleaned, 10, 64)
-	if err != nil {
-		return 0
+	// items that have been marked as unplayed may not have a date they were last played
+	if m.WatchedDate > 0 {
+		lastPlayedDate := time.Unix(m.WatchedDate, 0)
+		ret.LastPlayedDate = &lastPlayedDate
 	}
 
-	return result
+	return ret
+}
+
+// ItemWithUpdatedFavorite is an item whose favorite state has been changed on another server. Besides the favorite
+// state, it carries the unchanged local UserData of the item.
+type ItemWithUpdatedFavorite struct {
+	LocalID              string
+	Name                 string
+	SeriesName           string
+	WatchedDate          int64
+	WatchedProgress      float64
+	WatchedPositionTicks int64
+	Played               bool
+	IsFavorite           bool
+	FavoriteChanged      int64
+
+	// SourceServer and SourceLocalID identify the item on the server that has the most recent change
+	SourceServer       string
+	SourceLocalID      string
+	PreviousIsFavorite bool
 }
 
-func EpisodeToInsertEpisodeParam(server string, episode jellyfin.Item) generated.InsertEpisodeParams {
-	imdbId := SanitizeAndParseInt64(episode.ProviderIDs.IMDB)
-	tmdbId := SanitizeAndParseInt64(episode.ProviderIDs.TMDB)
-	tvdbId := SanitizeAndParseInt64(episode.ProviderIDs.TVDB)
+// AsUserData returns the UserData to update the item with, which only touches the favorite state.
+func (m *ItemWithUpdatedFavorite) AsUserData() jellyfin.UserDataUpdate {
+	return jellyfin.UserDataUpdate{
+		IsFavorite: &m.IsFavorite,
+	}
+}
 
+func EpisodeToInsertEpisodeParam(server, user string, episode jellyfin.Item, matcher *matching.Matcher) generated.InsertEpisodeParams {
 	var watchedDate int64 = 0
 	if !episode.UserData.LastPlayedDate.IsZero() {
 		watchedDate = episode.UserData.LastPlayedDate.Unix()
 	}
+
+	var playedChanged int64 = 0
+	if episode.UserData.Played {
+		playedChanged = watchedDate
+	}
+
+	var favoriteChanged int64 = 0
+	if episode.UserData.IsFavorite {
+		favoriteChanged = time.Now().Unix()
+	}
 	return generated.InsertEpisodeParams{
-		Server:     server,
-		Name:       episode.Name,
-		LocalID:    episode.ID,
-		SeriesName: episode.SeriesName,
-		SeasonName: episode.SeasonName,
-		ImdbID: sql.NullInt64{
-			Int64: imdbId,
-			Valid: imdbId != 0,
-		},
-		TmdbID: sql.NullInt64{
-			Int64: tmdbId,
-			Valid: tmdbId != 0,
-		},
-		TvdbID: sql.NullInt64{
-			Int64: tvdbId,
-			Valid: tvdbId != 0,
-		},
+		Server:               server,
+		User:                 user,
+		Name:                 episode.Name,
+		LocalID:              episode.ID,
+		SeriesName:           episode.SeriesName,
+		SeasonName:           episode.SeasonName,
+		ProviderIds:          providerIDsJSON(episode.ProviderIDs),
+		MatchKey:             matcher.Key(episode),
+		SeasonNumber:         indexNumber(episode.ParentIndexNumber),
+		EpisodeNumber:        indexNumber(episode.IndexNumber),
+		SeriesProviderIds:    providerIDsJSON(episode.SeriesProviderIDs),
 		WatchedDate:          watchedDate,
 		WatchedPositionTicks: episode.UserData.PlaybackPositionTicks,
 		WatchedProgress:      episode.UserData.PlayedPercentage,
 		Runtime:              episode.Runtime,
+		PlayCount:            int64(episode.UserData.PlayCount),
 		IsFavorite:           episode.UserData.IsFavorite,
+		Played:               episode.UserData.Played,
+		PlayedChanged:        playedChanged,
+		FavoriteChanged:      favoriteChanged,
 	}
 }
-func MovieToInsertMovieParam(server string, movie jellyfin.Item) generated.InsertMovieParams {
-	imdbId := SanitizeAndParseInt64(movie.ProviderIDs.IMDB)
-	tmdbId := SanitizeAndParseInt64(movie.ProviderIDs.TMDB)
+
+// indexNumber returns the number of a season or an episode, -1 if it is unknown.
+func indexNumber(number *int) int64 {
+	if number == nil {
+		return -1
+	}
+	return int64(*number)
+}
+
+func MovieToInsertMovieParam(server, user string, movie jellyfin.Item, matcher *matching.Matcher) generated.InsertMovieParams {
 	var watchedDate int64 = 0
 	if !movie.UserData.LastPlayedDate.IsZero() {
 		watchedDate = movie.UserData.LastPlayedDate.Unix()
 	}
+
+	var playedChanged int64 = 0
+	if movie.UserData.Played {
+		playedChanged = watchedDate
+	}
+
+	var favoriteChanged int64 = 0
+	if movie.UserData.IsFavorite {
+		favoriteChanged = time.Now().Unix()
+	}
 	return generated.InsertMovieParams{
-		Server:  server,
-		Name:    movie.Name,
-		LocalID: movie.ID,
-		ImdbID: sql.NullInt64{
-			Int64: imdbId,
-			Valid: imdbId != 0,
-		},
-		TmdbID: sql.NullInt64{
-			Int64: tmdbId,
-			Valid: tmdbId != 0,
-		},
+		Server:               server,
+		User:                 user,
+		Name:                 movie.Name,
+		LocalID:              movie.ID,
+		ProviderIds:          providerIDsJSON(movie.ProviderIDs),
+		MatchKey:             matcher.Key(movie),
 		WatchedDate:          watchedDate,
 		WatchedPositionTicks: movie.UserData.PlaybackPositionTicks,
 		WatchedProgress:      movie.UserData.PlayedPercentage,
 		Runtime:              movie.Runtime,
+		PlayCount:            int64(movie.UserData.PlayCount),
 		IsFavorite:           movie.UserData.IsFavorite,
+		Played:               movie.UserData.Played,
+		PlayedChanged:        playedChanged,
+		FavoriteChanged:      favoriteChanged,
 	}
 }
 
@@ -425,3 +834,21 @@ func (db *SQLiteJellyDb) Migrate(ctx context.Context) error {
 
 	return nil
 }
+
+// Check returns an error if the database can not be queried or has not been migrated to the latest schema version.
+func (db *SQLiteJellyDb) Check(ctx context.Context) error {
+	if schemaVersionReadError != nil {
+		return schemaVersionReadError
+	}
+
+	var currentVersion int
+	if err := db.db.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&currentVersion); err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+
+	if currentVersion < schemaVersion {
+		return fmt.Errorf("schema at version %d, latest schema version is %d", currentVersion, schemaVersion)
+	}
+
+	return nil
+}
@@ -2,14 +2,20 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
 )
 
+const testUser = "soeren"
+
 func TestSQLiteQueue_GetUnwatchedMovies(t *testing.T) {
 	type fields struct {
 		db *SQLiteJellyDb
@@ -161,6 +167,7 @@ func TestSQLiteQueue_GetUnwatchedMovies(t *testing.T) {
 					WatchedDate:          time.Date(2025, 06, 15, 15, 0, 0, 0, time.Now().Location()).Unix(),
 					WatchedProgress:      0.5,
 					WatchedPositionTicks: 12874613523,
+					Runtime:              5000,
 				},
 			},
 			wantErr: false,
@@ -303,6 +310,7 @@ func TestSQLiteQueue_GetUnwatchedMovies(t *testing.T) {
 					WatchedProgress:      0.5,
 					WatchedPositionTicks: 12874613523,
 					IsFavorite:           true,
+					Runtime:              5000,
 				},
 			},
 			wantErr: false,
@@ -442,16 +450,16 @@ func TestSQLiteQueue_GetUnwatchedMovies(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			q := tt.fields.db
 			for key, movie := range tt.input {
-				if err := q.InsertMovies(t.Context(), key, movie); err != nil {
+				if err := q.InsertMovies(t.Context(), key, testUser, movie); err != nil {
 					log.Fatal().Err(err).Msgf("could not insert movie")
 				}
 			}
-			got, err := q.GetMoviesWithUpdatedUserData(tt.args.ctx, tt.args.server)
+			got, err := q.GetMoviesWithUpdatedUserData(tt.args.ctx, tt.args.server, testUser)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetMoviesWithUpdatedUserData() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if got := withoutProvenance(got); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetMoviesWithUpdatedUserData() got = %v, want %v", got, tt.want)
 			}
 		})
@@ -624,6 +632,7 @@ func TestSQLiteQueue_GetUnwatchedEpisodes(t *testing.T) {
 					WatchedProgress:      0.5,
 					WatchedPositionTicks: 12874613523,
 					IsFavorite:           true,
+					Runtime:              5000,
 				},
 			},
 			wantErr: false,
@@ -775,6 +784,7 @@ func TestSQLiteQueue_GetUnwatchedEpisodes(t *testing.T) {
 					WatchedDate:          time.Date(2025, 07, 15, 15, 0, 0, 0, time.Now().Location()).Unix(),
 					WatchedProgress:      0.5,
 					WatchedPositionTicks: 12874613523,
+					Runtime:              5000,
 				},
 			},
 			wantErr: false,
@@ -926,19 +936,1554 @@ func TestSQLiteQueue_GetUnwatchedEpisodes(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			q := tt.fields.db
 			for key, episode := range tt.input {
-				if err := q.InsertEpisodes(t.Context(), key, episode); err != nil {
+				if err := q.InsertEpisodes(t.Context(), key, testUser, episode); err != nil {
 					log.Fatal().Err(err).Msgf("could not insert episode")
 				}
 			}
 
-			got, err := q.GetEpisodesWithUpdatedUserData(tt.args.ctx, tt.args.server)
+			got, err := q.GetEpisodesWithUpdatedUserData(tt.args.ctx, tt.args.server, testUser)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetEpisodesWithUpdatedUserData() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if got := withoutProvenance(got); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("GetEpisodesWithUpdatedUserData() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestSQLiteQueue_GetUpdatedUserDataProvenance(t *testing.T) {
+	before := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	after := time.Date(2025, 07, 15, 15, 0, 0, 0, time.UTC)
+
+	item := func(name, series, id string, watched time.Time, position int64) jellyfin.Item {
+		return jellyfin.Item{
+			Name:       name,
+			SeriesName: series,
+			ID:         id,
+			UserData: jellyfin.UserData{
+				PlaybackPositionTicks: position,
+				PlayedPercentage:      0.5,
+				LastPlayedDate:        watched,
+			},
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+				TMDB: "603",
+			},
+			Runtime: 5000,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		insert func(db *SQLiteJellyDb, server string, items []jellyfin.Item) error
+		get    func(db *SQLiteJellyDb, server string) ([]ItemWithUpdatedUserData, error)
+		input  map[string][]jellyfin.Item
+		want   []ItemWithUpdatedUserData
+	}{
+		{
+			name: "Movie watched on both servers",
+			insert: func(db *SQLiteJellyDb, server string, items []jellyfin.Item) error {
+				return db.InsertMovies(t.Context(), server, testUser, items)
+			},
+			get: func(db *SQLiteJellyDb, server string) ([]ItemWithUpdatedUserData, error) {
+				return db.GetMoviesWithUpdatedUserData(t.Context(), server, testUser)
+			},
+			input: map[string][]jellyfin.Item{
+				"dd": {item("The Matrix", "", "1", before, 0)},
+				"ez": {item("The Matrix", "", "2", after, 12874613523)},
+			},
+			want: []ItemWithUpdatedUserData{
+				{
+					Name:                 "The Matrix",
+					LocalID:              "1",
+					WatchedDate:          after.Unix(),
+					WatchedProgress:      0.5,
+					WatchedPositionTicks: 12874613523,
+					Runtime:              5000,
+					SourceServer:         "ez",
+					SourceLocalID:        "2",
+					PreviousWatchedDate:  before.Unix(),
+				},
+			},
+		},
+		{
+			name: "Movie not watched on the server running the query",
+			insert: func(db *SQLiteJellyDb, server string, items []jellyfin.Item) error {
+				return db.InsertMovies(t.Context(), server, testUser, items)
+			},
+			get: func(db *SQLiteJellyDb, server string) ([]ItemWithUpdatedUserData, error) {
+				return db.GetMoviesWithUpdatedUserData(t.Context(), server, testUser)
+			},
+			input: map[string][]jellyfin.Item{
+				"dd": {item("The Matrix", "", "1", time.Time{}, 0)},
+				"ez": {item("The Matrix", "", "2", after, 12874613523)},
+			},
+			want: []ItemWithUpdatedUserData{
+				{
+					Name:                 "The Matrix",
+					LocalID:              "1",
+					WatchedDate:          after.Unix(),
+					WatchedProgress:      0.5,
+					WatchedPositionTicks: 12874613523,
+					Runtime:              5000,
+					SourceServer:         "ez",
+					SourceLocalID:        "2",
+				},
+			},
+		},
+		{
+			name: "Episode watched on both servers",
+			insert: func(db *SQLiteJellyDb, server string, items []jellyfin.Item) error {
+				return db.InsertEpisodes(t.Context(), server, testUser, items)
+			},
+			get: func(db *SQLiteJellyDb, server string) ([]ItemWithUpdatedUserData, error) {
+				return db.GetEpisodesWithUpdatedUserData(t.Context(), server, testUser)
+			},
+			input: map[string][]jellyfin.Item{
+				"dd": {item("Episode I", "Black Mirror", "1", before, 0)},
+				"ez": {item("Episode I", "Black Mirror", "2", after, 12874613523)},
+			},
+			want: []ItemWithUpdatedUserData{
+				{
+					Name:                 "Episode I",
+					SeriesName:           "Black Mirror",
+					LocalID:              "1",
+					WatchedDate:          after.Unix(),
+					WatchedProgress:      0.5,
+					WatchedPositionTicks: 12874613523,
+					Runtime:              5000,
+					SourceServer:         "ez",
+					SourceLocalID:        "2",
+					PreviousWatchedDate:  before.Unix(),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("")
+			for server, items := range tt.input {
+				if err := tt.insert(db, server, items); err != nil {
+					t.Fatalf("could not insert items: %v", err)
+				}
+			}
+			got, err := tt.get(db, "dd")
+			if err != nil {
+				t.Fatalf("GetUpdatedUserData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUpdatedUserData() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_GetUnwatchedMoviesMultipleUsers(t *testing.T) {
+	db := MustNew("")
+
+	matrix := func(id string, lastPlayed time.Time) jellyfin.Item {
+		return jellyfin.Item{
+			Name: "The Matrix",
+			ID:   id,
+			UserData: jellyfin.UserData{
+				LastPlayedDate: lastPlayed,
+			},
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+			},
+			Runtime: 5000,
+		}
+	}
+
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	input := []struct {
+		server string
+		user   string
+		item   jellyfin.Item
+	}{
+		{server: "dd", user: "alice", item: matrix("1", time.Time{})},
+		{server: "ez", user: "alice", item: matrix("2", time.Time{})},
+		{server: "dd", user: "bob", item: matrix("1", time.Time{})},
+		{server: "ez", user: "bob", item: matrix("2", watched)},
+	}
+	for _, in := range input {
+		if err := db.InsertMovies(t.Context(), in.server, in.user, []jellyfin.Item{in.item}); err != nil {
+			t.Fatalf("could not insert movie: %v", err)
+		}
+	}
+
+	got, err := db.GetMoviesWithUpdatedUserData(t.Context(), "dd", "alice")
+	if err != nil {
+		t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetMoviesWithUpdatedUserData() expected no updates for alice, got %v", got)
+	}
+
+	got, err = db.GetMoviesWithUpdatedUserData(t.Context(), "dd", "bob")
+	if err != nil {
+		t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+	}
+	want := []ItemWithUpdatedUserData{
+		{
+			LocalID:       "1",
+			Name:          "The Matrix",
+			WatchedDate:   watched.Unix(),
+			Runtime:       5000,
+			SourceServer:  "ez",
+			SourceLocalID: "2",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMoviesWithUpdatedUserData() got = %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteQueue_GetUnplayedMovies(t *testing.T) {
+	db := MustNew("")
+
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, played bool) jellyfin.Item {
+		return jellyfin.Item{
+			Name: "The Matrix",
+			ID:   id,
+			UserData: jellyfin.UserData{
+				LastPlayedDate: watched,
+				Played:         played,
+			},
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+			},
+			Runtime: 5000,
+		}
+	}
+
+	servers := map[string]string{"dd": "1", "ez": "2", "pt": "3"}
+	for server, id := range servers {
+		if err := db.InsertMovies(t.Context(), server, testUser, []jellyfin.Item{matrix(id, true)}); err != nil {
+			t.Fatalf("could not insert movie: %v", err)
+		}
+	}
+
+	for server := range servers {
+		got, err := db.GetMoviesWithUpdatedUserData(t.Context(), server, testUser)
+		if err != nil {
+			t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("GetMoviesWithUpdatedUserData() expected no updates for %s, got %v", server, got)
+		}
+	}
+
+	// mark movie as unplayed on a single server
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{matrix("1", false)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+
+	got, err := db.GetMoviesWithUpdatedUserData(t.Context(), "dd", testUser)
+	if err != nil {
+		t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetMoviesWithUpdatedUserData() expected no updates for server that marked the movie as unplayed, got %v", got)
+	}
+
+	for _, server := range []string{"ez", "pt"} {
+		got, err := db.GetMoviesWithUpdatedUserData(t.Context(), server, testUser)
+		if err != nil {
+			t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+		}
+		want := []ItemWithUpdatedUserData{
+			{
+				LocalID:             servers[server],
+				Name:                "The Matrix",
+				WatchedDate:         watched.Unix(),
+				Played:              false,
+				Runtime:             5000,
+				SourceServer:        "dd",
+				SourceLocalID:       "1",
+				PreviousWatchedDate: watched.Unix(),
+				PreviousPlayed:      true,
+			},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetMoviesWithUpdatedUserData() got = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestItemWithUpdatedUserData_AsUserData(t *testing.T) {
+	const runtime = 81600000000
+	ptr := func(b bool) *bool {
+		return &b
+	}
+
+	tests := []struct {
+		name           string
+		item           ItemWithUpdatedUserData
+		wantInProgress bool
+		wantPlayed     *bool
+		wantPosition   int64
+	}{
+		{
+			name: "played",
+			item: ItemWithUpdatedUserData{
+				WatchedDate: 1749999600,
+				Played:      true,
+				Runtime:     runtime,
+			},
+			wantInProgress: false,
+			wantPlayed:     ptr(true),
+			wantPosition:   0,
+		},
+		{
+			name: "unplayed",
+			item: ItemWithUpdatedUserData{
+				WatchedDate: 1749999600,
+				Played:      false,
+				Runtime:     runtime,
+			},
+			wantInProgress: false,
+			wantPlayed:     ptr(false),
+			wantPosition:   0,
+		},
+		{
+			name: "in progress",
+			item: ItemWithUpdatedUserData{
+				WatchedDate:          1749999600,
+				WatchedPositionTicks: runtime / 2,
+				WatchedProgress:      50,
+				Runtime:              runtime,
+			},
+			wantInProgress: true,
+			wantPlayed:     ptr(false),
+			wantPosition:   runtime / 2,
+		},
+		{
+			name: "in progress, unknown runtime",
+			item: ItemWithUpdatedUserData{
+				WatchedDate:          1749999600,
+				WatchedPositionTicks: runtime / 2,
+			},
+			wantInProgress: true,
+			wantPlayed:     ptr(false),
+			wantPosition:   runtime / 2,
+		},
+		{
+			name: "exceeding finished threshold",
+			item: ItemWithUpdatedUserData{
+				WatchedDate:          1749999600,
+				WatchedPositionTicks: runtime / 100 * 95,
+				WatchedProgress:      95,
+				Runtime:              runtime,
+			},
+			wantInProgress: false,
+			wantPlayed:     ptr(true),
+			wantPosition:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.item.IsInProgress(0.9); got != tt.wantInProgress {
+				t.Errorf("IsInProgress() = %v, want %v", got, tt.wantInProgress)
+			}
+
+			got := tt.item.AsUserData(0.9)
+			if !reflect.DeepEqual(got.Played, tt.wantPlayed) {
+				t.Errorf("AsUserData() Played = %v, want %v", *got.Played, *tt.wantPlayed)
+			}
+			if got.PlaybackPositionTicks == nil || *got.PlaybackPositionTicks != tt.wantPosition {
+				t.Errorf("AsUserData() PlaybackPositionTicks = %v, want %v", got.PlaybackPositionTicks, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_GetMoviesWithUpdatedFavorite(t *testing.T) {
+	db := MustNew("")
+
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, favorite bool) jellyfin.Item {
+		return jellyfin.Item{
+			Name: "The Matrix",
+			ID:   id,
+			UserData: jellyfin.UserData{
+				LastPlayedDate: watched,
+				Played:         true,
+				IsFavorite:     favorite,
+			},
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+			},
+			Runtime: 5000,
+		}
+	}
+
+	servers := map[string]string{"dd": "1", "ez": "2", "pt": "3"}
+	for server, id := range servers {
+		if err := db.InsertMovies(t.Context(), server, testUser, []jellyfin.Item{matrix(id, false)}); err != nil {
+			t.Fatalf("could not insert movie: %v", err)
+		}
+	}
+
+	for server := range servers {
+		got, err := db.GetMoviesWithUpdatedFavorite(t.Context(), server, testUser)
+		if err != nil {
+			t.Fatalf("GetMoviesWithUpdatedFavorite() error = %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("GetMoviesWithUpdatedFavorite() expected no updates for %s, got %v", server, got)
+		}
+	}
+
+	// mark movie as favorite on a single server
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{matrix("1", true)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+
+	for _, server := range []string{"ez", "pt"} {
+		got, err := db.GetMoviesWithUpdatedFavorite(t.Context(), server, testUser)
+		if err != nil {
+			t.Fatalf("GetMoviesWithUpdatedFavorite() error = %v", err)
+		}
+		if len(got) != 1 || got[0].LocalID != servers[server] || !got[0].IsFavorite || !got[0].Played || got[0].WatchedDate != watched.Unix() {
+			t.Errorf("GetMoviesWithUpdatedFavorite() expected favorite update for %s, got %v", server, got)
+		}
+	}
+
+	// favorite has been synced to all servers, afterward it's removed on a single server
+	for _, server := range []string{"ez", "pt"} {
+		if err := db.InsertMovies(t.Context(), server, testUser, []jellyfin.Item{matrix(servers[server], true)}); err != nil {
+			t.Fatalf("could not insert movie: %v", err)
+		}
+	}
+	if err := db.InsertMovies(t.Context(), "pt", testUser, []jellyfin.Item{matrix("3", false)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+	if _, err := db.db.ExecContext(t.Context(), `UPDATE movies SET favorite_changed = favorite_changed + 10 WHERE server = 'pt'`); err != nil {
+		t.Fatalf("could not update favorite_changed: %v", err)
+	}
+
+	for _, server := range []string{"dd", "ez"} {
+		got, err := db.GetMoviesWithUpdatedFavorite(t.Context(), server, testUser)
+		if err != nil {
+			t.Fatalf("GetMoviesWithUpdatedFavorite() error = %v", err)
+		}
+		if len(got) != 1 || got[0].LocalID != servers[server] || got[0].IsFavorite {
+			t.Errorf("GetMoviesWithUpdatedFavorite() expected removed favorite for %s, got %v", server, got)
+		}
+	}
+
+	got, err := db.GetMoviesWithUpdatedFavorite(t.Context(), "pt", testUser)
+	if err != nil {
+		t.Fatalf("GetMoviesWithUpdatedFavorite() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("GetMoviesWithUpdatedFavorite() expected removed favorite not to be reverted, got %v", got)
+	}
+}
+
+func TestSQLiteQueue_GetAudioWithUpdatedUserData(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	track := func(id, musicBrainzId string, userData jellyfin.UserData) jellyfin.Item {
+		return jellyfin.Item{
+			Name:        "Paranoid Android",
+			ID:          id,
+			Album:       "OK Computer",
+			AlbumArtist: "Radiohead",
+			UserData:    userData,
+			ProviderIDs: jellyfin.ProviderIDs{
+				MusicBrainzTrack: musicBrainzId,
+			},
+			Runtime: 5000,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input map[string][]jellyfin.Item
+		want  []ItemWithUpdatedUserData
+	}{
+		{
+			name: "Match by MusicBrainz track ID",
+			input: map[string][]jellyfin.Item{
+				"dd": {track("1", "b4cc4ab6-3c5c-4aea-a0b0-5ac4f4da9f3a", jellyfin.UserData{})},
+				"ez": {track("2", "b4cc4ab6-3c5c-4aea-a0b0-5ac4f4da9f3a", jellyfin.UserData{
+					LastPlayedDate: watched,
+					Played:         true,
+					PlayCount:      3,
+				})},
+			},
+			want: []ItemWithUpdatedUserData{
+				{
+					LocalID:       "1",
+					Name:          "Paranoid Android",
+					WatchedDate:   watched.Unix(),
+					Played:        true,
+					Runtime:       5000,
+					PlayCount:     3,
+					SourceServer:  "ez",
+					SourceLocalID: "2",
+				},
+			},
+		},
+		{
+			name: "Match by name, album, album artist and runtime",
+			input: map[string][]jellyfin.Item{
+				"dd": {track("1", "", jellyfin.UserData{})},
+				"ez": {track("2", "", jellyfin.UserData{
+					LastPlayedDate: watched,
+					Played:         true,
+					PlayCount:      1,
+				})},
+			},
+			want: []ItemWithUpdatedUserData{
+				{
+					LocalID:       "1",
+					Name:          "Paranoid Android",
+					WatchedDate:   watched.Unix(),
+					Played:        true,
+					Runtime:       5000,
+					PlayCount:     1,
+					SourceServer:  "ez",
+					SourceLocalID: "2",
+				},
+			},
+		},
+		{
+			name: "Different MusicBrainz track IDs",
+			input: map[string][]jellyfin.Item{
+				"dd": {track("1", "b4cc4ab6-3c5c-4aea-a0b0-5ac4f4da9f3a", jellyfin.UserData{})},
+				"ez": {track("2", "0b7e6a5d-2bfc-4a4d-8d32-fbe7a1f6a6f1", jellyfin.UserData{
+					LastPlayedDate: watched,
+					Played:         true,
+				})},
+			},
+			want: []ItemWithUpdatedUserData{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("")
+			for server, items := range tt.input {
+				if err := db.InsertItems(t.Context(), server, testUser, jellyfin.ItemAudio, items); err != nil {
+					t.Fatalf("could not insert audio: %v", err)
+				}
+			}
+
+			got, err := db.GetItemsWithUpdatedUserData(t.Context(), "dd", testUser, jellyfin.ItemAudio)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetItemsWithUpdatedUserData() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_GetItemDiff(t *testing.T) {
+	db := MustNew("")
+
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	movie := func(id, name, imdb string, userData jellyfin.UserData) jellyfin.Item {
+		return jellyfin.Item{
+			Name:     name,
+			ID:       id,
+			UserData: userData,
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: imdb,
+			},
+			Runtime: 5000,
+		}
+	}
+
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{
+		movie("1", "The Matrix", "133093", jellyfin.UserData{LastPlayedDate: watched, Played: true}),
+		movie("2", "Heat", "113277", jellyfin.UserData{IsFavorite: true}),
+		movie("3", "Alien", "78748", jellyfin.UserData{}),
+	}); err != nil {
+		t.Fatalf("could not insert movies: %v", err)
+	}
+	if err := db.InsertMovies(t.Context(), "ez", testUser, []jellyfin.Item{
+		movie("4", "The Matrix", "133093", jellyfin.UserData{}),
+		movie("5", "Heat", "113277", jellyfin.UserData{IsFavorite: true}),
+		movie("6", "Blade Runner", "83658", jellyfin.UserData{PlaybackPositionTicks: 1000}),
+	}); err != nil {
+		t.Fatalf("could not insert movies: %v", err)
+	}
+
+	got, err := db.GetItemDiff(t.Context(), testUser, "dd", "ez", jellyfin.ItemMovie)
+	if err != nil {
+		t.Fatalf("GetItemDiff() error = %v", err)
+	}
+
+	want := map[string][]string{
+		"Alien":        {DiffMissing},
+		"Blade Runner": {DiffMissing},
+		"Heat":         nil,
+		"The Matrix":   {DiffWatchedState},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetItemDiff() expected %d items, got %v", len(want), got)
+	}
+	for _, diff := range got {
+		if !reflect.DeepEqual(diff.Differences(), want[diff.Name]) {
+			t.Errorf("Differences() of %q got = %v, want %v", diff.Name, diff.Differences(), want[diff.Name])
+		}
+	}
+
+	if got[0].Name != "Alien" || got[0].A.LocalID != "3" || !got[0].B.IsMissing() {
+		t.Errorf("GetItemDiff() expected Alien to be missing on the second server, got %v", got[0])
+	}
+	if got[1].Name != "Blade Runner" || !got[1].A.IsMissing() || got[1].B.WatchedPositionTicks != 1000 {
+		t.Errorf("GetItemDiff() expected Blade Runner to be missing on the first server, got %v", got[1])
+	}
+}
+
+func TestSQLiteQueue_GetItemMatches(t *testing.T) {
+	db := MustNew("")
+
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{
+		{Name: "The Matrix", ID: "1", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093"}, Runtime: 5000},
+		{Name: "Heat", ID: "2", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0113277"}, Runtime: 5000},
+	}); err != nil {
+		t.Fatalf("could not insert movies: %v", err)
+	}
+	if err := db.InsertMovies(t.Context(), "ez", testUser, []jellyfin.Item{
+		{Name: "The Matrix", ID: "3", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093", TMDB: "603"}, Runtime: 5000},
+		{Name: "Alien", ID: "4", Runtime: 5000},
+	}); err != nil {
+		t.Fatalf("could not insert movies: %v", err)
+	}
+
+	matrixKey, err := matching.ProviderKey(matching.ProviderImdb, "tt0133093")
+	if err != nil {
+		t.Fatalf("ProviderKey() error = %v", err)
+	}
+	matrixTmdbKey, err := matching.ProviderKey(matching.ProviderTmdb, "603")
+	if err != nil {
+		t.Fatalf("ProviderKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		server   string
+		localID  string
+		matchKey string
+		want     []ItemMatch
+	}{
+		{
+			name:    "Match by local id",
+			server:  "dd",
+			localID: "1",
+			want: []ItemMatch{
+				{Server: "dd", LocalID: "1", MatchKey: "imdb_tt0133093"},
+				{Server: "ez", LocalID: "3", MatchKey: "imdb_tt0133093"},
+			},
+		},
+		{
+			name:     "Match by provider id",
+			matchKey: matrixKey,
+			want: []ItemMatch{
+				{Server: "dd", LocalID: "1", MatchKey: "imdb_tt0133093"},
+				{Server: "ez", LocalID: "3", MatchKey: "imdb_tt0133093"},
+			},
+		},
+		{
+			name:     "Match by provider id of another strategy",
+			matchKey: matrixTmdbKey,
+			want: []ItemMatch{
+				{Server: "dd", LocalID: "1", MatchKey: "imdb_tt0133093"},
+				{Server: "ez", LocalID: "3", MatchKey: "imdb_tt0133093"},
+			},
+		},
+		{
+			name:    "No other matches",
+			server:  "ez",
+			localID: "4",
+			want: []ItemMatch{
+				{Server: "ez", LocalID: "4", MatchKey: "name_Alien_5000"},
+			},
+		},
+		{
+			name:    "Unknown item",
+			server:  "ez",
+			localID: "1",
+			want:    []ItemMatch{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetItemMatches(t.Context(), testUser, jellyfin.ItemMovie, tt.server, tt.localID, tt.matchKey)
+			if err != nil {
+				t.Fatalf("GetItemMatches() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetItemMatches() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_GetChangelog(t *testing.T) {
+	db := MustNew("")
+
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{
+		{Name: "The Matrix", ID: "1", ProviderIDs: jellyfin.ProviderIDs{IMDB: "133093"}, Runtime: 5000},
+		{Name: "Heat", ID: "2", ProviderIDs: jellyfin.ProviderIDs{IMDB: "113277"}, Runtime: 5000},
+	}); err != nil {
+		t.Fatalf("could not insert movies: %v", err)
+	}
+
+	changes := []ChangelogData{
+		{LocalID: "1", NewWatchedDate: 100, NewPlayed: true, SourceServer: "ez", SourceLocalID: "3", Reason: ReasonPlayed, RunID: "a"},
+		{LocalID: "2", NewWatchedDate: 100, NewPlayed: true, SourceServer: "ez", SourceLocalID: "4", Reason: ReasonPlayed, RunID: "a"},
+		{LocalID: "1", NewWatchedDate: 100, NewPlayed: true, NewIsFavorite: true, SourceServer: "ez", SourceLocalID: "3", PreviousWatchedDate: 100, PreviousPlayed: true, Reason: ReasonFavorite, RunID: "b"},
+	}
+	for _, change := range changes {
+		if err := db.InsertChangelog(t.Context(), "dd", testUser, change); err != nil {
+			t.Fatalf("could not insert changelog: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filter  ChangelogFilter
+		wantIds []int64
+	}{
+		{
+			name:    "No filter",
+			filter:  ChangelogFilter{},
+			wantIds: []int64{3, 2, 1},
+		},
+		{
+			name:    "Filter by name",
+			filter:  ChangelogFilter{Item: "Matrix"},
+			wantIds: []int64{3, 1},
+		},
+		{
+			name:    "Filter by local id",
+			filter:  ChangelogFilter{Item: "2"},
+			wantIds: []int64{2},
+		},
+		{
+			name:    "Filter by changed field",
+			filter:  ChangelogFilter{Item: "Matrix", Field: FieldFavorite},
+			wantIds: []int64{3},
+		},
+		{
+			name:    "Filter by field changed by an earlier entry",
+			filter:  ChangelogFilter{Item: "Matrix", Field: FieldPlayed},
+			wantIds: []int64{1},
+		},
+		{
+			name:    "Filter by unknown server",
+			filter:  ChangelogFilter{Server: "ez"},
+			wantIds: []int64{},
+		},
+		{
+			name:    "Filter by time range",
+			filter:  ChangelogFilter{Until: time.Now().Add(-time.Hour)},
+			wantIds: []int64{},
+		},
+		{
+			name:    "Filter by run id",
+			filter:  ChangelogFilter{RunID: "a"},
+			wantIds: []int64{2, 1},
+		},
+		{
+			name:    "Filter by id range",
+			filter:  ChangelogFilter{FromID: 2, ToID: 3},
+			wantIds: []int64{3, 2},
+		},
+		{
+			name:    "Filter by open id range",
+			filter:  ChangelogFilter{FromID: 3},
+			wantIds: []int64{3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetChangelog(t.Context(), tt.filter)
+			if err != nil {
+				t.Fatalf("GetChangelog() error = %v", err)
+			}
+
+			gotIds := make([]int64, len(got))
+			for idx, entry := range got {
+				gotIds[idx] = entry.ID
+				if entry.SourceServer != "ez" {
+					t.Errorf("GetChangelog() expected source server %q, got %q", "ez", entry.SourceServer)
+				}
+				if entry.Type != string(jellyfin.ItemMovie) {
+					t.Errorf("GetChangelog() expected type %q, got %q", jellyfin.ItemMovie, entry.Type)
+				}
+			}
+			if !reflect.DeepEqual(gotIds, tt.wantIds) {
+				t.Errorf("GetChangelog() got = %v, want %v", gotIds, tt.wantIds)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_GetChangelogRevertedBy(t *testing.T) {
+	db := MustNew("")
+
+	changes := []ChangelogData{
+		{LocalID: "1", NewWatchedDate: 100, NewPlayed: true, Reason: ReasonPlayed, RunID: "a"},
+		{LocalID: "2", NewWatchedDate: 100, NewPlayed: true, Reason: ReasonPlayed, RunID: "a"},
+		{LocalID: "1", PreviousWatchedDate: 100, PreviousPlayed: true, Reason: ReasonRevert, RunID: "b", Reverts: 1},
+	}
+	for _, change := range changes {
+		if err := db.InsertChangelog(t.Context(), "dd", testUser, change); err != nil {
+			t.Fatalf("could not insert changelog: %v", err)
+		}
+	}
+
+	got, err := db.GetChangelog(t.Context(), ChangelogFilter{})
+	if err != nil {
+		t.Fatalf("GetChangelog() error = %v", err)
+	}
+
+	gotRevertedBy := map[int64]int64{}
+	for _, entry := range got {
+		gotRevertedBy[entry.ID] = entry.RevertedBy
+	}
+	if want := map[int64]int64{1: 3, 2: 0, 3: 0}; !reflect.DeepEqual(gotRevertedBy, want) {
+		t.Errorf("GetChangelog() reverted by = %v, want %v", gotRevertedBy, want)
+	}
+}
+
+func TestSQLiteQueue_RevertUserData(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, played, favorite bool) jellyfin.Item {
+		return jellyfin.Item{
+			Name: "The Matrix",
+			ID:   id,
+			UserData: jellyfin.UserData{
+				LastPlayedDate: watched,
+				Played:         played,
+				IsFavorite:     favorite,
+			},
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+			},
+			Runtime: 5000,
+		}
+	}
+	disabled := false
+
+	tests := []struct {
+		name         string
+		revert       bool
+		wantUserData []ItemWithUpdatedUserData
+	}{
+		{
+			name:   "Reverted values are not propagated",
+			revert: true,
+		},
+		{
+			name:   "Values that have not been reverted are propagated",
+			revert: false,
+			wantUserData: []ItemWithUpdatedUserData{
+				{
+					LocalID:             "2",
+					Name:                "The Matrix",
+					WatchedDate:         watched.Unix(),
+					Runtime:             5000,
+					SourceServer:        "dd",
+					SourceLocalID:       "1",
+					PreviousWatchedDate: watched.Unix(),
+					PreviousPlayed:      true,
+					PreviousIsFavorite:  true,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("")
+
+			// the movie has been played and marked as favorite on a server and has been synced to another server
+			if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{matrix("1", true, true)}); err != nil {
+				t.Fatalf("could not insert movie: %v", err)
+			}
+			if err := db.InsertMovies(t.Context(), "ez", testUser, []jellyfin.Item{matrix("2", true, true)}); err != nil {
+				t.Fatalf("could not insert movie: %v", err)
+			}
+
+			if tt.revert {
+				data := jellyfin.UserDataUpdate{Played: &disabled, IsFavorite: &disabled}
+				if err := db.RevertUserData(t.Context(), "dd", testUser, jellyfin.ItemMovie, "1", data); err != nil {
+					t.Fatalf("RevertUserData() error = %v", err)
+				}
+			}
+
+			// the next sync fetches the values that have been restored on the server
+			if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{matrix("1", false, false)}); err != nil {
+				t.Fatalf("could not insert movie: %v", err)
+			}
+
+			gotUserData, err := db.GetMoviesWithUpdatedUserData(t.Context(), "ez", testUser)
+			if err != nil {
+				t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+			}
+			if len(gotUserData) != len(tt.wantUserData) || len(gotUserData) > 0 && !reflect.DeepEqual(gotUserData, tt.wantUserData) {
+				t.Errorf("GetMoviesWithUpdatedUserData() got = %v, want %v", gotUserData, tt.wantUserData)
+			}
+
+			// favorite changes are dated to the second, so only a reverted change is known to never be the newest one
+			if tt.revert {
+				gotFavorite, err := db.GetMoviesWithUpdatedFavorite(t.Context(), "ez", testUser)
+				if err != nil {
+					t.Fatalf("GetMoviesWithUpdatedFavorite() error = %v", err)
+				}
+				if len(gotFavorite) != 0 {
+					t.Errorf("GetMoviesWithUpdatedFavorite() expected no updates for %s, got %v", "ez", gotFavorite)
+				}
+			}
+
+			// the server whose values have been reverted does not receive the values of the other server either
+			gotUserData, err = db.GetMoviesWithUpdatedUserData(t.Context(), "dd", testUser)
+			if err != nil {
+				t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+			}
+			if len(gotUserData) != 0 {
+				t.Errorf("GetMoviesWithUpdatedUserData() expected no updates for %s, got %v", "dd", gotUserData)
+			}
+		})
+	}
+}
+
+func TestSQLiteJellyDb_Check(t *testing.T) {
+	db := MustNew("")
+	// each connection opens a temporary database of its own, so only the migrated connection is used
+	db.db.SetMaxOpenConns(1)
+	if err := db.Check(context.Background()); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	if _, err := db.db.Exec(`UPDATE schema_version SET version = version - 1`); err != nil {
+		t.Fatalf("could not downgrade schema version: %v", err)
+	}
+	if err := db.Check(context.Background()); err == nil {
+		t.Errorf("Check() expected error for outdated schema")
+	}
+}
+
+func TestSQLiteQueue_StaleServers(t *testing.T) {
+	db := MustNew("")
+
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, played bool) jellyfin.Item {
+		item := jellyfin.Item{
+			Name: "The Matrix",
+			ID:   id,
+			ProviderIDs: jellyfin.ProviderIDs{
+				IMDB: "133093",
+			},
+			Runtime: 5000,
+		}
+		if played {
+			item.UserData = jellyfin.UserData{LastPlayedDate: watched, Played: true}
+		}
+		return item
+	}
+
+	if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{matrix("1", true)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+	if err := db.InsertMovies(t.Context(), "ez", testUser, []jellyfin.Item{matrix("2", false)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		stale       []string
+		clear       []string
+		wantUpdates int
+		wantStale   bool
+	}{
+		{
+			name:        "No stale server",
+			wantUpdates: 1,
+		},
+		{
+			name:        "Source server is stale",
+			stale:       []string{"dd"},
+			wantUpdates: 0,
+			wantStale:   true,
+		},
+		{
+			name:        "Marking a stale server again",
+			stale:       []string{"dd"},
+			wantUpdates: 0,
+			wantStale:   true,
+		},
+		{
+			name:        "Target server is stale",
+			stale:       []string{"ez"},
+			clear:       []string{"dd"},
+			wantUpdates: 1,
+		},
+		{
+			name:        "Stale servers have been refreshed",
+			clear:       []string{"ez"},
+			wantUpdates: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, server := range tt.stale {
+				if err := db.MarkStale(t.Context(), server, testUser, jellyfin.ItemMovie, time.Now()); err != nil {
+					t.Fatalf("MarkStale() error = %v", err)
+				}
+			}
+			for _, server := range tt.clear {
+				if err := db.ClearStale(t.Context(), server, testUser, jellyfin.ItemMovie); err != nil {
+					t.Fatalf("ClearStale() error = %v", err)
+				}
+			}
+
+			got, err := db.GetMoviesWithUpdatedUserData(t.Context(), "ez", testUser)
+			if err != nil {
+				t.Fatalf("GetMoviesWithUpdatedUserData() error = %v", err)
+			}
+			if len(got) != tt.wantUpdates {
+				t.Errorf("GetMoviesWithUpdatedUserData() got %d updates, want %d", len(got), tt.wantUpdates)
+			}
+
+			stale, err := db.IsStale(t.Context(), "dd", testUser, jellyfin.ItemMovie)
+			if err != nil {
+				t.Fatalf("IsStale() error = %v", err)
+			}
+			if stale != tt.wantStale {
+				t.Errorf("IsStale() got = %v, want %v", stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_ConflictPolicies(t *testing.T) {
+	earlier := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	played := func(date time.Time, playCount int) jellyfin.UserData {
+		return jellyfin.UserData{LastPlayedDate: date, Played: true, PlayCount: playCount}
+	}
+	inProgress := func(date time.Time, position int64, playCount int) jellyfin.UserData {
+		return jellyfin.UserData{LastPlayedDate: date, PlaybackPositionTicks: position, PlayCount: playCount}
+	}
+
+	type want struct {
+		source   string
+		played   bool
+		position int64
+	}
+
+	tests := []struct {
+		name    string
+		policy  ConflictPolicy
+		servers map[string]jellyfin.UserData
+		// want is nil if the local item is not expected to be updated
+		want *want
+	}{
+		{
+			name:    "latest: most recent change wins",
+			policy:  DefaultConflictPolicy,
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 1), "fx": inProgress(later, 1000, 0)},
+			want:    &want{source: "fx", position: 1000},
+		},
+		{
+			name:    "latest: older remote change loses",
+			policy:  DefaultConflictPolicy,
+			servers: map[string]jellyfin.UserData{"dd": inProgress(later, 2000, 0), "ez": played(earlier, 1)},
+		},
+		{
+			name:    "furthest_position: furthest position wins over more recent change",
+			policy:  ConflictPolicy{Strategy: ConflictFurthestPosition},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": inProgress(earlier, 3000, 0), "fx": inProgress(later, 1000, 0)},
+			want:    &want{source: "ez", position: 3000},
+		},
+		{
+			name:    "furthest_position: played wins over any position",
+			policy:  ConflictPolicy{Strategy: ConflictFurthestPosition},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 1), "fx": inProgress(later, 4000, 0)},
+			want:    &want{source: "ez", played: true},
+		},
+		{
+			name:    "furthest_position: local position is further",
+			policy:  ConflictPolicy{Strategy: ConflictFurthestPosition},
+			servers: map[string]jellyfin.UserData{"dd": inProgress(earlier, 5000, 0), "ez": inProgress(later, 1000, 0)},
+		},
+		{
+			name:    "played: played on any server wins",
+			policy:  ConflictPolicy{Strategy: ConflictPlayed},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 1), "fx": inProgress(later, 1000, 0)},
+			want:    &want{source: "ez", played: true},
+		},
+		{
+			name:    "played: local played state is kept",
+			policy:  ConflictPolicy{Strategy: ConflictPlayed},
+			servers: map[string]jellyfin.UserData{"dd": played(earlier, 1), "ez": inProgress(later, 1000, 0)},
+		},
+		{
+			name:    "played: unplayed items fall back to the most recent change",
+			policy:  ConflictPolicy{Strategy: ConflictPlayed},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": inProgress(earlier, 2000, 0), "fx": inProgress(later, 1000, 0)},
+			want:    &want{source: "fx", position: 1000},
+		},
+		{
+			name:    "primary: primary wins over more recent change",
+			policy:  ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: "ez"},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 1), "fx": inProgress(later, 1000, 0)},
+			want:    &want{source: "ez", played: true},
+		},
+		{
+			name:    "primary: primary overrides more recent local change",
+			policy:  ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: "ez"},
+			servers: map[string]jellyfin.UserData{"dd": inProgress(later, 1000, 0), "ez": played(earlier, 1)},
+			want:    &want{source: "ez", played: true},
+		},
+		{
+			name:    "primary: unchanged item on primary falls back to the most recent change",
+			policy:  ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: "ez"},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": {}, "fx": played(earlier, 1)},
+			want:    &want{source: "fx", played: true},
+		},
+		{
+			name:    "primary: primary is not updated",
+			policy:  ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: "dd"},
+			servers: map[string]jellyfin.UserData{"dd": played(earlier, 1), "ez": inProgress(later, 1000, 0)},
+		},
+		{
+			name:    "max_play_count: highest play count wins",
+			policy:  ConflictPolicy{Strategy: ConflictMaxPlayCount},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 3), "fx": inProgress(later, 1000, 1)},
+			want:    &want{source: "ez", played: true},
+		},
+		{
+			name:    "max_play_count: local play count is higher",
+			policy:  ConflictPolicy{Strategy: ConflictMaxPlayCount},
+			servers: map[string]jellyfin.UserData{"dd": played(earlier, 5), "ez": inProgress(later, 1000, 2)},
+		},
+		{
+			name:    "max_play_count: same play count falls back to the most recent change",
+			policy:  ConflictPolicy{Strategy: ConflictMaxPlayCount},
+			servers: map[string]jellyfin.UserData{"dd": {}, "ez": played(earlier, 2), "fx": inProgress(later, 1000, 2)},
+			want:    &want{source: "fx", position: 1000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("", WithConflictPolicy(jellyfin.ItemMovie, tt.policy))
+			for server, userData := range tt.servers {
+				movie := jellyfin.Item{
+					Name:        "The Matrix",
+					ID:          server + "-1",
+					ProviderIDs: jellyfin.ProviderIDs{IMDB: "133093"},
+					Runtime:     5000,
+					UserData:    userData,
+				}
+				if err := db.InsertMovies(t.Context(), server, testUser, []jellyfin.Item{movie}); err != nil {
+					t.Fatalf("could not insert movie: %v", err)
+				}
+			}
+
+			got, err := db.GetItemsWithUpdatedUserData(t.Context(), "dd", testUser, jellyfin.ItemMovie)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+			}
+			if tt.want == nil {
+				if len(got) != 0 {
+					t.Errorf("GetItemsWithUpdatedUserData() expected no updates, got %v", got)
+				}
+				return
+			}
+
+			if len(got) != 1 {
+				t.Fatalf("GetItemsWithUpdatedUserData() expected a single update, got %v", got)
+			}
+			if got[0].SourceServer != tt.want.source || got[0].Played != tt.want.played || got[0].WatchedPositionTicks != tt.want.position {
+				t.Errorf("GetItemsWithUpdatedUserData() got source = %s, played = %v, position = %d, want %v", got[0].SourceServer, got[0].Played, got[0].WatchedPositionTicks, *tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		strategy      string
+		primaryServer string
+		want          ConflictPolicy
+		wantErr       bool
+	}{
+		{
+			name: "Default",
+			want: DefaultConflictPolicy,
+		},
+		{
+			name:     "Played",
+			strategy: "played",
+			want:     ConflictPolicy{Strategy: ConflictPlayed},
+		},
+		{
+			name:          "Primary",
+			strategy:      "primary",
+			primaryServer: "dd",
+			want:          ConflictPolicy{Strategy: ConflictPrimary, PrimaryServer: "dd"},
+		},
+		{
+			name:     "Primary without server",
+			strategy: "primary",
+			wantErr:  true,
+		},
+		{
+			name:          "Primary server without primary strategy",
+			strategy:      "latest",
+			primaryServer: "dd",
+			wantErr:       true,
+		},
+		{
+			name:     "Unknown",
+			strategy: "oldest",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConflictPolicy(tt.strategy, tt.primaryServer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConflictPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseConflictPolicy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_ReplicationSources(t *testing.T) {
+	earlier := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	servers := map[string]jellyfin.UserData{
+		"main":  {LastPlayedDate: earlier, Played: true},
+		"kids":  {IsFavorite: true},
+		"other": {LastPlayedDate: later, PlaybackPositionTicks: 1000},
+	}
+
+	tests := []struct {
+		name    string
+		sources map[string][]string
+		target  string
+		// wantSource is the server the played state is copied from, empty if no update is expected
+		wantSource    string
+		wantFavorites int
+	}{
+		{
+			name:          "All servers are sources",
+			target:        "main",
+			wantSource:    "other",
+			wantFavorites: 1,
+		},
+		{
+			name:          "Only allowed source is considered",
+			sources:       map[string][]string{"kids": {"main"}},
+			target:        "kids",
+			wantSource:    "main",
+			wantFavorites: 0,
+		},
+		{
+			name:          "Target without sources",
+			sources:       map[string][]string{"main": {}},
+			target:        "main",
+			wantFavorites: 0,
+		},
+		{
+			name:          "Source that is not allowed to send favorites",
+			sources:       map[string][]string{"main": {"other"}},
+			target:        "main",
+			wantSource:    "other",
+			wantFavorites: 0,
+		},
+		{
+			name:          "Unlisted target receives from all servers",
+			sources:       map[string][]string{"kids": {"main"}},
+			target:        "main",
+			wantSource:    "other",
+			wantFavorites: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("", WithReplicationSources(tt.sources))
+			for server, userData := range servers {
+				movie := jellyfin.Item{
+					Name:        "The Matrix",
+					ID:          server + "-1",
+					ProviderIDs: jellyfin.ProviderIDs{IMDB: "133093"},
+					Runtime:     5000,
+					UserData:    userData,
+				}
+				if err := db.InsertMovies(t.Context(), server, testUser, []jellyfin.Item{movie}); err != nil {
+					t.Fatalf("could not insert movie: %v", err)
+				}
+			}
+
+			got, err := db.GetItemsWithUpdatedUserData(t.Context(), tt.target, testUser, jellyfin.ItemMovie)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+			}
+			if tt.wantSource == "" && len(got) != 0 {
+				t.Errorf("GetItemsWithUpdatedUserData() expected no updates, got %v", got)
+			}
+			if tt.wantSource != "" && (len(got) != 1 || got[0].SourceServer != tt.wantSource) {
+				t.Errorf("GetItemsWithUpdatedUserData() expected a single update from %s, got %v", tt.wantSource, got)
+			}
+
+			favorites, err := db.GetItemsWithUpdatedFavorite(t.Context(), tt.target, testUser, jellyfin.ItemMovie)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedFavorite() error = %v", err)
+			}
+			if len(favorites) != tt.wantFavorites {
+				t.Errorf("GetItemsWithUpdatedFavorite() got %d updates, want %d", len(favorites), tt.wantFavorites)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_MatchPriority(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		priority []string
+		wantErr  bool
+		want     int
+	}{
+		{
+			name: "Default priority matches by the differing IMDB IDs",
+			want: 0,
+		},
+		{
+			name:     "Matching by TMDB ID",
+			priority: []string{"tmdb", "imdb"},
+			want:     1,
+		},
+		{
+			name:     "Series strategy is not supported for movies",
+			priority: []string{"series_tmdb"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := New("", WithMatchPriority(jellyfin.ItemMovie, tt.priority))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if err := db.InsertMovies(t.Context(), "dd", testUser, []jellyfin.Item{
+				{Name: "The Matrix", ID: "1", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093", TMDB: "603"}, Runtime: 5000},
+			}); err != nil {
+				t.Fatalf("could not insert movies: %v", err)
+			}
+			if err := db.InsertMovies(t.Context(), "ez", testUser, []jellyfin.Item{
+				{Name: "The Matrix", ID: "2", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt133093", TMDB: "603"}, Runtime: 5000, UserData: jellyfin.UserData{LastPlayedDate: watched, Played: true}},
+			}); err != nil {
+				t.Fatalf("could not insert movies: %v", err)
+			}
+
+			got, err := db.GetItemsWithUpdatedUserData(t.Context(), "dd", testUser, jellyfin.ItemMovie)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("GetItemsWithUpdatedUserData() got %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_EpisodeFuzzyMatch(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	minute := int64(time.Minute / 100)
+	number := func(n int) *int {
+		return &n
+	}
+
+	tests := []struct {
+		name   string
+		local  jellyfin.Item
+		remote jellyfin.Item
+		want   int
+	}{
+		{
+			name:   "Slightly different runtime",
+			local:  jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 58 * minute},
+			remote: jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 58*minute + 30*minute/60},
+			want:   1,
+		},
+		{
+			name:   "Runtime exceeds tolerance",
+			local:  jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 58 * minute},
+			remote: jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 60 * minute},
+			want:   0,
+		},
+		{
+			name:   "Localized season and episode names",
+			local:  jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", ParentIndexNumber: number(1), IndexNumber: number(1), Runtime: 58 * minute},
+			remote: jellyfin.Item{Name: "Der Einstieg", SeriesName: "Breaking Bad", SeasonName: "Staffel 1", ParentIndexNumber: number(1), IndexNumber: number(1), Runtime: 58*minute + 10},
+			want:   1,
+		},
+		{
+			name:   "Different episode numbers",
+			local:  jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", ParentIndexNumber: number(1), IndexNumber: number(1), Runtime: 58 * minute},
+			remote: jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", ParentIndexNumber: number(1), IndexNumber: number(2), Runtime: 58 * minute},
+			want:   0,
+		},
+		{
+			name:   "Different series",
+			local:  jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 58 * minute},
+			remote: jellyfin.Item{Name: "Pilot", SeriesName: "Better Call Saul", SeasonName: "Season 1", Runtime: 58 * minute},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := MustNew("")
+
+			tt.local.ID = "1"
+			if err := db.InsertEpisodes(t.Context(), "dd", testUser, []jellyfin.Item{tt.local}); err != nil {
+				t.Fatalf("could not insert episode: %v", err)
+			}
+			tt.remote.ID = "2"
+			tt.remote.UserData = jellyfin.UserData{LastPlayedDate: watched, Played: true}
+			if err := db.InsertEpisodes(t.Context(), "ez", testUser, []jellyfin.Item{tt.remote}); err != nil {
+				t.Fatalf("could not insert episode: %v", err)
+			}
+
+			got, err := db.GetItemsWithUpdatedUserData(t.Context(), "dd", testUser, jellyfin.ItemEpisode)
+			if err != nil {
+				t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("GetItemsWithUpdatedUserData() got %d items, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteQueue_EpisodeSeriesMatch(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	season, episode := 1, 1
+
+	db := MustNew("")
+	if err := db.InsertEpisodes(t.Context(), "dd", testUser, []jellyfin.Item{
+		{Name: "Pilot", ID: "1", SeriesName: "Breaking Bad", SeasonName: "Season 1", SeriesProviderIDs: jellyfin.ProviderIDs{TVDB: "81189"}, ParentIndexNumber: &season, IndexNumber: &episode, Runtime: 5000},
+	}); err != nil {
+		t.Fatalf("could not insert episode: %v", err)
+	}
+	if err := db.InsertEpisodes(t.Context(), "ez", testUser, []jellyfin.Item{
+		{Name: "Der Einstieg", ID: "2", SeriesName: "Breaking Bad", SeasonName: "Staffel 1", SeriesProviderIDs: jellyfin.ProviderIDs{TVDB: "81189"}, ParentIndexNumber: &season, IndexNumber: &episode, Runtime: 9000, UserData: jellyfin.UserData{LastPlayedDate: watched, Played: true}},
+	}); err != nil {
+		t.Fatalf("could not insert episode: %v", err)
+	}
+
+	got, err := db.GetItemMatches(t.Context(), testUser, jellyfin.ItemEpisode, "dd", "1", "")
+	if err != nil {
+		t.Fatalf("GetItemMatches() error = %v", err)
+	}
+	want := []ItemMatch{
+		{Server: "dd", LocalID: "1", MatchKey: "series_tvdb_81189_s1_e1"},
+		{Server: "ez", LocalID: "2", MatchKey: "series_tvdb_81189_s1_e1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetItemMatches() got = %v, want %v", got, want)
+	}
+}
+
+func TestSQLiteJellyDb_MigrateMatchKeys(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "jellyporter.db")
+
+	// set up the schema that precedes the migration to match keys
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	migrations, err := GetMigrations()
+	if err != nil {
+		t.Fatalf("GetMigrations() error = %v", err)
+	}
+	statements := append(slices.Clone(migrations[:8]),
+		`INSERT INTO schema_version (version) VALUES (8)`,
+		`INSERT INTO state (server, user, type, last_sync, stale) VALUES ('ez', 'soeren', 'Movie', 1750000000, 0)`,
+		`INSERT INTO state (server, user, type, last_sync, stale) VALUES ('ez', 'soeren', 'Episode', 1750000000, 0)`,
+		`INSERT INTO state (server, user, type, last_sync, stale) VALUES ('dd', 'soeren', 'Movie', 1749000000, 1749500000)`,
+		`INSERT INTO state (server, user, type, last_sync, stale) VALUES ('dd', 'soeren', 'Episode', 1749000000, 1749500000)`,
+		`INSERT INTO movies (server, user, local_id, name, imdb_id, runtime, watched_date, watched_progress, watched_position_ticks, is_favorite, last_seen)
+		 VALUES ('ez', 'soeren', 'abc', 'The Matrix', 133093, 5000, 0, 0, 0, false, 1750000000)`,
+	)
+	for _, statement := range statements {
+		if _, err := raw.Exec(statement); err != nil {
+			t.Fatalf("could not execute %q: %v", statement, err)
+		}
+	}
+	if err := raw.Close(); err != nil {
+		t.Fatalf("could not close database: %v", err)
+	}
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.db.Close()
+	})
+
+	var matchKey string
+	if err := db.db.QueryRow(`SELECT match_key FROM movies WHERE local_id = 'abc'`).Scan(&matchKey); err != nil {
+		t.Fatalf("could not query match key: %v", err)
+	}
+	if want := "unmatched_ez_abc"; matchKey != want {
+		t.Errorf("match key = %q, want %q", matchKey, want)
+	}
+
+	// servers that are not stale fetch all items by the next sync, stale servers keep being stale
+	for _, itemType := range []jellyfin.ItemType{jellyfin.ItemMovie, jellyfin.ItemEpisode} {
+		if _, err := db.GetState(context.Background(), "ez", testUser, itemType); err == nil {
+			t.Errorf("GetState(ez, %s) expected state to be reset", itemType)
+		}
+	}
+	for _, itemType := range []jellyfin.ItemType{jellyfin.ItemMovie, jellyfin.ItemEpisode} {
+		stale, err := db.IsStale(context.Background(), "dd", testUser, itemType)
+		if err != nil {
+			t.Fatalf("IsStale() error = %v", err)
+		}
+		if !stale {
+			t.Errorf("IsStale(dd, %s) = false, stale flag has been lost by the migrations", itemType)
+		}
+	}
+}
+
+// withoutProvenance clears the fields that describe the source and the previous values of the updates, which are
+// covered by TestSQLiteQueue_GetUpdatedUserDataProvenance.
+func withoutProvenance(items []ItemWithUpdatedUserData) []ItemWithUpdatedUserData {
+	for idx := range items {
+		items[idx].SourceServer = ""
+		items[idx].SourceLocalID = ""
+		items[idx].PreviousWatchedDate = 0
+		items[idx].PreviousWatchedPositionTicks = 0
+		items[idx].PreviousIsFavorite = false
+		items[idx].PreviousPlayed = false
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+// PlannedUpdate is a single field of an item's UserData that would be updated on a server.
+type PlannedUpdate struct {
+	Server     string            `json:"server"`
+	User       string            `json:"user"`
+	Type       jellyfin.ItemType `json:"type"`
+	LocalID    string            `json:"local_id"`
+	Name       string            `json:"name"`
+	SeriesName string            `json:"series_name,omitempty"`
+	Field      string            `json:"field"`
+	Value      string            `json:"value"`
+}
+
+// PlannedUpdates returns the updates that have been planned during the last sync in dry run mode.
+func (a *App) PlannedUpdates() []PlannedUpdate {
+	a.plannedMutex.Lock()
+	defer a.plannedMutex.Unlock()
+
+	ret := make([]PlannedUpdate, len(a.planned))
+	copy(ret, a.planned)
+	return ret
+}
+
+func (a *App) planUpdate(server, user string, itemType jellyfin.ItemType, localID, name, seriesName string, data jellyfin.UserDataUpdate) {
+	a.plannedMutex.Lock()
+	defer a.plannedMutex.Unlock()
+
+	a.planned = append(a.planned, getPlannedUpdates(server, user, itemType, localID, name, seriesName, data)...)
+}
+
+// getPlannedUpdates returns a PlannedUpdate for each field that is set in the given UserData.
+func getPlannedUpdates(server, user string, itemType jellyfin.ItemType, localID, name, seriesName string, data jellyfin.UserDataUpdate) []PlannedUpdate {
+	var ret []PlannedUpdate
+	for _, field := range getUpdatedFields(data) {
+		ret = append(ret, PlannedUpdate{
+			Server:     server,
+			User:       user,
+			Type:       itemType,
+			LocalID:    localID,
+			Name:       name,
+			SeriesName: seriesName,
+			Field:      field.name,
+			Value:      field.value,
+		})
+	}
+	return ret
+}
+
+func (a *App) resetPlannedUpdates() {
+	a.plannedMutex.Lock()
+	defer a.plannedMutex.Unlock()
+
+	a.planned = nil
+}
+
+type updatedField struct {
+	name  string
+	value string
+}
+
+// getUpdatedFields returns the name and the value of each field that is set in the given UserData.
+func getUpdatedFields(data jellyfin.UserDataUpdate) []updatedField {
+	var ret []updatedField
+	if data.Played != nil {
+		ret = append(ret, updatedField{"Played", strconv.FormatBool(*data.Played)})
+	}
+	if data.PlaybackPositionTicks != nil {
+		ret = append(ret, updatedField{"PlaybackPositionTicks", strconv.FormatInt(*data.PlaybackPositionTicks, 10)})
+	}
+	if data.PlayedPercentage != nil {
+		ret = append(ret, updatedField{"PlayedPercentage", fmt.Sprintf("%.2f", *data.PlayedPercentage)})
+	}
+	if data.PlayCount != nil {
+		ret = append(ret, updatedField{"PlayCount", strconv.Itoa(*data.PlayCount)})
+	}
+	if data.LastPlayedDate != nil {
+		ret = append(ret, updatedField{"LastPlayedDate", data.LastPlayedDate.Format(time.RFC3339)})
+	}
+	if data.IsFavorite != nil {
+		ret = append(ret, updatedField{"IsFavorite", strconv.FormatBool(*data.IsFavorite)})
+	}
+	return ret
+}
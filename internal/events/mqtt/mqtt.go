@@ -0,0 +1,242 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+	"go.uber.org/multierr"
+)
+
+const (
+	eventSourceName     = "mqtt"
+	defaultClientID     = "jellyporter"
+	defaultKeepAlive    = 30 * time.Second
+	defaultMinBackoff   = 1 * time.Second
+	defaultMaxBackoff   = 2 * time.Minute
+	connectTimeout      = 10 * time.Second
+	eventDeliverTimeout = 500 * time.Millisecond
+	// disconnectQuiesce is the time in milliseconds to wait for pending work before disconnecting
+	disconnectQuiesce = 250
+	// subscribeFailure is the return code of a SUBACK packet for a rejected subscription
+	subscribeFailure byte = 0x80
+)
+
+// MqttSource subscribes to topics of a MQTT broker and turns each message into a sync request. Messages that contain a
+// payload of the Jellyfin Webhook plugin only sync the item they refer to.
+type MqttSource struct {
+	address string
+	useTLS  bool
+	topics  []string
+
+	// optional
+	clientID   string
+	username   string
+	password   string
+	qos        byte
+	keepAlive  time.Duration
+	tlsConfig  *tls.Config
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type MqttSourceOpts func(*MqttSource) error
+
+// New returns a MQTT event source for the given broker. The broker is expected as URL with one of the schemes tcp,
+// mqtt, ssl, tls or mqtts, e.g. "tcp://localhost:1883".
+func New(broker string, topics []string, opts ...MqttSourceOpts) (*MqttSource, error) {
+	if len(broker) == 0 {
+		return nil, errors.New("empty broker provided")
+	}
+
+	if len(topics) == 0 {
+		return nil, errors.New("no topics provided")
+	}
+
+	parsed, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker: %w", err)
+	}
+
+	m := &MqttSource{
+		address:    parsed.Host,
+		topics:     topics,
+		clientID:   defaultClientID,
+		keepAlive:  defaultKeepAlive,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+
+	switch parsed.Scheme {
+	case "tcp", "mqtt":
+		if parsed.Port() == "" {
+			m.address = net.JoinHostPort(parsed.Hostname(), "1883")
+		}
+	case "ssl", "tls", "mqtts":
+		m.useTLS = true
+		if parsed.Port() == "" {
+			m.address = net.JoinHostPort(parsed.Hostname(), "8883")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme: %q", parsed.Scheme)
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	if m.tlsConfig != nil {
+		m.useTLS = true
+	}
+
+	return m, errs
+}
+
+func (m *MqttSource) Listen(ctx context.Context, eventChan chan events.EventSyncRequest, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	defer wg.Done()
+
+	client := paho.NewClient(m.clientOptions(ctx, eventChan))
+	defer client.Disconnect(disconnectQuiesce)
+
+	// lost connections are re-established by the client, only the first connection is retried here
+	backoff := m.minBackoff
+	for {
+		err := waitFor(ctx, client.Connect())
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			break
+		}
+
+		metrics.EventSourceErrorsTotal.WithLabelValues(eventSourceName).Inc()
+		log.Error().Err(err).Str("broker", m.address).Dur("backoff", backoff).Msg("Could not connect to MQTT broker, retrying")
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, m.maxBackoff)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (m *MqttSource) clientOptions(ctx context.Context, eventChan chan events.EventSyncRequest) *paho.ClientOptions {
+	scheme := "tcp"
+	if m.useTLS {
+		scheme = "ssl"
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(scheme + "://" + m.address).
+		SetClientID(m.clientID).
+		SetUsername(m.username).
+		SetPassword(m.password).
+		SetKeepAlive(m.keepAlive).
+		SetConnectTimeout(connectTimeout).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(m.maxBackoff)
+
+	if m.useTLS {
+		tlsConfig := m.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		metrics.EventSourceErrorsTotal.WithLabelValues(eventSourceName).Inc()
+		log.Error().Err(err).Str("broker", m.address).Msg("Lost connection to MQTT broker, reconnecting")
+	})
+
+	// the session is not persisted by the broker, so the topics are subscribed to again after each reconnect
+	opts.SetOnConnectHandler(func(client paho.Client) {
+		if err := m.subscribe(ctx, client, eventChan); err != nil {
+			metrics.EventSourceErrorsTotal.WithLabelValues(eventSourceName).Inc()
+			log.Error().Err(err).Str("broker", m.address).Strs("topics", m.topics).Msg("Could not subscribe to MQTT topics")
+			return
+		}
+		log.Info().Str("broker", m.address).Strs("topics", m.topics).Msg("Subscribed to MQTT topics")
+	})
+
+	return opts
+}
+
+func (m *MqttSource) subscribe(ctx context.Context, client paho.Client, eventChan chan events.EventSyncRequest) error {
+	filters := make(map[string]byte, len(m.topics))
+	for _, topic := range m.topics {
+		filters[topic] = m.qos
+	}
+
+	token := client.SubscribeMultiple(filters, func(_ paho.Client, msg paho.Message) {
+		m.handleMessage(ctx, eventChan, msg.Topic(), msg.Payload())
+	})
+	if err := waitFor(ctx, token); err != nil {
+		return err
+	}
+
+	subscribeToken, ok := token.(*paho.SubscribeToken)
+	if !ok {
+		return nil
+	}
+
+	var errs error
+	for topic, code := range subscribeToken.Result() {
+		if code == subscribeFailure {
+			errs = multierr.Append(errs, fmt.Errorf("subscription to topic %q has been rejected", topic))
+		}
+	}
+	return errs
+}
+
+// waitFor waits until the token has completed or the context is canceled.
+func waitFor(ctx context.Context, token paho.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *MqttSource) handleMessage(ctx context.Context, eventChan chan events.EventSyncRequest, topic string, data []byte) {
+	syncRequest := events.EventSyncRequest{
+		Source:   eventSourceName,
+		Metadata: topic,
+		// the result is not awaited, so the app must not block when responding
+		Response: make(chan error, 1),
+	}
+
+	payload, err := events.ParseJellyfinPayload(data)
+	if err != nil {
+		log.Warn().Err(err).Str("topic", topic).Msg("Could not parse MQTT payload, requesting full sync")
+	} else {
+		payload.ApplyTo(&syncRequest)
+	}
+
+	select {
+	case eventChan <- syncRequest:
+		log.Debug().Str("topic", topic).Str("item", syncRequest.ItemID).Msg("Received MQTT message")
+	case <-time.After(eventDeliverTimeout):
+		log.Warn().Str("topic", topic).Msg("Dropping MQTT message, sync is busy")
+	case <-ctx.Done():
+	}
+}
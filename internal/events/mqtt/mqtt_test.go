@@ -0,0 +1,196 @@
+package mqtt
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/soerenschneider/jellyporter/internal/events"
+)
+
+const testTopic = "jellyfin/events"
+
+// newBroker starts an embedded MQTT broker that allows all clients, or only the given user if username is not empty.
+func newBroker(t *testing.T, username, password string) (*mochi.Server, string) {
+	t.Helper()
+
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	var err error
+	if username == "" {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	} else {
+		err = server.AddHook(new(auth.Hook), &auth.Options{
+			Ledger: &auth.Ledger{
+				Auth: auth.AuthRules{
+					{Username: auth.RString(username), Password: auth.RString(password), Allow: true},
+				},
+			},
+		})
+	}
+	if err != nil {
+		t.Fatalf("could not add auth hook: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	if err := server.AddListener(listeners.NewNet("test", listener)); err != nil {
+		t.Fatalf("could not add listener: %v", err)
+	}
+
+	go func() {
+		_ = server.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return server, "tcp://" + listener.Addr().String()
+}
+
+// waitForSubscription waits until the client is connected to the broker and has subscribed to the test topic.
+func waitForSubscription(t *testing.T, server *mochi.Server, previous *mochi.Client) *mochi.Client {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		client, found := server.Clients.Get(defaultClientID)
+		if found && client != previous && !client.Closed() {
+			if _, subscribed := client.State.Subscriptions.Get(testTopic); subscribed {
+				return client
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("client did not subscribe to topic")
+	return nil
+}
+
+func TestMqttSource_Listen(t *testing.T) {
+	payload := []byte(`{"NotificationType": "UserDataSaved", "ItemId": "abc", "UserId": "user", "ServerId": "server"}`)
+
+	tests := []struct {
+		name      string
+		reconnect bool
+		auth      bool
+		qos       int
+		payload   []byte
+		want      events.EventSyncRequest
+	}{
+		{
+			name:    "Targeted sync request",
+			payload: payload,
+			want:    events.EventSyncRequest{Source: eventSourceName, Metadata: testTopic, ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name:    "Full sync request",
+			payload: []byte("sync"),
+			want:    events.EventSyncRequest{Source: eventSourceName, Metadata: testTopic},
+		},
+		{
+			name:    "QoS 1",
+			qos:     1,
+			payload: payload,
+			want:    events.EventSyncRequest{Source: eventSourceName, Metadata: testTopic, ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name:      "Resubscribe after reconnect",
+			reconnect: true,
+			payload:   payload,
+			want:      events.EventSyncRequest{Source: eventSourceName, Metadata: testTopic, ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name:    "Authentication",
+			auth:    true,
+			payload: payload,
+			want:    events.EventSyncRequest{Source: eventSourceName, Metadata: testTopic, ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []MqttSourceOpts{WithQoS(tt.qos), WithBackoff(10*time.Millisecond, 50*time.Millisecond)}
+			var server *mochi.Server
+			var url string
+			if tt.auth {
+				server, url = newBroker(t, "jellyporter", "secret")
+				opts = append(opts, WithAuth("jellyporter", "secret"))
+			} else {
+				server, url = newBroker(t, "", "")
+			}
+
+			source, err := New(url, []string{testTopic}, opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			ctx := t.Context()
+			eventChan := make(chan events.EventSyncRequest)
+			wg := &sync.WaitGroup{}
+			go func() {
+				if err := source.Listen(ctx, eventChan, wg); err != nil {
+					t.Errorf("Listen() error = %v", err)
+				}
+			}()
+
+			client := waitForSubscription(t, server, nil)
+			if tt.reconnect {
+				client.Stop(errors.New("connection dropped by test"))
+				waitForSubscription(t, server, client)
+			}
+
+			if err := server.Publish(testTopic, tt.payload, false, byte(tt.qos)); err != nil {
+				t.Fatalf("could not publish: %v", err)
+			}
+			select {
+			case got := <-eventChan:
+				if got.Response == nil {
+					t.Errorf("Listen() expected response channel")
+				}
+				got.Response = nil
+				if got != tt.want {
+					t.Errorf("Listen() got = %v, want %v", got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Listen() did not send sync request")
+			}
+		})
+	}
+}
+
+func TestMqttSource_ListenRejectedCredentials(t *testing.T) {
+	server, url := newBroker(t, "jellyporter", "secret")
+
+	source, err := New(url, []string{testTopic}, WithAuth("jellyporter", "wrong"), WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx := t.Context()
+	eventChan := make(chan events.EventSyncRequest)
+	wg := &sync.WaitGroup{}
+	go func() {
+		_ = source.Listen(ctx, eventChan, wg)
+	}()
+
+	if err := server.Publish(testTopic, []byte("sync"), false, 0); err != nil {
+		t.Fatalf("could not publish: %v", err)
+	}
+	select {
+	case got := <-eventChan:
+		t.Fatalf("Listen() got unexpected sync request %v", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,102 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+func WithClientID(clientID string) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		if len(clientID) == 0 || len(clientID) > 23 {
+			return fmt.Errorf("client id must be between 1 and 23 characters: %q", clientID)
+		}
+
+		m.clientID = clientID
+		return nil
+	}
+}
+
+func WithAuth(username, password string) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		if len(username) == 0 {
+			return errors.New("empty username")
+		}
+
+		m.username = username
+		m.password = password
+		return nil
+	}
+}
+
+// WithQoS sets the QoS of the subscriptions, either 0 (at most once) or 1 (at least once).
+func WithQoS(qos int) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		if qos < 0 || qos > 1 {
+			return fmt.Errorf("unsupported qos: %d", qos)
+		}
+
+		m.qos = byte(qos)
+		return nil
+	}
+}
+
+func WithKeepAlive(keepAlive time.Duration) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		if keepAlive < time.Second || keepAlive > time.Hour {
+			return fmt.Errorf("keep alive must be between 1s and 1h: %v", keepAlive)
+		}
+
+		m.keepAlive = keepAlive
+		return nil
+	}
+}
+
+// WithBackoff sets the minimum and maximum duration to wait before connecting to the broker again. The duration is
+// doubled after each failed attempt. Lost connections are re-established by the MQTT client, which starts with a
+// backoff of one second and respects the maximum duration.
+func WithBackoff(minBackoff, maxBackoff time.Duration) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		if minBackoff <= 0 || maxBackoff < minBackoff {
+			return fmt.Errorf("invalid backoff: min %v, max %v", minBackoff, maxBackoff)
+		}
+
+		m.minBackoff = minBackoff
+		m.maxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// WithTLS connects to the broker using TLS. The CA file is used to verify the broker's certificate instead of the
+// system's CAs, the certificate and key are presented to the broker as client certificate. All of them are optional.
+func WithTLS(caFile, certFile, keyFile string) func(m *MqttSource) error {
+	return func(m *MqttSource) error {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+		if caFile != "" {
+			data, err := os.ReadFile(caFile)
+			if err != nil {
+				return fmt.Errorf("could not read ca file: %w", err)
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+				return errors.New("no certificates found in ca file")
+			}
+		}
+
+		if certFile != "" || keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return fmt.Errorf("could not load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		m.tlsConfig = tlsConfig
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+)
+
+const (
+	NotificationPlaybackStop  = "PlaybackStop"
+	NotificationUserDataSaved = "UserDataSaved"
+)
+
+// targetedNotifications are the notification types of the Jellyfin Webhook plugin that refer to UserData of an item
+var targetedNotifications = []string{NotificationPlaybackStop, NotificationUserDataSaved}
+
+// JellyfinPayload holds the fields of the default JSON templates of the Jellyfin Webhook plugin that are used.
+type JellyfinPayload struct {
+	NotificationType string `json:"NotificationType"`
+	ItemId           string `json:"ItemId"`
+	ItemType         string `json:"ItemType"`
+	Name             string `json:"Name"`
+	UserId           string `json:"UserId"`
+	ServerId         string `json:"ServerId"`
+	ServerName       string `json:"ServerName"`
+}
+
+// ParseJellyfinPayload parses the body sent by the Jellyfin Webhook plugin. An empty body is not an error but returns
+// an empty payload.
+func ParseJellyfinPayload(body []byte) (JellyfinPayload, error) {
+	var payload JellyfinPayload
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return payload, nil
+	}
+
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return payload, err
+	}
+
+	if payload.IsTargeted() && payload.ServerId == "" {
+		return payload, errors.New("payload is missing the server id")
+	}
+
+	return payload, nil
+}
+
+// IsTargeted returns true if the payload refers to the UserData of a single item.
+func (p JellyfinPayload) IsTargeted() bool {
+	return p.ItemId != "" && slices.Contains(targetedNotifications, p.NotificationType)
+}
+
+// ApplyTo passes the item the payload refers to on to the given sync request. Payloads that do not refer to a single
+// item leave the request untouched.
+func (p JellyfinPayload) ApplyTo(req *EventSyncRequest) {
+	if !p.IsTargeted() {
+		return
+	}
+
+	req.ItemID = p.ItemId
+	req.ServerID = p.ServerId
+	req.UserID = p.UserId
+}
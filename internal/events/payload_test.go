@@ -0,0 +1,114 @@
+package events
+
+import "testing"
+
+func TestParseJellyfinPayload(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		want         JellyfinPayload
+		wantErr      bool
+		wantTargeted bool
+		wantRequest  EventSyncRequest
+	}{
+		{
+			name:         "UserDataSaved",
+			body:         `{"NotificationType":"UserDataSaved","ItemId":"abc","ItemType":"Movie","Name":"Heat","UserId":"user","ServerId":"server","ServerName":"jellyfin"}`,
+			want:         JellyfinPayload{NotificationType: NotificationUserDataSaved, ItemId: "abc", ItemType: "Movie", Name: "Heat", UserId: "user", ServerId: "server", ServerName: "jellyfin"},
+			wantTargeted: true,
+			wantRequest:  EventSyncRequest{ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name:         "PlaybackStop",
+			body:         `{"NotificationType":"PlaybackStop","ItemId":"abc","UserId":"user","ServerId":"server"}`,
+			want:         JellyfinPayload{NotificationType: NotificationPlaybackStop, ItemId: "abc", UserId: "user", ServerId: "server"},
+			wantTargeted: true,
+			wantRequest:  EventSyncRequest{ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name: "PlaybackStart is not targeted",
+			body: `{"NotificationType":"PlaybackStart","ItemId":"abc","UserId":"user","ServerId":"server"}`,
+			want: JellyfinPayload{NotificationType: "PlaybackStart", ItemId: "abc", UserId: "user", ServerId: "server"},
+		},
+		{
+			name: "ItemAdded is not targeted",
+			body: `{"NotificationType":"ItemAdded","ItemId":"abc","ServerId":"server"}`,
+			want: JellyfinPayload{NotificationType: "ItemAdded", ItemId: "abc", ServerId: "server"},
+		},
+		{
+			name: "Targeted type without item is not targeted",
+			body: `{"NotificationType":"UserDataSaved","UserId":"user","ServerId":"server"}`,
+			want: JellyfinPayload{NotificationType: NotificationUserDataSaved, UserId: "user", ServerId: "server"},
+		},
+		{
+			name:         "Unknown fields are ignored",
+			body:         `{"NotificationType":"UserDataSaved","ItemId":"abc","ServerId":"server","Played":true}`,
+			want:         JellyfinPayload{NotificationType: NotificationUserDataSaved, ItemId: "abc", ServerId: "server"},
+			wantTargeted: true,
+			wantRequest:  EventSyncRequest{ItemID: "abc", ServerID: "server"},
+		},
+		{
+			name: "Empty body",
+			body: "",
+		},
+		{
+			name: "Whitespace body",
+			body: " \n\t",
+		},
+		{
+			name: "Empty object",
+			body: "{}",
+		},
+		{
+			name:         "Targeted payload without server id",
+			body:         `{"NotificationType":"UserDataSaved","ItemId":"abc","UserId":"user"}`,
+			want:         JellyfinPayload{NotificationType: NotificationUserDataSaved, ItemId: "abc", UserId: "user"},
+			wantErr:      true,
+			wantTargeted: true,
+			wantRequest:  EventSyncRequest{ItemID: "abc", UserID: "user"},
+		},
+		{
+			name:    "Malformed JSON",
+			body:    `{"NotificationType":"UserDataSaved",`,
+			wantErr: true,
+		},
+		{
+			name:    "Plain text",
+			body:    "sync",
+			wantErr: true,
+		},
+		{
+			name:    "Wrong type of field",
+			body:    `{"NotificationType":"UserDataSaved","ItemId":42,"ServerId":"server"}`,
+			want:    JellyfinPayload{NotificationType: NotificationUserDataSaved, ServerId: "server"},
+			wantErr: true,
+		},
+		{
+			name:    "JSON array",
+			body:    `[{"NotificationType":"UserDataSaved","ItemId":"abc","ServerId":"server"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJellyfinPayload([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseJellyfinPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseJellyfinPayload() got = %v, want %v", got, tt.want)
+			}
+			if got.IsTargeted() != tt.wantTargeted {
+				t.Errorf("IsTargeted() got = %v, want %v", got.IsTargeted(), tt.wantTargeted)
+			}
+
+			req := EventSyncRequest{Source: "webhook", Metadata: "127.0.0.1"}
+			got.ApplyTo(&req)
+			tt.wantRequest.Source = "webhook"
+			tt.wantRequest.Metadata = "127.0.0.1"
+			if req != tt.wantRequest {
+				t.Errorf("ApplyTo() got = %v, want %v", req, tt.wantRequest)
+			}
+		})
+	}
+}
@@ -4,4 +4,19 @@ type EventSyncRequest struct {
 	Source   string
 	Metadata string
 	Response chan error
+
+	// ItemID is the ID of the item that has been changed on the server identified by ServerID or Server. Empty if the
+	// event does not refer to a single item.
+	ItemID string
+	// ServerID is the ID of the Jellyfin server that has sent the event
+	ServerID string
+	// Server is the name of the configured client that has sent the event, if the event source already knows it
+	Server string
+	// UserID is the Jellyfin ID of the user whose UserData of the item has been changed
+	UserID string
+}
+
+// IsTargeted returns true if the event refers to a single item on a known server.
+func (e EventSyncRequest) IsTargeted() bool {
+	return e.ItemID != "" && (e.ServerID != "" || e.Server != "")
 }
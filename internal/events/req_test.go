@@ -0,0 +1,44 @@
+package events
+
+import "testing"
+
+func TestEventSyncRequest_IsTargeted(t *testing.T) {
+	tests := []struct {
+		name string
+		req  EventSyncRequest
+		want bool
+	}{
+		{
+			name: "Full sync",
+			req:  EventSyncRequest{Source: "mqtt"},
+			want: false,
+		},
+		{
+			name: "Item on server identified by its id",
+			req:  EventSyncRequest{Source: "webhook", ItemID: "abc", ServerID: "server"},
+			want: true,
+		},
+		{
+			name: "Item on configured client",
+			req:  EventSyncRequest{Source: "websocket", ItemID: "abc", Server: "jellyfin"},
+			want: true,
+		},
+		{
+			name: "Item on unknown server",
+			req:  EventSyncRequest{Source: "webhook", ItemID: "abc", UserID: "user"},
+			want: false,
+		},
+		{
+			name: "Server without item",
+			req:  EventSyncRequest{Source: "webhook", ServerID: "server", Server: "jellyfin", UserID: "user"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.IsTargeted(); got != tt.want {
+				t.Errorf("IsTargeted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultSignatureHeader = "X-Signature-256"
+	signaturePrefix        = "sha256="
+)
+
+var (
+	errUnauthorized     = errors.New("missing or invalid credentials")
+	errInvalidSignature = errors.New("missing or invalid signature")
+)
+
+// authenticate checks all configured authentication methods, a request needs to pass all of them.
+func (w *WebhookServer) authenticate(r *http.Request, body []byte) error {
+	if w.bearerToken != "" {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || !secureCompare(token, w.bearerToken) {
+			return errUnauthorized
+		}
+	}
+
+	if w.basicAuthUser != "" {
+		user, password, ok := r.BasicAuth()
+		// evaluate both comparisons to not leak which of them failed
+		userMatches := secureCompare(user, w.basicAuthUser)
+		passwordMatches := secureCompare(password, w.basicAuthPassword)
+		if !ok || !userMatches || !passwordMatches {
+			return errUnauthorized
+		}
+	}
+
+	if len(w.hmacSecret) > 0 {
+		signature := strings.TrimPrefix(r.Header.Get(w.signatureHeader), signaturePrefix)
+		decoded, err := hex.DecodeString(signature)
+		if err != nil || len(decoded) == 0 {
+			return errInvalidSignature
+		}
+
+		mac := hmac.New(sha256.New, w.hmacSecret)
+		mac.Write(body)
+		if !hmac.Equal(decoded, mac.Sum(nil)) {
+			return errInvalidSignature
+		}
+	}
+
+	return nil
+}
+
+func (w *WebhookServer) setAuthenticateHeader(rw http.ResponseWriter) {
+	if w.bearerToken != "" {
+		rw.Header().Add("WWW-Authenticate", `Bearer realm="jellyporter"`)
+	}
+	if w.basicAuthUser != "" {
+		rw.Header().Add("WWW-Authenticate", `Basic realm="jellyporter"`)
+	}
+}
+
+func secureCompare(given, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// getIP returns the IP of the client that has sent the request. Forwarded headers are only honoured if the request has
+// been sent by a trusted proxy.
+func (w *WebhookServer) getIP(r *http.Request) string {
+	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+
+	if !w.isTrustedProxy(remoteAddr) {
+		return remoteAddr
+	}
+
+	xff := r.Header.Get("X-Forwarded-For")
+	if xff != "" {
+		// Walk the chain from the closest hop to the furthest and return the first address that is not a trusted
+		// proxy, as all addresses before it may have been forged by the client.
+		ips := strings.Split(xff, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if !w.isTrustedProxy(ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+
+	xrip := r.Header.Get("X-Real-IP")
+	if xrip != "" {
+		return xrip
+	}
+
+	return remoteAddr
+}
+
+func (w *WebhookServer) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range w.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/events"
+)
+
+const testPayload = `{"NotificationType": "UserDataSaved", "ItemId": "abc", "UserId": "user", "ServerId": "server"}`
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookServer_authenticate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []WebhookServerOpts
+		headers map[string]string
+		user    string
+		pass    string
+		body    string
+		wantErr error
+	}{
+		{
+			name: "No authentication configured",
+			body: testPayload,
+		},
+		{
+			name:    "Valid bearer token",
+			opts:    []WebhookServerOpts{WithBearerToken("token")},
+			headers: map[string]string{"Authorization": "Bearer token"},
+		},
+		{
+			name:    "Missing bearer token",
+			opts:    []WebhookServerOpts{WithBearerToken("token")},
+			wantErr: errUnauthorized,
+		},
+		{
+			name:    "Invalid bearer token",
+			opts:    []WebhookServerOpts{WithBearerToken("token")},
+			headers: map[string]string{"Authorization": "Bearer other"},
+			wantErr: errUnauthorized,
+		},
+		{
+			name:    "Bearer token without scheme",
+			opts:    []WebhookServerOpts{WithBearerToken("token")},
+			headers: map[string]string{"Authorization": "token"},
+			wantErr: errUnauthorized,
+		},
+		{
+			name: "Valid basic auth",
+			opts: []WebhookServerOpts{WithBasicAuth("user", "pass")},
+			user: "user",
+			pass: "pass",
+		},
+		{
+			name:    "Invalid basic auth password",
+			opts:    []WebhookServerOpts{WithBasicAuth("user", "pass")},
+			user:    "user",
+			pass:    "other",
+			wantErr: errUnauthorized,
+		},
+		{
+			name:    "Missing basic auth",
+			opts:    []WebhookServerOpts{WithBasicAuth("user", "pass")},
+			wantErr: errUnauthorized,
+		},
+		{
+			name:    "Valid signature",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "")},
+			headers: map[string]string{DefaultSignatureHeader: sign("secret", testPayload)},
+			body:    testPayload,
+		},
+		{
+			name:    "Valid signature without prefix in custom header",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "x-hub-signature")},
+			headers: map[string]string{"X-Hub-Signature": strings.TrimPrefix(sign("secret", testPayload), signaturePrefix)},
+			body:    testPayload,
+		},
+		{
+			name:    "Signature of other body",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "")},
+			headers: map[string]string{DefaultSignatureHeader: sign("secret", "{}")},
+			body:    testPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "Signature with other secret",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "")},
+			headers: map[string]string{DefaultSignatureHeader: sign("other", testPayload)},
+			body:    testPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "Malformed signature",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "")},
+			headers: map[string]string{DefaultSignatureHeader: "sha256=xyz"},
+			body:    testPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name:    "Missing signature",
+			opts:    []WebhookServerOpts{WithHmacSecret("secret", "")},
+			body:    testPayload,
+			wantErr: errInvalidSignature,
+		},
+		{
+			name: "All methods pass",
+			opts: []WebhookServerOpts{WithBearerToken("token"), WithHmacSecret("secret", "")},
+			headers: map[string]string{
+				"Authorization":        "Bearer token",
+				DefaultSignatureHeader: sign("secret", testPayload),
+			},
+			body: testPayload,
+		},
+		{
+			name:    "One of the methods fails",
+			opts:    []WebhookServerOpts{WithBearerToken("token"), WithHmacSecret("secret", "")},
+			headers: map[string]string{DefaultSignatureHeader: sign("secret", testPayload)},
+			body:    testPayload,
+			wantErr: errUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(":0", tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, defaultPath, strings.NewReader(tt.body))
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if tt.user != "" {
+				r.SetBasicAuth(tt.user, tt.pass)
+			}
+
+			if err := w.authenticate(r, []byte(tt.body)); err != tt.wantErr {
+				t.Errorf("authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookServer_handler(t *testing.T) {
+	tests := []struct {
+		name       string
+		signature  string
+		wantStatus int
+		want       *events.EventSyncRequest
+	}{
+		{
+			name:       "Signed payload is parsed after verification",
+			signature:  sign("secret", testPayload),
+			wantStatus: http.StatusAccepted,
+			want:       &events.EventSyncRequest{Source: "webhook", Metadata: "192.0.2.1", ItemID: "abc", ServerID: "server", UserID: "user"},
+		},
+		{
+			name:       "Invalid signature is rejected",
+			signature:  sign("other", testPayload),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(":0", WithHmacSecret("secret", ""))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			eventChan := make(chan events.EventSyncRequest, 1)
+			r := httptest.NewRequest(http.MethodPost, defaultPath, strings.NewReader(testPayload))
+			r.RemoteAddr = "192.0.2.1:1234"
+			r.Header.Set(DefaultSignatureHeader, tt.signature)
+
+			go func() {
+				select {
+				case req := <-eventChan:
+					req.Response <- nil
+					eventChan <- req
+				case <-time.After(time.Second):
+				}
+			}()
+
+			rw := httptest.NewRecorder()
+			w.handler(eventChan, &atomic.Bool{})(rw, r)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("handler() status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			select {
+			case got := <-eventChan:
+				got.Response = nil
+				if got != *tt.want {
+					t.Errorf("handler() got = %v, want %v", got, *tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("handler() did not send sync request")
+			}
+		})
+	}
+}
+
+func TestWebhookServer_getIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		headers        map[string]string
+		want           string
+	}{
+		{
+			name:       "Remote address",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "192.0.2.1",
+		},
+		{
+			name:       "Spoofed X-Forwarded-For from untrusted peer",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			want:       "192.0.2.1",
+		},
+		{
+			name:           "Spoofed X-Real-IP from untrusted peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "192.0.2.1:1234",
+			headers:        map[string]string{"X-Real-IP": "198.51.100.7"},
+			want:           "192.0.2.1",
+		},
+		{
+			name:           "X-Forwarded-For from trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			want:           "198.51.100.7",
+		},
+		{
+			name:           "Forged entries before the closest untrusted hop are ignored",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7, 10.0.0.2"},
+			want:           "198.51.100.7",
+		},
+		{
+			name:           "Chain of trusted proxies",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			want:           "10.0.0.3",
+		},
+		{
+			name:           "X-Real-IP from trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			headers:        map[string]string{"X-Real-IP": "198.51.100.7"},
+			want:           "198.51.100.7",
+		},
+		{
+			name:           "Trusted proxy without forwarded headers",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:1234",
+			want:           "10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(":0", WithTrustedProxies(tt.trustedProxies))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, defaultPath, nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			if got := w.getIP(r); got != tt.want {
+				t.Errorf("getIP() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package webhook
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 )
 
 func WithPath(path string) func(w *WebhookServer) error {
@@ -31,3 +33,75 @@ func WithTLS(certFile, keyFile string) func(w *WebhookServer) error {
 		return nil
 	}
 }
+
+// WithClientCA requires clients to present a certificate signed by one of the CAs in the given file. Requires TLS to
+// be configured using WithTLS.
+func WithClientCA(caFile string) func(w *WebhookServer) error {
+	return func(w *WebhookServer) error {
+		if len(caFile) == 0 {
+			return errors.New("empty client ca file")
+		}
+
+		w.clientCAFile = caFile
+		return nil
+	}
+}
+
+func WithBearerToken(token string) func(w *WebhookServer) error {
+	return func(w *WebhookServer) error {
+		if len(token) == 0 {
+			return errors.New("empty bearer token")
+		}
+
+		w.bearerToken = token
+		return nil
+	}
+}
+
+func WithBasicAuth(user, password string) func(w *WebhookServer) error {
+	return func(w *WebhookServer) error {
+		if len(user) == 0 {
+			return errors.New("empty basic auth user")
+		}
+
+		if len(password) == 0 {
+			return errors.New("empty basic auth password")
+		}
+
+		w.basicAuthUser = user
+		w.basicAuthPassword = password
+		return nil
+	}
+}
+
+// WithHmacSecret requires requests to carry a hex encoded HMAC-SHA256 signature of the body, optionally prefixed by
+// "sha256=", in the given header. If the header is empty, DefaultSignatureHeader is used.
+func WithHmacSecret(secret, header string) func(w *WebhookServer) error {
+	return func(w *WebhookServer) error {
+		if len(secret) == 0 {
+			return errors.New("empty hmac secret")
+		}
+
+		if header == "" {
+			header = DefaultSignatureHeader
+		}
+
+		w.hmacSecret = []byte(secret)
+		w.signatureHeader = http.CanonicalHeaderKey(header)
+		return nil
+	}
+}
+
+// WithTrustedProxies only honours the X-Forwarded-For and X-Real-IP headers of requests sent from the given networks.
+func WithTrustedProxies(cidrs []string) func(w *WebhookServer) error {
+	return func(w *WebhookServer) error {
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy: %w", err)
+			}
+			w.trustedProxies = append(w.trustedProxies, network)
+		}
+		return nil
+	}
+}
@@ -4,27 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
 	"go.uber.org/multierr"
 )
 
 const defaultPath = "/webhook"
 
+// maxPayloadBytes is the maximum size of a webhook body that is read
+const maxPayloadBytes = 1 << 20
+
 type WebhookServer struct {
 	address string
 
 	// optional
-	path     string
-	certFile string
-	keyFile  string
+	path         string
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	// optional authentication, all configured methods need to pass
+	bearerToken       string
+	basicAuthUser     string
+	basicAuthPassword string
+	hmacSecret        []byte
+	signatureHeader   string
+
+	// trustedProxies are the networks whose forwarded headers are honoured
+	trustedProxies []*net.IPNet
 }
 
 type WebhookServerOpts func(*WebhookServer) error
@@ -46,6 +61,10 @@ func New(address string, opts ...WebhookServerOpts) (*WebhookServer, error) {
 		}
 	}
 
+	if len(w.clientCAFile) > 0 && !w.IsTLSConfigured() {
+		errs = multierr.Append(errs, errors.New("client ca file configured without tls"))
+	}
+
 	return w, errs
 }
 
@@ -61,45 +80,7 @@ func (w *WebhookServer) Listen(ctx context.Context, eventChan chan events.EventS
 	isShuttingDown := atomic.Bool{}
 	mux := http.NewServeMux()
 
-	handler := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		syncRequest := events.EventSyncRequest{
-			Source:   "webhook",
-			Metadata: getIP(r),
-			Response: make(chan error),
-		}
-
-		if isShuttingDown.Load() {
-			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
-			return
-		}
-
-		select {
-		case eventChan <- syncRequest:
-			// proceed
-		case <-time.After(500 * time.Millisecond):
-			http.Error(w, "Server busy, try again later", http.StatusServiceUnavailable)
-			return
-		}
-
-		select {
-		case err := <-syncRequest.Response:
-			if err != nil {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
-				return
-			}
-			w.WriteHeader(http.StatusOK)
-			return
-		case <-time.After(5 * time.Second):
-			http.Error(w, "Timeout waiting for event processing", http.StatusGatewayTimeout)
-			return
-		}
-	}
-	mux.HandleFunc(w.path, handler)
+	mux.HandleFunc(w.path, w.handler(eventChan, &isShuttingDown))
 
 	server := http.Server{
 		Addr:              w.address,
@@ -110,10 +91,20 @@ func (w *WebhookServer) Listen(ctx context.Context, eventChan chan events.EventS
 		IdleTimeout:       30 * time.Second,
 	}
 
+	if w.IsTLSConfigured() {
+		reloader, err := newCertReloader(w.certFile, w.keyFile, w.clientCAFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = reloader.tlsConfig()
+		go reloader.watch(ctx, defaultCertReloadInterval)
+	}
+
 	errChan := make(chan error)
 	go func() {
 		if w.IsTLSConfigured() {
-			if err := server.ListenAndServeTLS(w.certFile, w.keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			// certificates are provided by the TLS config
+			if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				errChan <- fmt.Errorf("can not start webhook_server server: %w", err)
 			}
 		} else {
@@ -140,23 +131,65 @@ func (w *WebhookServer) Listen(ctx context.Context, eventChan chan events.EventS
 	}
 }
 
-func getIP(r *http.Request) string {
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+// handler authenticates webhook requests and turns them into sync requests. Requests are rejected once the server is
+// shutting down.
+func (w *WebhookServer) handler(eventChan chan events.EventSyncRequest, isShuttingDown *atomic.Bool) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-	}
 
-	xrip := r.Header.Get("X-Real-IP")
-	if xrip != "" {
-		return xrip
-	}
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxPayloadBytes))
+		if err != nil {
+			http.Error(rw, "Could not read body", http.StatusBadRequest)
+			return
+		}
+
+		syncRequest := events.EventSyncRequest{
+			Source:   "webhook",
+			Metadata: w.getIP(r),
+			Response: make(chan error),
+		}
+
+		if err := w.authenticate(r, body); err != nil {
+			metrics.EventSourceErrorsTotal.WithLabelValues(syncRequest.Source).Inc()
+			log.Warn().Err(err).Str("source", syncRequest.Metadata).Msg("Rejected unauthenticated webhook request")
+			w.setAuthenticateHeader(rw)
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Payloads that can not be parsed still trigger a full sync, as every request did before payloads were parsed
+		payload, err := events.ParseJellyfinPayload(body)
+		if err != nil {
+			log.Warn().Err(err).Str("source", syncRequest.Metadata).Msg("Could not parse webhook payload, requesting full sync")
+		} else if payload.IsTargeted() {
+			payload.ApplyTo(&syncRequest)
+			log.Debug().Str("source", syncRequest.Metadata).Str("type", payload.NotificationType).Str("item", payload.ItemId).Str("name", payload.Name).Str("server", payload.ServerName).Msg("Received webhook for item")
+		}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+		if isShuttingDown.Load() {
+			http.Error(rw, "Server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		select {
+		case eventChan <- syncRequest:
+			// proceed
+		case <-time.After(500 * time.Millisecond):
+			http.Error(rw, "Server busy, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		// the app queues every event and only confirms that it has been received
+		select {
+		case <-syncRequest.Response:
+			rw.WriteHeader(http.StatusAccepted)
+			return
+		case <-time.After(5 * time.Second):
+			http.Error(rw, "Timeout waiting for event processing", http.StatusGatewayTimeout)
+			return
+		}
 	}
-	return ip
 }
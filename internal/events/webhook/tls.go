@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultCertReloadInterval = 1 * time.Minute
+
+// certReloader holds the server certificate and the optional client CAs and reloads them when their files change, so
+// renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mutex     sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func newCertReloader(certFile, keyFile, clientCAFile string) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		modTimes:     map[string]time.Time{},
+	}
+
+	if _, err := reloader.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+func (c *certReloader) files() []string {
+	files := []string{c.certFile, c.keyFile}
+	if c.clientCAFile != "" {
+		files = append(files, c.clientCAFile)
+	}
+	return files
+}
+
+// reloadIfChanged reloads the certificate and the client CAs if any of their files has been modified since they have
+// been loaded. If loading fails, the previously loaded certificate and CAs are kept.
+func (c *certReloader) reloadIfChanged() (bool, error) {
+	modTimes := map[string]time.Time{}
+	changed := false
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTimes[file] = info.ModTime()
+
+		c.mutex.RLock()
+		if !info.ModTime().Equal(c.modTimes[file]) {
+			changed = true
+		}
+		c.mutex.RUnlock()
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("could not load certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		data, err := os.ReadFile(c.clientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("could not read client ca file: %w", err)
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return false, errors.New("no certificates found in client ca file")
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.modTimes = modTimes
+	return true, nil
+}
+
+// watch periodically checks the files for changes until the context is canceled.
+func (c *certReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := c.reloadIfChanged()
+			if err != nil {
+				log.Error().Err(err).Str("cert", c.certFile).Msg("Could not reload webhook server certificates")
+			} else if reloaded {
+				log.Info().Str("cert", c.certFile).Msg("Reloaded webhook server certificates")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// tlsConfig returns a TLS config that always uses the most recently loaded certificate and client CAs. If client CAs
+// are configured, clients need to present a certificate signed by one of them.
+func (c *certReloader) tlsConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the config returned by GetConfigForClient replaces the config that the http.Server has set up for HTTP/2
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	ret := base.Clone()
+	ret.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+		return c.cert, nil
+	}
+	ret.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+
+		conf := base.Clone()
+		conf.Certificates = []tls.Certificate{*c.cert}
+		if c.clientCAs != nil {
+			conf.ClientCAs = c.clientCAs
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return conf, nil
+	}
+	return ret
+}
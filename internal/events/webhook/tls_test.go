@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns the PEM encoded certificate and key for the given name.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func (ca *testCA) clientCert(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	certPem, keyPem := ca.issue(t, name, x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeFile writes the file with a modification time that differs from previous writes, as the reloader detects
+// changes by the modification time.
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS serves HTTPS using the reloader's config the same way the webhook server does.
+func serveTLS(t *testing.T, reloader *certReloader) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}),
+		TLSConfig:         reloader.tlsConfig(),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() {
+		if err := server.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("ServeTLS() error = %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return listener.Addr().String()
+}
+
+// handshake connects to the server and returns the connection state after the first response has been read, as
+// TLS 1.3 servers reject client certificates after the client has finished the handshake.
+func handshake(addr string, roots *x509.CertPool, certs []tls.Certificate) (tls.ConnectionState, error) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      roots,
+		Certificates: certs,
+		NextProtos:   []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		// the server sends its settings frame right away
+		_, err = conn.Read(make([]byte, 1))
+	} else {
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		if err == nil {
+			_, err = conn.Read(make([]byte, 1))
+		}
+	}
+	return conn.ConnectionState(), err
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	now := time.Now()
+	certPem, keyPem := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPem, now.Add(-time.Minute))
+	writeFile(t, keyFile, keyPem, now.Add(-time.Minute))
+
+	reloader, err := newCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	addr := serveTLS(t, reloader)
+
+	state, err := handshake(addr, roots, nil)
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	if got := state.PeerCertificates[0].Subject.CommonName; got != "first" {
+		t.Errorf("served certificate = %q, want %q", got, "first")
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated protocol = %q, want h2", state.NegotiatedProtocol)
+	}
+
+	reloaded, err := reloader.reloadIfChanged()
+	if err != nil || reloaded {
+		t.Fatalf("reloadIfChanged() = %v, %v, want no reload of unchanged files", reloaded, err)
+	}
+
+	certPem, keyPem = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPem, now)
+	writeFile(t, keyFile, keyPem, now)
+	reloaded, err = reloader.reloadIfChanged()
+	if err != nil || !reloaded {
+		t.Fatalf("reloadIfChanged() = %v, %v, want reload", reloaded, err)
+	}
+
+	state, err = handshake(addr, roots, nil)
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	if got := state.PeerCertificates[0].Subject.CommonName; got != "second" {
+		t.Errorf("served certificate = %q, want %q", got, "second")
+	}
+
+	// a broken certificate is not loaded, the previous one is kept
+	writeFile(t, certFile, []byte("garbage"), now.Add(time.Minute))
+	if _, err := reloader.reloadIfChanged(); err == nil {
+		t.Fatal("reloadIfChanged() expected error for invalid certificate")
+	}
+	state, err = handshake(addr, roots, nil)
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	if got := state.PeerCertificates[0].Subject.CommonName; got != "second" {
+		t.Errorf("served certificate = %q, want %q", got, "second")
+	}
+}
+
+func TestCertReloader_ClientAuth(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	certPem, keyPem := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, certPem, time.Now())
+	writeFile(t, keyFile, keyPem, time.Now())
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	reloader, err := newCertReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	addr := serveTLS(t, reloader)
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{
+			name:  "Client certificate signed by the client CA",
+			certs: []tls.Certificate{ca.clientCert(t, "client")},
+		},
+		{
+			name:    "Missing client certificate",
+			wantErr: true,
+		},
+		{
+			name:    "Client certificate signed by other CA",
+			certs:   []tls.Certificate{otherCA.clientCert(t, "client")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := handshake(addr, roots, tt.certs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && state.NegotiatedProtocol != "h2" {
+				t.Errorf("negotiated protocol = %q, want h2", state.NegotiatedProtocol)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithKeepAlive sets the interval of keep alive messages until the server announces its own interval.
+func WithKeepAlive(keepAlive time.Duration) func(w *WebsocketSource) error {
+	return func(w *WebsocketSource) error {
+		if keepAlive < time.Second || keepAlive > time.Hour {
+			return fmt.Errorf("keep alive must be between 1s and 1h: %v", keepAlive)
+		}
+
+		w.keepAlive = keepAlive
+		return nil
+	}
+}
+
+// WithBackoff sets the minimum and maximum duration to wait before reconnecting to the server. The duration is doubled
+// after each failed attempt.
+func WithBackoff(minBackoff, maxBackoff time.Duration) func(w *WebsocketSource) error {
+	return func(w *WebsocketSource) error {
+		if minBackoff <= 0 || maxBackoff < minBackoff {
+			return fmt.Errorf("invalid backoff: min %v, max %v", minBackoff, maxBackoff)
+		}
+
+		w.minBackoff = minBackoff
+		w.maxBackoff = maxBackoff
+		return nil
+	}
+}
@@ -0,0 +1,302 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+	"go.uber.org/multierr"
+)
+
+const (
+	eventSourceName     = "websocket"
+	defaultKeepAlive    = 30 * time.Second
+	defaultMinBackoff   = 1 * time.Second
+	defaultMaxBackoff   = 2 * time.Minute
+	connectTimeout      = 10 * time.Second
+	eventDeliverTimeout = 500 * time.Millisecond
+	// maxMessageSize is the maximum size of a message, larger messages are rejected
+	maxMessageSize = 1 << 20
+
+	messageForceKeepAlive  = "ForceKeepAlive"
+	messageKeepAlive       = "KeepAlive"
+	messageUserDataChanged = "UserDataChanged"
+)
+
+// WebsocketSource connects to the WebSocket of a single Jellyfin server and turns the UserDataChanged messages the
+// server sends into sync requests for the changed items.
+type WebsocketSource struct {
+	name   string
+	socket *url.URL
+
+	// optional
+	keepAlive  time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type WebsocketSourceOpts func(*WebsocketSource) error
+
+// New returns a WebSocket event source for the Jellyfin server at the given address, which is the same URL the client
+// with the given name uses to access the API.
+func New(name, address, apiKey string, opts ...WebsocketSourceOpts) (*WebsocketSource, error) {
+	if len(name) == 0 {
+		return nil, errors.New("empty name provided")
+	}
+
+	if len(apiKey) == 0 {
+		return nil, errors.New("empty api key provided")
+	}
+
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	w := &WebsocketSource{
+		name:       name,
+		keepAlive:  defaultKeepAlive,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+
+	var scheme string
+	switch parsed.Scheme {
+	case "http", "ws":
+		scheme = "ws"
+	case "https", "wss":
+		scheme = "wss"
+	default:
+		return nil, fmt.Errorf("unsupported scheme: %q", parsed.Scheme)
+	}
+
+	values := url.Values{}
+	values.Add("api_key", apiKey)
+	values.Add("deviceId", "jellyporter-"+name)
+	w.socket = &url.URL{
+		Scheme:   scheme,
+		Host:     parsed.Host,
+		Path:     strings.TrimSuffix(parsed.Path, "/") + "/socket",
+		RawQuery: values.Encode(),
+	}
+
+	var errs error
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	return w, errs
+}
+
+func (w *WebsocketSource) Listen(ctx context.Context, eventChan chan events.EventSyncRequest, wg *sync.WaitGroup) error {
+	wg.Add(1)
+	defer wg.Done()
+
+	backoff := w.minBackoff
+	for {
+		connected, err := w.connectAndReceive(ctx, eventChan)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if connected {
+			// the connection has been established successfully, so the server is reachable again
+			backoff = w.minBackoff
+		}
+
+		metrics.EventSourceErrorsTotal.WithLabelValues(eventSourceName).Inc()
+		log.Error().Err(err).Str("server", w.name).Dur("backoff", backoff).Msg("Lost connection to Jellyfin WebSocket, reconnecting")
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, w.maxBackoff)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// connectAndReceive connects to the WebSocket and receives messages until the connection fails or the context is
+// canceled. Returns whether the connection has been established.
+func (w *WebsocketSource) connectAndReceive(ctx context.Context, eventChan chan events.EventSyncRequest) (bool, error) {
+	conn, err := w.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	conn.SetReadLimit(maxMessageSize)
+	log.Info().Str("server", w.name).Msg("Connected to Jellyfin WebSocket")
+
+	// closing the connection unblocks reading when the context is canceled
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-connCtx.Done()
+		_ = conn.Close()
+	}()
+
+	client := &connection{conn: conn}
+	keepAlive := w.keepAlive
+	intervals := make(chan time.Duration, 1)
+	go client.keepAlive(connCtx, keepAlive, intervals)
+	defer client.close()
+
+	for {
+		// the server answers each keep alive message, a silent connection is considered dead
+		_ = conn.SetReadDeadline(time.Now().Add(keepAlive * 3))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Warn().Err(err).Str("server", w.name).Msg("Could not parse WebSocket message")
+			continue
+		}
+
+		switch msg.MessageType {
+		case messageForceKeepAlive:
+			var seconds float64
+			if err := json.Unmarshal(msg.Data, &seconds); err != nil || seconds < 2 {
+				log.Warn().Str("server", w.name).RawJSON("data", msg.Data).Msg("Ignoring invalid keep alive interval")
+				continue
+			}
+			// the server closes sessions that have not sent a keep alive message within the interval
+			keepAlive = time.Duration(seconds * float64(time.Second) / 2)
+			select {
+			case <-intervals:
+			default:
+			}
+			intervals <- keepAlive
+			if err := client.sendKeepAlive(); err != nil {
+				return true, err
+			}
+		case messageKeepAlive:
+			// nop, the read deadline has been extended
+		case messageUserDataChanged:
+			var data userDataChanged
+			if err := json.Unmarshal(msg.Data, &data); err != nil {
+				log.Warn().Err(err).Str("server", w.name).Msg("Could not parse UserDataChanged message")
+				continue
+			}
+			w.handleUserDataChanged(ctx, eventChan, data)
+		default:
+			log.Debug().Str("server", w.name).Str("type", msg.MessageType).Msg("Ignoring WebSocket message")
+		}
+	}
+}
+
+func (w *WebsocketSource) dial(ctx context.Context) (*websocket.Conn, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: connectTimeout,
+		TLSClientConfig:  &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, w.socket.String(), nil)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("unexpected status code %d: %w", resp.StatusCode, err)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (w *WebsocketSource) handleUserDataChanged(ctx context.Context, eventChan chan events.EventSyncRequest, data userDataChanged) {
+	for _, userData := range data.UserDataList {
+		if userData.ItemId == "" {
+			continue
+		}
+
+		syncRequest := events.EventSyncRequest{
+			Source:   eventSourceName,
+			Metadata: w.name,
+			ItemID:   userData.ItemId,
+			Server:   w.name,
+			UserID:   data.UserId,
+			// the result is not awaited, so the app must not block when responding
+			Response: make(chan error, 1),
+		}
+
+		select {
+		case eventChan <- syncRequest:
+			log.Debug().Str("server", w.name).Str("item", userData.ItemId).Msg("Received UserDataChanged message")
+		case <-time.After(eventDeliverTimeout):
+			log.Warn().Str("server", w.name).Str("item", userData.ItemId).Msg("Dropping UserDataChanged message, sync is busy")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type message struct {
+	MessageType string          `json:"MessageType"`
+	Data        json.RawMessage `json:"Data,omitempty"`
+}
+
+type userDataChanged struct {
+	UserId       string `json:"UserId"`
+	UserDataList []struct {
+		ItemId string `json:"ItemId"`
+	} `json:"UserDataList"`
+}
+
+// connection serializes writes to the WebSocket, as only one writer is allowed at a time.
+type connection struct {
+	conn  *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (c *connection) sendKeepAlive() error {
+	data, err := json.Marshal(message{MessageType: messageKeepAlive})
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(connectTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// close initiates the closing handshake, the connection is closed when the context is canceled.
+func (c *connection) close() {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// keepAlive sends keep alive messages in the given interval, the interval is updated when the server announces it.
+func (c *connection) keepAlive(ctx context.Context, interval time.Duration, intervals chan time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.sendKeepAlive(); err != nil {
+				return
+			}
+		case interval := <-intervals:
+			ticker.Reset(interval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
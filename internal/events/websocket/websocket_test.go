@@ -0,0 +1,297 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/soerenschneider/jellyporter/internal/events"
+)
+
+// fakeJellyfin is a minimal Jellyfin server that upgrades requests to its socket endpoint and sends the messages sent
+// to its channel to the connected client.
+type fakeJellyfin struct {
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+	messages chan []byte
+	// connections is the number of connections that have been accepted
+	connections chan int
+	// received are the messages received from the client
+	received chan message
+	// dropFirst closes the first connection right after the upgrade
+	dropFirst bool
+	// ping sends a ping before each message
+	ping bool
+
+	mutex sync.Mutex
+	cnt   int
+}
+
+func newFakeJellyfin(t *testing.T) *fakeJellyfin {
+	t.Helper()
+	f := &fakeJellyfin{
+		messages:    make(chan []byte, 10),
+		connections: make(chan int, 10),
+		received:    make(chan message, 10),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.handle(t, w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeJellyfin) handle(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/jellyfin/socket" || r.URL.Query().Get("api_key") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		t.Errorf("could not upgrade connection: %v", err)
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	f.mutex.Lock()
+	f.cnt++
+	cnt := f.cnt
+	f.mutex.Unlock()
+	f.connections <- cnt
+
+	if f.dropFirst && cnt == 1 {
+		return
+	}
+
+	var writeMutex sync.Mutex
+	write := func(payload []byte) error {
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, payload)
+	}
+
+	conn.SetPongHandler(func(data string) error {
+		f.record(message{MessageType: "pong:" + data})
+		return nil
+	})
+	go f.receive(t, conn, write)
+
+	_ = write([]byte(`{"MessageType":"ForceKeepAlive","Data":2}`))
+	for payload := range f.messages {
+		if f.ping {
+			_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second))
+		}
+		if err := write(payload); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeJellyfin) receive(t *testing.T, conn *websocket.Conn, write func([]byte) error) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if messageType != websocket.TextMessage {
+			t.Errorf("unexpected message type %d", messageType)
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Errorf("could not parse message: %v", err)
+			continue
+		}
+		if msg.MessageType == messageKeepAlive {
+			_ = write([]byte(`{"MessageType":"KeepAlive"}`))
+		}
+		f.record(msg)
+	}
+}
+
+// record stores a received message without blocking when nobody is interested in the messages.
+func (f *fakeJellyfin) record(msg message) {
+	select {
+	case f.received <- msg:
+	default:
+	}
+}
+
+func TestWebsocketSource_Listen(t *testing.T) {
+	payload := []byte(`{"MessageType":"UserDataChanged","Data":{"UserId":"user","UserDataList":[{"ItemId":"abc","Played":true},{"ItemId":"def"}]}}`)
+	want := []events.EventSyncRequest{
+		{Source: eventSourceName, Metadata: "jellyfin", ItemID: "abc", Server: "jellyfin", UserID: "user"},
+		{Source: eventSourceName, Metadata: "jellyfin", ItemID: "def", Server: "jellyfin", UserID: "user"},
+	}
+
+	tests := []struct {
+		name      string
+		dropFirst bool
+		ping      bool
+		payloads  [][]byte
+		want      []events.EventSyncRequest
+	}{
+		{
+			name:     "UserDataChanged",
+			payloads: [][]byte{payload},
+			want:     want,
+		},
+		{
+			name:     "Ignore other messages",
+			payloads: [][]byte{[]byte(`{"MessageType":"Sessions","Data":[]}`), []byte(`invalid`), payload},
+			want:     want,
+		},
+		{
+			name:      "Reconnect",
+			dropFirst: true,
+			payloads:  [][]byte{payload},
+			want:      want,
+		},
+		{
+			name:     "Ping",
+			ping:     true,
+			payloads: [][]byte{payload},
+			want:     want,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jellyfin := newFakeJellyfin(t)
+			jellyfin.dropFirst = tt.dropFirst
+			jellyfin.ping = tt.ping
+
+			source, err := New("jellyfin", jellyfin.server.URL+"/jellyfin/", "secret", WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			ctx := t.Context()
+			eventChan := make(chan events.EventSyncRequest)
+			wg := &sync.WaitGroup{}
+			go func() {
+				if err := source.Listen(ctx, eventChan, wg); err != nil {
+					t.Errorf("Listen() error = %v", err)
+				}
+			}()
+
+			wantConnections := 1
+			if tt.dropFirst {
+				wantConnections = 2
+			}
+			for cnt := range jellyfin.connections {
+				if cnt == wantConnections {
+					break
+				}
+			}
+
+			for _, payload := range tt.payloads {
+				jellyfin.messages <- payload
+			}
+			for _, want := range tt.want {
+				select {
+				case got := <-eventChan:
+					if got.Response == nil {
+						t.Errorf("Listen() expected response channel")
+					}
+					got.Response = nil
+					if got != want {
+						t.Errorf("Listen() got = %v, want %v", got, want)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("Listen() did not send sync request")
+				}
+			}
+
+			if tt.ping {
+				expectMessage(t, jellyfin.received, "pong:ping")
+			}
+		})
+	}
+}
+
+func TestWebsocketSource_KeepAlive(t *testing.T) {
+	jellyfin := newFakeJellyfin(t)
+
+	source, err := New("jellyfin", jellyfin.server.URL+"/jellyfin", "secret")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx := t.Context()
+	wg := &sync.WaitGroup{}
+	go func() {
+		_ = source.Listen(ctx, make(chan events.EventSyncRequest), wg)
+	}()
+
+	// the keep alive is answered right away and then sent every second as requested by the server
+	start := time.Now()
+	expectMessage(t, jellyfin.received, messageKeepAlive)
+	expectMessage(t, jellyfin.received, messageKeepAlive)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("keep alive interval not applied, took %v", elapsed)
+	}
+}
+
+// expectMessage waits for a message of the given type, skipping all other messages.
+func expectMessage(t *testing.T, received chan message, messageType string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-received:
+			if msg.MessageType == messageType {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("did not receive message %q", messageType)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		address    string
+		wantSocket string
+		wantErr    bool
+	}{
+		{
+			name:       "http",
+			address:    "http://jellyfin.local",
+			wantSocket: "ws://jellyfin.local/socket?api_key=key&deviceId=jellyporter-name",
+		},
+		{
+			name:       "https with path",
+			address:    "https://example.com:8920/jellyfin/",
+			wantSocket: "wss://example.com:8920/jellyfin/socket?api_key=key&deviceId=jellyporter-name",
+		},
+		{
+			name:    "unsupported scheme",
+			address: "ftp://jellyfin.local",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New("name", tt.address, "key")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.socket.String() != tt.wantSocket {
+				t.Errorf("New() socket = %v, want %v", got.socket, tt.wantSocket)
+			}
+		})
+	}
+}
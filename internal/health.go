@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+// ClientStatus is the health of a client as seen by the syncs that have fetched items from it.
+type ClientStatus struct {
+	Name                string     `json:"name"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// HealthReport is the health of the app. The app is ready if the database can be used and the last sync has reached
+// every client.
+type HealthReport struct {
+	Ready            bool           `json:"ready"`
+	Database         string         `json:"database"`
+	LastSync         *time.Time     `json:"last_sync,omitempty"`
+	SyncRunningSince *time.Time     `json:"sync_running_since,omitempty"`
+	Clients          []ClientStatus `json:"clients"`
+}
+
+// Health returns the health of the database and of each client that is synced.
+func (a *App) Health(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Ready:    true,
+		Database: "ok",
+	}
+
+	if err := a.db.Check(ctx); err != nil {
+		report.Ready = false
+		report.Database = err.Error()
+	}
+
+	a.healthMutex.Lock()
+	defer a.healthMutex.Unlock()
+
+	if !a.lastSync.IsZero() {
+		lastSync := a.lastSync
+		report.LastSync = &lastSync
+	}
+	if !a.syncRunningSince.IsZero() {
+		runningSince := a.syncRunningSince
+		report.SyncRunningSince = &runningSince
+	}
+
+	report.Clients = make([]ClientStatus, 0, len(a.clientStatus))
+	for _, status := range a.clientStatus {
+		if status.LastSuccess == nil || status.ConsecutiveFailures > 0 {
+			report.Ready = false
+		}
+		report.Clients = append(report.Clients, *status)
+	}
+	slices.SortFunc(report.Clients, func(a, b ClientStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return report
+}
+
+// syncStarted marks a sync as running.
+func (a *App) syncStarted() {
+	a.healthMutex.Lock()
+	defer a.healthMutex.Unlock()
+
+	a.syncRunningSince = time.Now()
+}
+
+// syncFinished updates the status of each client that has been synced by the current run using its sync results.
+func (a *App) syncFinished() {
+	errs := map[string][]string{}
+	for _, result := range a.SyncResults() {
+		if result.RunID == a.runID {
+			errs[result.Server] = append(errs[result.Server], result.Errors...)
+		}
+	}
+
+	a.healthMutex.Lock()
+	defer a.healthMutex.Unlock()
+
+	now := time.Now()
+	a.lastSync = now
+	a.syncRunningSince = time.Time{}
+	for server, err := range errs {
+		status, found := a.clientStatus[server]
+		if !found {
+			continue
+		}
+
+		if len(err) == 0 {
+			status.LastSuccess = &now
+			status.ConsecutiveFailures = 0
+			metrics.ClientConsecutiveFailures.WithLabelValues(server).Set(0)
+			continue
+		}
+
+		status.LastFailure = &now
+		status.LastError = strings.Join(err, "; ")
+		status.ConsecutiveFailures++
+		metrics.ClientConsecutiveFailures.WithLabelValues(server).Set(float64(status.ConsecutiveFailures))
+	}
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal"
+)
+
+const checkTimeout = 2 * time.Second
+
+type Checker interface {
+	Health(ctx context.Context) internal.HealthReport
+}
+
+// LivenessHandler reports the health of the app but always responds with 200 as long as the process is able to serve
+// requests. A sync that is stuck or clients that can not be reached do not make the process unhealthy.
+func LivenessHandler(checker Checker) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeReport(rw, r, checker, false)
+	})
+}
+
+// ReadinessHandler responds with 503 unless the database can be used and the last sync has reached every client.
+func ReadinessHandler(checker Checker) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		writeReport(rw, r, checker, true)
+	})
+}
+
+func writeReport(rw http.ResponseWriter, r *http.Request, checker Checker, readiness bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	report := checker.Health(ctx)
+	status := http.StatusOK
+	if readiness && !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(report); err != nil {
+		log.Warn().Err(err).Msg("could not write health report")
+	}
+}
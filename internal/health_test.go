@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/soerenschneider/jellyporter/internal/config"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+// fakeDb is a LibraryDb that only supports health checks.
+type fakeDb struct {
+	LibraryDb
+	err error
+}
+
+func (d *fakeDb) Check(_ context.Context) error {
+	return d.err
+}
+
+// fakeClient is a JellyfinClient that is never called.
+type fakeClient struct {
+	JellyfinClient
+}
+
+func newTestApp(t *testing.T, db LibraryDb, clients map[string]JellyfinClient) *App {
+	t.Helper()
+
+	cfg := &config.Config{
+		Clients:   map[string]config.JellyfinServerConfig{},
+		ItemTypes: []string{string(jellyfin.ItemMovie)},
+	}
+	for name := range clients {
+		cfg.Clients[name] = config.JellyfinServerConfig{User: "user"}
+	}
+
+	app, err := NewApp(clients, db, cfg)
+	if err != nil {
+		t.Fatalf("NewApp() error = %v", err)
+	}
+	return app
+}
+
+// runSync simulates a sync run that fetched items from every server, failing for the servers in errs.
+func runSync(app *App, runID string, errs map[string]error) {
+	app.runID = runID
+	app.syncStarted()
+	for _, server := range []string{"a", "b"} {
+		app.updateSyncResult(server, config.DefaultUser, jellyfin.ItemMovie, func(result *SyncResult) {
+			if err := errs[server]; err != nil {
+				result.addError(err)
+			}
+		})
+	}
+	app.syncFinished()
+}
+
+func TestApp_Health(t *testing.T) {
+	tests := []struct {
+		name         string
+		dbErr        error
+		runs         []map[string]error
+		wantReady    bool
+		wantFailures map[string]int
+		wantSuccess  map[string]bool
+	}{
+		{
+			name:         "Not ready before the first sync",
+			wantReady:    false,
+			wantFailures: map[string]int{"a": 0, "b": 0},
+			wantSuccess:  map[string]bool{"a": false, "b": false},
+		},
+		{
+			name:         "Ready after a successful sync",
+			runs:         []map[string]error{{}},
+			wantReady:    true,
+			wantFailures: map[string]int{"a": 0, "b": 0},
+			wantSuccess:  map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:         "Not ready if the database is unavailable",
+			dbErr:        errors.New("database is locked"),
+			runs:         []map[string]error{{}},
+			wantReady:    false,
+			wantFailures: map[string]int{"a": 0, "b": 0},
+			wantSuccess:  map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:         "Not ready if a client is unreachable",
+			runs:         []map[string]error{{"b": errors.New("connection refused")}},
+			wantReady:    false,
+			wantFailures: map[string]int{"a": 0, "b": 1},
+			wantSuccess:  map[string]bool{"a": true, "b": false},
+		},
+		{
+			name: "Consecutive failures are counted",
+			runs: []map[string]error{
+				{},
+				{"b": errors.New("connection refused")},
+				{"b": errors.New("connection refused")},
+			},
+			wantReady:    false,
+			wantFailures: map[string]int{"a": 0, "b": 2},
+			wantSuccess:  map[string]bool{"a": true, "b": true},
+		},
+		{
+			name: "Ready again after a client recovered",
+			runs: []map[string]error{
+				{"b": errors.New("connection refused")},
+				{},
+			},
+			wantReady:    true,
+			wantFailures: map[string]int{"a": 0, "b": 0},
+			wantSuccess:  map[string]bool{"a": true, "b": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, &fakeDb{err: tt.dbErr}, map[string]JellyfinClient{"a": &fakeClient{}, "b": &fakeClient{}})
+			for idx, errs := range tt.runs {
+				runSync(app, string(rune('a'+idx)), errs)
+			}
+
+			report := app.Health(context.Background())
+			if report.Ready != tt.wantReady {
+				t.Errorf("Health() ready = %v, want %v", report.Ready, tt.wantReady)
+			}
+			if (report.Database == "ok") != (tt.dbErr == nil) {
+				t.Errorf("Health() database = %q", report.Database)
+			}
+			if (report.LastSync != nil) != (len(tt.runs) > 0) {
+				t.Errorf("Health() last sync = %v", report.LastSync)
+			}
+			if report.SyncRunningSince != nil {
+				t.Errorf("Health() sync running since = %v, want nil", report.SyncRunningSince)
+			}
+
+			if len(report.Clients) != len(tt.wantFailures) {
+				t.Fatalf("Health() got %d clients, want %d", len(report.Clients), len(tt.wantFailures))
+			}
+			for _, client := range report.Clients {
+				if client.ConsecutiveFailures != tt.wantFailures[client.Name] {
+					t.Errorf("client %s: consecutive failures = %d, want %d", client.Name, client.ConsecutiveFailures, tt.wantFailures[client.Name])
+				}
+				if (client.LastSuccess != nil) != tt.wantSuccess[client.Name] {
+					t.Errorf("client %s: last success = %v, want %v", client.Name, client.LastSuccess, tt.wantSuccess[client.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestApp_HealthSyncRunning(t *testing.T) {
+	app := newTestApp(t, &fakeDb{}, map[string]JellyfinClient{"a": &fakeClient{}, "b": &fakeClient{}})
+	runSync(app, "a", nil)
+
+	app.syncStarted()
+	report := app.Health(context.Background())
+	if report.SyncRunningSince == nil {
+		t.Fatal("Health() sync running since = nil")
+	}
+	if !report.Ready {
+		t.Error("Health() is not ready while a sync is running")
+	}
+}
+
+func TestApp_HealthUnmappedClient(t *testing.T) {
+	cfg := &config.Config{
+		Clients: map[string]config.JellyfinServerConfig{
+			"a": {User: "user"},
+			"b": {User: "user"},
+			"c": {User: "user"},
+		},
+		Users:     map[string]map[string]string{"alice": {"a": "alice", "b": "alice"}},
+		ItemTypes: []string{string(jellyfin.ItemMovie)},
+	}
+	app, err := NewApp(map[string]JellyfinClient{"a": &fakeClient{}, "b": &fakeClient{}, "c": &fakeClient{}}, &fakeDb{}, cfg)
+	if err != nil {
+		t.Fatalf("NewApp() error = %v", err)
+	}
+	runSync(app, "a", nil)
+
+	report := app.Health(context.Background())
+	if !report.Ready {
+		t.Errorf("Health() is not ready, clients %v", report.Clients)
+	}
+	for _, client := range report.Clients {
+		if client.Name == "c" {
+			t.Errorf("Health() reports client %q that is not synced for any user", client.Name)
+		}
+	}
+}
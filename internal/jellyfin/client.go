@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,9 +29,15 @@ type SortOrder string
 const (
 	ItemEpisode         ItemType   = "Episode"
 	ItemMovie           ItemType   = "Movie"
+	ItemAudio           ItemType   = "Audio"
+	ItemAudioBook       ItemType   = "AudioBook"
+	ItemMusicVideo      ItemType   = "MusicVideo"
 	SortFieldDatePlayed SortFields = "DatePlayed"
 	SortOrderAscending  SortOrder  = "Ascending"
 	SortOrderDescending SortOrder  = "Descending"
+
+	// seriesBatchSize is the number of series that are looked up per request
+	seriesBatchSize = 100
 )
 
 var (
@@ -41,18 +50,23 @@ type Client struct {
 	apiKey  string
 	client  *http.Client
 
-	userName string
-	userId   string
+	// userIds caches the IDs of already resolved user names
+	userIds map[string]string
+	// serverId caches the ID of the server
+	serverId string
+	// excluded caches the items of excluded parents, which are only fetched again by full syncs
+	excluded map[excludedKey]map[string]bool
 
 	mutex sync.Mutex
 }
 
-func NewJellyfinClient(baseURL, apiKey, userName string) *Client {
+func NewJellyfinClient(baseURL, apiKey string) *Client {
 	return &Client{
 		baseURL:  baseURL,
 		apiKey:   apiKey,
-		userName: userName,
 		client:   defaultClient,
+		userIds:  map[string]string{},
+		excluded: map[excludedKey]map[string]bool{},
 	}
 }
 
@@ -62,7 +76,9 @@ type ItemQueryOpts struct {
 	StartIndex int `validate:"gte=0"`
 	SortBy     SortFields
 	SortOrder  SortOrder
-	Type       ItemType `validate:"required,oneof=Movie Episode"`
+	Type       ItemType `validate:"required,oneof=Movie Episode Audio AudioBook MusicVideo"`
+	// Filter restricts the items that are fetched
+	Filter ItemFilter
 }
 
 func (o ItemQueryOpts) IsDelta() bool {
@@ -74,6 +90,56 @@ func (j *Client) GetItems(ctx context.Context, userID string, opts ItemQueryOpts
 		return nil, fmt.Errorf("validation of query opts failed: %w", err)
 	}
 
+	parents, err := j.resolveParents(ctx, userID, opts.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve filter: %w", err)
+	}
+
+	// skip holds the items that have already been added and the items of excluded parents, which can not be excluded
+	// by the query
+	excluded, err := j.excludedItems(ctx, userID, opts.Type, parents.exclude, !opts.IsDelta())
+	if err != nil {
+		return nil, err
+	}
+	skip := maps.Clone(excluded)
+
+	parentIDs := parents.include
+	if !parents.restricted {
+		parentIDs = []string{""}
+	}
+
+	var allItems []Item
+	for _, parentID := range parentIDs {
+		items, err := j.getItems(ctx, userID, parentID, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			if skip[item.ID] || !opts.Filter.matchesTagsAndGenres(item) {
+				continue
+			}
+			// parents may overlap, e.g. a collection and the library its items are stored in
+			skip[item.ID] = true
+			allItems = append(allItems, item)
+		}
+	}
+
+	if opts.Type == ItemEpisode {
+		if err := j.setSeriesProviderIDs(ctx, userID, allItems); err != nil {
+			return nil, fmt.Errorf("could not look up series of episodes: %w", err)
+		}
+	}
+
+	return &ItemsResponse{
+		Items:            allItems,
+		TotalRecordCount: len(allItems),
+		StartIndex:       0,
+	}, nil
+}
+
+// getItems fetches the items of the given parent, or of all libraries if parentID is empty, page by page.
+func (j *Client) getItems(ctx context.Context, userID, parentID string, opts ItemQueryOpts) ([]Item, error) {
 	var allMovies []Item
 	startIndex := opts.StartIndex
 
@@ -94,6 +160,20 @@ func (j *Client) GetItems(ctx context.Context, userID string, opts ItemQueryOpts
 			params.Set("SortOrder", string(opts.SortOrder))
 		}
 
+		if parentID != "" {
+			params.Set("ParentId", parentID)
+		}
+		if len(opts.Filter.IncludeTags) > 0 {
+			params.Set("Tags", strings.Join(opts.Filter.IncludeTags, "|"))
+		}
+		if len(opts.Filter.IncludeGenres) > 0 {
+			params.Set("Genres", strings.Join(opts.Filter.IncludeGenres, "|"))
+		}
+		if !opts.Filter.IsEmpty() {
+			// tags and genres are checked again, as the exclusions can not be expressed in the query
+			params.Set("Fields", "ProviderIds,Tags,Genres")
+		}
+
 		endpoint := fmt.Sprintf("/Users/%s/Items?%s", userID, params.Encode())
 
 		data, err := j.makeRequest(ctx, http.MethodGet, endpoint, nil)
@@ -131,11 +211,74 @@ func (j *Client) GetItems(ctx context.Context, userID string, opts ItemQueryOpts
 		startIndex += opts.Limit
 	}
 
-	return &ItemsResponse{
-		Items:            allMovies,
-		TotalRecordCount: len(allMovies),
-		StartIndex:       0,
-	}, nil
+	return allMovies, nil
+}
+
+// GetItem returns a single item including its UserData for the given user.
+func (j *Client) GetItem(ctx context.Context, userID, itemID string) (*Item, error) {
+	params := url.Values{}
+	params.Set("userId", userID)
+	params.Set("Fields", "ProviderIds,Tags,Genres")
+
+	endpoint := fmt.Sprintf("/Items/%s?%s", url.PathEscape(itemID), params.Encode())
+	data, err := j.makeRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+
+	if ItemType(item.Type) == ItemEpisode {
+		items := []Item{item}
+		if err := j.setSeriesProviderIDs(ctx, userID, items); err != nil {
+			return nil, fmt.Errorf("could not look up series of episode: %w", err)
+		}
+		item = items[0]
+	}
+
+	return &item, nil
+}
+
+// setSeriesProviderIDs sets the provider IDs of the series of the episodes, which are looked up in batches.
+func (j *Client) setSeriesProviderIDs(ctx context.Context, userID string, episodes []Item) error {
+	series := map[string]ProviderIDs{}
+	var seriesIDs []string
+	for _, episode := range episodes {
+		if _, found := series[episode.SeriesId]; episode.SeriesId != "" && !found {
+			series[episode.SeriesId] = ProviderIDs{}
+			seriesIDs = append(seriesIDs, episode.SeriesId)
+		}
+	}
+
+	for batch := range slices.Chunk(seriesIDs, seriesBatchSize) {
+		params := url.Values{}
+		params.Set("Ids", strings.Join(batch, ","))
+		params.Set("Fields", "ProviderIds")
+
+		endpoint := fmt.Sprintf("/Users/%s/Items?%s", userID, params.Encode())
+		data, err := j.makeRequest(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return err
+		}
+
+		var response ItemsResponse
+		if err := json.Unmarshal(data, &response); err != nil {
+			return err
+		}
+
+		for _, item := range response.Items {
+			series[item.ID] = item.ProviderIDs
+		}
+	}
+
+	for idx := range episodes {
+		episodes[idx].SeriesProviderIDs = series[episodes[idx].SeriesId]
+	}
+
+	return nil
 }
 
 func (j *Client) UpdateUserData(ctx context.Context, userID, itemID string, userData UserDataUpdate) error {
@@ -157,20 +300,46 @@ func (j *Client) MarkWatched(ctx context.Context, userID, itemID string) error {
 	return err
 }
 
-func (j *Client) GetUserId(ctx context.Context) (string, error) {
+func (j *Client) GetUserId(ctx context.Context, userName string) (string, error) {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
-	if j.userId != "" {
-		return j.userId, nil
+	if userId, found := j.userIds[userName]; found {
+		return userId, nil
 	}
 
-	user, err := j.GetUser(ctx, j.userName)
+	user, err := j.GetUser(ctx, userName)
 	if err != nil {
 		return "", err
 	}
 
-	j.userId = user.ID
-	return j.userId, nil
+	j.userIds[userName] = user.ID
+	return user.ID, nil
+}
+
+// GetServerId returns the ID of the Jellyfin server, e.g. to identify the server that has sent a webhook.
+func (j *Client) GetServerId(ctx context.Context) (string, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.serverId != "" {
+		return j.serverId, nil
+	}
+
+	data, err := j.makeRequest(ctx, http.MethodGet, "/System/Info/Public", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var info SystemInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", err
+	}
+
+	if info.ID == "" {
+		return "", errors.New("empty server id")
+	}
+
+	j.serverId = info.ID
+	return info.ID, nil
 }
 
 func (j *Client) GetUser(ctx context.Context, name string) (User, error) {
@@ -0,0 +1,57 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClient_GetItemsSeriesProviderIDs(t *testing.T) {
+	season, episode := 1, 2
+	series := map[string]Item{
+		"bb":  {ID: "bb", Name: "Breaking Bad", ProviderIDs: ProviderIDs{TVDB: "81189"}},
+		"bcs": {ID: "bcs", Name: "Better Call Saul", ProviderIDs: ProviderIDs{TMDB: "60059"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response ItemsResponse
+		if ids := r.URL.Query().Get("Ids"); ids != "" {
+			for _, id := range strings.Split(ids, ",") {
+				response.Items = append(response.Items, series[id])
+			}
+		} else {
+			response.Items = []Item{
+				{ID: "1", Name: "Pilot", SeriesId: "bb", ParentIndexNumber: &season, IndexNumber: &episode},
+				{ID: "2", Name: "Uno", SeriesId: "bcs"},
+				{ID: "3", Name: "Cat's in the Bag...", SeriesId: "bb"},
+			}
+		}
+
+		response.TotalRecordCount = len(response.Items)
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewJellyfinClient(server.URL, "key")
+	got, err := client.GetItems(t.Context(), "user", ItemQueryOpts{Limit: 500, Type: ItemEpisode})
+	if err != nil {
+		t.Fatalf("GetItems() error = %v", err)
+	}
+
+	want := map[string]ProviderIDs{
+		"1": {TVDB: "81189"},
+		"2": {TMDB: "60059"},
+		"3": {TVDB: "81189"},
+	}
+	for _, item := range got.Items {
+		if !reflect.DeepEqual(item.SeriesProviderIDs, want[item.ID]) {
+			t.Errorf("GetItems() series provider ids of %q = %v, want %v", item.ID, item.SeriesProviderIDs, want[item.ID])
+		}
+	}
+	if got.Items[0].ParentIndexNumber == nil || *got.Items[0].ParentIndexNumber != 1 || *got.Items[0].IndexNumber != 2 {
+		t.Errorf("GetItems() expected season and episode number to be set, got %v", got.Items[0])
+	}
+}
@@ -0,0 +1,224 @@
+package jellyfin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ItemFilter restricts the items that are synced. An item needs to match any of the include conditions of each kind
+// that is set and must not match any of the exclude conditions. Libraries are identified by their name, parents by the
+// ID of a library, collection or folder.
+type ItemFilter struct {
+	IncludeLibraries []string
+	ExcludeLibraries []string
+	IncludeParentIDs []string
+	ExcludeParentIDs []string
+	IncludeTags      []string
+	ExcludeTags      []string
+	IncludeGenres    []string
+	ExcludeGenres    []string
+}
+
+// IsEmpty returns true if the filter does not restrict the items at all.
+func (f ItemFilter) IsEmpty() bool {
+	return !f.hasParents() && len(f.IncludeTags) == 0 && len(f.ExcludeTags) == 0 && len(f.IncludeGenres) == 0 && len(f.ExcludeGenres) == 0
+}
+
+func (f ItemFilter) hasParents() bool {
+	return len(f.IncludeLibraries) > 0 || len(f.ExcludeLibraries) > 0 || len(f.IncludeParentIDs) > 0 || len(f.ExcludeParentIDs) > 0
+}
+
+// matchesTagsAndGenres checks the tags and genres of the item, which requires the item to be fetched with its tags
+// and genres.
+func (f ItemFilter) matchesTagsAndGenres(item Item) bool {
+	if len(f.IncludeTags) > 0 && !containsAny(f.IncludeTags, item.Tags) {
+		return false
+	}
+	if len(f.IncludeGenres) > 0 && !containsAny(f.IncludeGenres, item.Genres) {
+		return false
+	}
+
+	return !containsAny(f.ExcludeTags, item.Tags) && !containsAny(f.ExcludeGenres, item.Genres)
+}
+
+// containsAny checks case-insensitively whether any of the values is contained in the list.
+func containsAny(list, values []string) bool {
+	return slices.ContainsFunc(values, func(value string) bool {
+		return slices.ContainsFunc(list, func(entry string) bool {
+			return strings.EqualFold(entry, value)
+		})
+	})
+}
+
+// resolvedParents are the parents of an ItemFilter with the names of the libraries resolved to their IDs.
+type resolvedParents struct {
+	// restricted is true if only the items of the parents in include are queried, otherwise all items are queried
+	restricted bool
+	include    []string
+	// exclude are the parents whose items are skipped
+	exclude []string
+}
+
+// resolveParents resolves the names of the libraries of the filter to their IDs. Libraries that are excluded are
+// removed from the parents to query and are only listed as excluded parents if other parents are included.
+func (j *Client) resolveParents(ctx context.Context, userID string, filter ItemFilter) (resolvedParents, error) {
+	ret := resolvedParents{
+		restricted: len(filter.IncludeLibraries) > 0 || len(filter.ExcludeLibraries) > 0 || len(filter.IncludeParentIDs) > 0,
+		include:    slices.Clone(filter.IncludeParentIDs),
+		exclude:    slices.Clone(filter.ExcludeParentIDs),
+	}
+	if len(filter.IncludeLibraries) == 0 && len(filter.ExcludeLibraries) == 0 {
+		return ret, nil
+	}
+
+	views, err := j.getViews(ctx, userID)
+	if err != nil {
+		return resolvedParents{}, err
+	}
+
+	for _, library := range filter.IncludeLibraries {
+		idx := slices.IndexFunc(views, func(view Item) bool {
+			return strings.EqualFold(view.Name, library)
+		})
+		if idx < 0 {
+			return resolvedParents{}, fmt.Errorf("library %q not found", library)
+		}
+		ret.include = append(ret.include, views[idx].ID)
+	}
+
+	var excluded []string
+	for _, view := range views {
+		if containsAny(filter.ExcludeLibraries, []string{view.Name}) {
+			excluded = append(excluded, view.ID)
+		}
+	}
+	if len(filter.IncludeParentIDs) > 0 {
+		// included collections or folders may contain items of excluded libraries, otherwise the excluded libraries
+		// are simply not queried
+		ret.exclude = append(ret.exclude, excluded...)
+	}
+
+	if len(filter.IncludeLibraries) == 0 && len(filter.IncludeParentIDs) == 0 {
+		// only libraries are excluded, so all other libraries are queried
+		for _, view := range views {
+			ret.include = append(ret.include, view.ID)
+		}
+	}
+	ret.include = slices.DeleteFunc(ret.include, func(id string) bool {
+		return slices.Contains(excluded, id)
+	})
+
+	return ret, nil
+}
+
+type excludedKey struct {
+	userID   string
+	itemType ItemType
+	parents  string
+}
+
+// excludedItems returns the IDs of the items of the excluded parents. Listing all items of the excluded parents is
+// expensive, so the IDs are cached and only fetched again if refresh is set, i.e. once per full sync. Items that are
+// added to an excluded parent in between may be synced by delta syncs until the next full sync.
+func (j *Client) excludedItems(ctx context.Context, userID string, itemType ItemType, parentIDs []string, refresh bool) (map[string]bool, error) {
+	if len(parentIDs) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	key := excludedKey{userID: userID, itemType: itemType, parents: strings.Join(parentIDs, ",")}
+	if !refresh {
+		j.mutex.Lock()
+		excluded, found := j.excluded[key]
+		j.mutex.Unlock()
+		if found {
+			return excluded, nil
+		}
+	}
+
+	excluded := map[string]bool{}
+	for _, parentID := range parentIDs {
+		items, err := j.getItems(ctx, userID, parentID, ItemQueryOpts{Limit: 1000, Type: itemType})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			excluded[item.ID] = true
+		}
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	j.excluded[key] = excluded
+	return excluded, nil
+}
+
+// getViews returns the libraries of the user.
+func (j *Client) getViews(ctx context.Context, userID string) ([]Item, error) {
+	data, err := j.makeRequest(ctx, http.MethodGet, fmt.Sprintf("/Users/%s/Views", userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response ItemsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Items, nil
+}
+
+// getAncestors returns all parents of the item up to the root folder.
+func (j *Client) getAncestors(ctx context.Context, userID, itemID string) ([]Item, error) {
+	params := url.Values{}
+	params.Set("userId", userID)
+
+	endpoint := fmt.Sprintf("/Items/%s/Ancestors?%s", url.PathEscape(itemID), params.Encode())
+	data, err := j.makeRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ancestors []Item
+	if err := json.Unmarshal(data, &ancestors); err != nil {
+		return nil, err
+	}
+
+	return ancestors, nil
+}
+
+// IsIncluded checks whether the item matches the filter, e.g. before syncing a single item that an event refers to.
+// The item needs to be fetched using GetItem to include its tags and genres.
+func (j *Client) IsIncluded(ctx context.Context, userID string, item Item, filter ItemFilter) (bool, error) {
+	if !filter.matchesTagsAndGenres(item) {
+		return false, nil
+	}
+	if !filter.hasParents() {
+		return true, nil
+	}
+
+	parents, err := j.resolveParents(ctx, userID, filter)
+	if err != nil {
+		return false, err
+	}
+
+	ancestors, err := j.getAncestors(ctx, userID, item.ID)
+	if err != nil {
+		return false, err
+	}
+
+	isAncestor := func(id string) bool {
+		return slices.ContainsFunc(ancestors, func(ancestor Item) bool {
+			return ancestor.ID == id
+		})
+	}
+	if slices.ContainsFunc(parents.exclude, isAncestor) {
+		return false, nil
+	}
+
+	return !parents.restricted || slices.ContainsFunc(parents.include, isAncestor), nil
+}
@@ -0,0 +1,248 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLibrary serves the views and items of a user with two libraries and a folder inside the first library.
+func fakeLibrary(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(fakeLibraryHandler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func fakeLibraryHandler() http.Handler {
+	played := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	items := map[string][]Item{
+		"movies": {
+			{ID: "a", Name: "Alien", Tags: []string{"Kids"}, UserData: UserData{LastPlayedDate: played}},
+			{ID: "b", Name: "Heat", Genres: []string{"Drama"}, UserData: UserData{LastPlayedDate: played}},
+		},
+		"home": {
+			{ID: "c", Name: "Birthday"},
+		},
+		"folder": {
+			{ID: "b", Name: "Heat", Genres: []string{"Drama"}, UserData: UserData{LastPlayedDate: played}},
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response ItemsResponse
+		switch r.URL.Path {
+		case "/Users/user/Views":
+			response.Items = []Item{{ID: "movies", Name: "Movies"}, {ID: "home", Name: "Home Videos"}}
+		case "/Users/user/Items":
+			parentID := r.URL.Query().Get("ParentId")
+			if parentID == "" {
+				response.Items = append(slices.Clone(items["movies"]), items["home"]...)
+			} else {
+				response.Items = items[parentID]
+			}
+			if tags := r.URL.Query().Get("Tags"); tags != "" {
+				response.Items = slices.DeleteFunc(slices.Clone(response.Items), func(item Item) bool {
+					return !containsAny(strings.Split(tags, "|"), item.Tags)
+				})
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		response.TotalRecordCount = len(response.Items)
+		_ = json.NewEncoder(w).Encode(response)
+	})
+}
+
+func TestClient_GetItemsFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  ItemFilter
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "No filter",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:   "Exclude library",
+			filter: ItemFilter{ExcludeLibraries: []string{"home videos"}},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "Include library",
+			filter: ItemFilter{IncludeLibraries: []string{"Movies"}},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "Include overlapping parents",
+			filter: ItemFilter{IncludeLibraries: []string{"Movies"}, IncludeParentIDs: []string{"folder"}},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "Include parent",
+			filter: ItemFilter{IncludeParentIDs: []string{"folder"}},
+			want:   []string{"b"},
+		},
+		{
+			name:   "Exclude parent",
+			filter: ItemFilter{ExcludeParentIDs: []string{"folder"}},
+			want:   []string{"a", "c"},
+		},
+		{
+			name:   "Include tag",
+			filter: ItemFilter{IncludeTags: []string{"kids"}},
+			want:   []string{"a"},
+		},
+		{
+			name:   "Exclude genre",
+			filter: ItemFilter{ExcludeGenres: []string{"Drama"}},
+			want:   []string{"a", "c"},
+		},
+		{
+			name:   "Exclude all libraries",
+			filter: ItemFilter{ExcludeLibraries: []string{"Movies", "Home Videos"}},
+		},
+		{
+			name:    "Unknown library",
+			filter:  ItemFilter{IncludeLibraries: []string{"Shows"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewJellyfinClient(fakeLibrary(t).URL, "key")
+			got, err := client.GetItems(t.Context(), "user", ItemQueryOpts{Limit: 500, Type: ItemMovie, Filter: tt.filter})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetItems() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var ids []string
+			for _, item := range got.Items {
+				ids = append(ids, item.ID)
+			}
+			slices.Sort(ids)
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("GetItems() got = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetItemsExcludedParentsCache(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Query().Get("ParentId")]++
+		mutex.Unlock()
+		fakeLibraryHandler().ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	since := time.Date(2025, 06, 01, 0, 0, 0, 0, time.UTC)
+	full := ItemQueryOpts{Limit: 500, Type: ItemMovie, Filter: ItemFilter{ExcludeParentIDs: []string{"folder"}}}
+	delta := full
+	delta.Since = &since
+
+	steps := []struct {
+		name        string
+		opts        ItemQueryOpts
+		want        []string
+		wantFetched int
+	}{
+		{name: "Full sync fetches the excluded items", opts: full, want: []string{"a", "c"}, wantFetched: 1},
+		{name: "Delta sync uses the cached items", opts: delta, want: []string{"a"}, wantFetched: 1},
+		{name: "Second delta sync uses the cached items", opts: delta, want: []string{"a"}, wantFetched: 1},
+		{name: "Next full sync fetches the excluded items again", opts: full, want: []string{"a", "c"}, wantFetched: 2},
+	}
+
+	client := NewJellyfinClient(server.URL, "key")
+	for _, step := range steps {
+		got, err := client.GetItems(t.Context(), "user", step.opts)
+		if err != nil {
+			t.Fatalf("%s: GetItems() error = %v", step.name, err)
+		}
+
+		var ids []string
+		for _, item := range got.Items {
+			ids = append(ids, item.ID)
+		}
+		slices.Sort(ids)
+		if !reflect.DeepEqual(ids, step.want) {
+			t.Errorf("%s: GetItems() got = %v, want %v", step.name, ids, step.want)
+		}
+
+		mutex.Lock()
+		fetched := requests["folder"]
+		mutex.Unlock()
+		if fetched != step.wantFetched {
+			t.Errorf("%s: excluded parent fetched %d times, want %d", step.name, fetched, step.wantFetched)
+		}
+	}
+}
+
+func TestClient_GetItemsExcludedLibraries(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      ItemFilter
+		want        []string
+		wantFetched int
+	}{
+		{
+			name:   "Excluded libraries are not queried",
+			filter: ItemFilter{ExcludeLibraries: []string{"Movies"}},
+			want:   []string{"c"},
+		},
+		{
+			name:        "Excluded libraries are listed if other parents are included",
+			filter:      ItemFilter{ExcludeLibraries: []string{"Movies"}, IncludeParentIDs: []string{"folder"}},
+			wantFetched: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			requests := map[string]int{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/Users/user/Items" {
+					mutex.Lock()
+					requests[r.URL.Query().Get("ParentId")]++
+					mutex.Unlock()
+				}
+				fakeLibraryHandler().ServeHTTP(w, r)
+			}))
+			t.Cleanup(server.Close)
+
+			client := NewJellyfinClient(server.URL, "key")
+			got, err := client.GetItems(t.Context(), "user", ItemQueryOpts{Limit: 500, Type: ItemMovie, Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("GetItems() error = %v", err)
+			}
+
+			var ids []string
+			for _, item := range got.Items {
+				ids = append(ids, item.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("GetItems() got = %v, want %v", ids, tt.want)
+			}
+			if requests["movies"] != tt.wantFetched {
+				t.Errorf("excluded library fetched %d times, want %d", requests["movies"], tt.wantFetched)
+			}
+		})
+	}
+}
@@ -13,7 +13,29 @@ type Item struct {
 	SeriesId    string      `json:"SeriesId"`
 	SeasonId    string      `json:"SeasonId"`
 	SeasonName  string      `json:"SeasonName"`
+	Album       string      `json:"Album"`
+	AlbumArtist string      `json:"AlbumArtist"`
+	Artists     []string    `json:"Artists"`
+	Tags        []string    `json:"Tags"`
+	Genres      []string    `json:"Genres"`
 	Runtime     int64       `json:"RunTimeTicks"`
+
+	// IndexNumber is the number of an episode within its season
+	IndexNumber *int `json:"IndexNumber"`
+	// ParentIndexNumber is the number of the season of an episode
+	ParentIndexNumber *int `json:"ParentIndexNumber"`
+	// SeriesProviderIDs are the provider IDs of the series of an episode, which are not part of the episode itself and
+	// are looked up separately
+	SeriesProviderIDs ProviderIDs `json:"-"`
+}
+
+// Artist returns the album artist of the item or its first artist if no album artist is set.
+func (i Item) Artist() string {
+	if i.AlbumArtist != "" || len(i.Artists) == 0 {
+		return i.AlbumArtist
+	}
+
+	return i.Artists[0]
 }
 
 type UserData struct {
@@ -31,6 +53,11 @@ type ProviderIDs struct {
 	IMDB string `json:"Imdb,omitempty"`
 	TMDB string `json:"Tmdb,omitempty"`
 	TVDB string `json:"Tvdb,omitempty"`
+
+	AniDB  string `json:"AniDB,omitempty"`
+	TVmaze string `json:"TvMaze,omitempty"`
+
+	MusicBrainzTrack string `json:"MusicBrainzTrack,omitempty"`
 }
 
 type ItemsResponse struct {
@@ -45,15 +72,16 @@ type WatcherOptions struct {
 	WatchedAfter time.Time
 }
 
+// UserDataUpdate holds the UserData fields to update. Fields that are nil are left untouched by Jellyfin.
 type UserDataUpdate struct {
-	IsFavorite            *bool     `json:"IsFavorite,omitempty"`
-	PlaybackPositionTicks *int64    `json:"PlaybackPositionTicks"`
-	PlayedPercentage      *float64  `json:"PlayedPercentage"`
-	PlayCount             int       `json:"PlayCount"`
-	LastPlayedDate        time.Time `json:"LastPlayedDate"`
-	Played                bool      `json:"Played"`
-	Key                   string    `json:"Key"`
-	ItemID                string    `json:"ItemId"`
+	IsFavorite            *bool      `json:"IsFavorite,omitempty"`
+	PlaybackPositionTicks *int64     `json:"PlaybackPositionTicks,omitempty"`
+	PlayedPercentage      *float64   `json:"PlayedPercentage,omitempty"`
+	PlayCount             *int       `json:"PlayCount,omitempty"`
+	LastPlayedDate        *time.Time `json:"LastPlayedDate,omitempty"`
+	Played                *bool      `json:"Played,omitempty"`
+	Key                   string     `json:"Key,omitempty"`
+	ItemID                string     `json:"ItemId,omitempty"`
 }
 
 type User struct {
@@ -62,6 +90,12 @@ type User struct {
 	ID       string `json:"Id"`
 }
 
+type SystemInfo struct {
+	ID         string `json:"Id"`
+	ServerName string `json:"ServerName"`
+	Version    string `json:"Version"`
+}
+
 type UsersResponse struct {
 	Users []User `json:"Users,omitempty"`
 }
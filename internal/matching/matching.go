@@ -0,0 +1,240 @@
+package matching
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"go.uber.org/multierr"
+)
+
+const (
+	ProviderImdb        = "imdb"
+	ProviderTmdb        = "tmdb"
+	ProviderTvdb        = "tvdb"
+	ProviderAniDb       = "anidb"
+	ProviderTvMaze      = "tvmaze"
+	ProviderMusicBrainz = "musicbrainz"
+
+	// namePrefix is the prefix of the keys of items that none of the strategies apply to and that are matched by name
+	namePrefix = "name_"
+	// seriesPrefix is the prefix of the strategies that match episodes by the provider ID of their series and their
+	// season and episode number, e.g. "series_tvdb"
+	seriesPrefix = "series_"
+)
+
+// RuntimeTolerance is the maximum difference of the runtimes of episodes that are matched by name, as the runtime of the
+// same episode often differs slightly across servers.
+const RuntimeTolerance = time.Minute
+
+// Providers are the names of the supported providers.
+var Providers = []string{ProviderImdb, ProviderTmdb, ProviderTvdb, ProviderAniDb, ProviderTvMaze, ProviderMusicBrainz}
+
+// defaultPriorities are the strategies that are used if no priority has been configured for an item type.
+var defaultPriorities = map[jellyfin.ItemType][]string{
+	jellyfin.ItemMovie:      {ProviderImdb, ProviderTmdb},
+	jellyfin.ItemEpisode:    {seriesPrefix + ProviderTvdb, seriesPrefix + ProviderTmdb, seriesPrefix + ProviderImdb, ProviderImdb, ProviderTmdb, ProviderTvdb},
+	jellyfin.ItemAudio:      {ProviderMusicBrainz},
+	jellyfin.ItemAudioBook:  {ProviderMusicBrainz},
+	jellyfin.ItemMusicVideo: {ProviderImdb, ProviderMusicBrainz},
+}
+
+// Strategy derives a key from the metadata of an item. Items with the same key are considered to be the same item
+// across servers.
+type Strategy interface {
+	// Key returns the key of the item, false if the item lacks the metadata the strategy relies on.
+	Key(item jellyfin.Item) (string, bool)
+}
+
+// providerStrategy matches items by the ID of a provider.
+type providerStrategy string
+
+func (s providerStrategy) Key(item jellyfin.Item) (string, bool) {
+	return providerKey(string(s), providerID(item.ProviderIDs, string(s)))
+}
+
+// seriesStrategy matches episodes by the ID of their series at a provider and their season and episode number.
+type seriesStrategy string
+
+func (s seriesStrategy) Key(item jellyfin.Item) (string, bool) {
+	if item.ParentIndexNumber == nil || item.IndexNumber == nil {
+		return "", false
+	}
+
+	key, found := providerKey(string(s), providerID(item.SeriesProviderIDs, string(s)))
+	if !found {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s%s_s%d_e%d", seriesPrefix, key, *item.ParentIndexNumber, *item.IndexNumber), true
+}
+
+// nameStrategy matches items by their name, runtime and further metadata depending on the type of the item. It is the
+// last resort for items that none of the configured strategies apply to. Episodes are matched by the numbers of their
+// season and episode instead of their names if the numbers are known, as the names are often localized.
+type nameStrategy jellyfin.ItemType
+
+func (s nameStrategy) Key(item jellyfin.Item) (string, bool) {
+	var parts []string
+	switch jellyfin.ItemType(s) {
+	case jellyfin.ItemEpisode:
+		if item.ParentIndexNumber != nil && item.IndexNumber != nil {
+			parts = []string{item.SeriesName, fmt.Sprintf("s%d", *item.ParentIndexNumber), fmt.Sprintf("e%d", *item.IndexNumber)}
+		} else {
+			parts = []string{item.Name, item.SeriesName, item.SeasonName}
+		}
+	case jellyfin.ItemAudio, jellyfin.ItemAudioBook:
+		parts = []string{item.Name, item.Album, item.Artist()}
+	case jellyfin.ItemMusicVideo:
+		parts = []string{item.Name, item.Artist()}
+	default:
+		parts = []string{item.Name}
+	}
+
+	return fmt.Sprintf("%s%s_%d", namePrefix, strings.Join(parts, "_"), item.Runtime), true
+}
+
+// Matcher derives the key of an item using the first of its strategies that applies to the item and falls back to
+// matching by name.
+type Matcher struct {
+	strategies []Strategy
+	fallback   Strategy
+}
+
+// NewMatcher returns a Matcher for items of the given type that tries the strategies in the given order. Strategies
+// are named after a provider, such as "imdb", or prefixed with "series_" to match episodes by the provider ID of their
+// series and their season and episode number, such as "series_tvdb". An empty priority uses the default strategies
+// of the item type.
+func NewMatcher(itemType jellyfin.ItemType, priority []string) (*Matcher, error) {
+	defaultPriority, found := defaultPriorities[itemType]
+	if !found {
+		return nil, fmt.Errorf("unknown item type: %s", itemType)
+	}
+	if len(priority) == 0 {
+		priority = defaultPriority
+	}
+
+	ret := &Matcher{
+		fallback: nameStrategy(itemType),
+	}
+
+	var errs error
+	for _, name := range priority {
+		strategy, err := parseStrategy(itemType, name)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		ret.strategies = append(ret.strategies, strategy)
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+
+	return ret, nil
+}
+
+// MustNewMatcher returns the Matcher with the default strategies of the item type.
+func MustNewMatcher(itemType jellyfin.ItemType) *Matcher {
+	matcher, err := NewMatcher(itemType, nil)
+	if err != nil {
+		panic(err)
+	}
+	return matcher
+}
+
+func parseStrategy(itemType jellyfin.ItemType, name string) (Strategy, error) {
+	name = strings.ToLower(name)
+	if provider, found := strings.CutPrefix(name, seriesPrefix); found {
+		if itemType != jellyfin.ItemEpisode {
+			return nil, fmt.Errorf("strategy %q is only supported for episodes", name)
+		}
+		if !slices.Contains(Providers, provider) || provider == ProviderMusicBrainz {
+			return nil, fmt.Errorf("unknown series provider %q", provider)
+		}
+		return seriesStrategy(provider), nil
+	}
+
+	if !slices.Contains(Providers, name) {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+	return providerStrategy(name), nil
+}
+
+// Key returns the key that identifies the item across servers.
+func (m *Matcher) Key(item jellyfin.Item) string {
+	for _, strategy := range m.strategies {
+		if key, found := strategy.Key(item); found {
+			return key
+		}
+	}
+
+	key, _ := m.fallback.Key(item)
+	return key
+}
+
+// ProviderKey returns the key of items that are matched by the given provider ID.
+func ProviderKey(provider, id string) (string, error) {
+	provider = strings.ToLower(provider)
+	if !slices.Contains(Providers, provider) {
+		return "", fmt.Errorf("unknown provider: %q", provider)
+	}
+
+	key, found := providerKey(provider, id)
+	if !found {
+		return "", fmt.Errorf("invalid %s id: %q", provider, id)
+	}
+	return key, nil
+}
+
+// IsNameKey returns true if the key has been derived from the name of an item because none of the strategies applied.
+func IsNameKey(key string) bool {
+	return strings.HasPrefix(key, namePrefix)
+}
+
+// ProviderIDs returns the normalized IDs by provider, omitting providers without an ID.
+func ProviderIDs(ids jellyfin.ProviderIDs) map[string]string {
+	ret := map[string]string{}
+	for _, provider := range Providers {
+		if id := normalizeID(providerID(ids, provider)); id != "" {
+			ret[provider] = id
+		}
+	}
+	return ret
+}
+
+func providerKey(provider, id string) (string, bool) {
+	id = normalizeID(id)
+	if id == "" {
+		return "", false
+	}
+	return provider + "_" + id, true
+}
+
+// normalizeID keeps IDs as text, e.g. to not lose the prefix and leading zeros of IMDB IDs, but ignores their case and
+// surrounding whitespace.
+func normalizeID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
+
+func providerID(ids jellyfin.ProviderIDs, provider string) string {
+	switch provider {
+	case ProviderImdb:
+		return ids.IMDB
+	case ProviderTmdb:
+		return ids.TMDB
+	case ProviderTvdb:
+		return ids.TVDB
+	case ProviderAniDb:
+		return ids.AniDB
+	case ProviderTvMaze:
+		return ids.TVmaze
+	case ProviderMusicBrainz:
+		return ids.MusicBrainzTrack
+	default:
+		return ""
+	}
+}
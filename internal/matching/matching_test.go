@@ -0,0 +1,123 @@
+package matching
+
+import (
+	"testing"
+
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+func TestMatcher_Key(t *testing.T) {
+	season, episode := 1, 2
+
+	tests := []struct {
+		name     string
+		itemType jellyfin.ItemType
+		priority []string
+		item     jellyfin.Item
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Default priority",
+			itemType: jellyfin.ItemMovie,
+			item:     jellyfin.Item{Name: "The Matrix", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093", TMDB: "603"}},
+			want:     "imdb_tt0133093",
+		},
+		{
+			name:     "IDs are kept as text",
+			itemType: jellyfin.ItemMovie,
+			item:     jellyfin.Item{Name: "The Matrix", ProviderIDs: jellyfin.ProviderIDs{IMDB: " TT0133093 "}},
+			want:     "imdb_tt0133093",
+		},
+		{
+			name:     "Configured priority",
+			itemType: jellyfin.ItemMovie,
+			priority: []string{"tmdb", "imdb"},
+			item:     jellyfin.Item{Name: "The Matrix", ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093", TMDB: "603"}},
+			want:     "tmdb_603",
+		},
+		{
+			name:     "Next strategy if id is missing",
+			itemType: jellyfin.ItemEpisode,
+			priority: []string{"anidb", "tvmaze"},
+			item:     jellyfin.Item{Name: "Pilot", ProviderIDs: jellyfin.ProviderIDs{TVmaze: "1"}},
+			want:     "tvmaze_1",
+		},
+		{
+			name:     "Series",
+			itemType: jellyfin.ItemEpisode,
+			priority: []string{"series_tvdb", "imdb"},
+			item: jellyfin.Item{
+				Name:              "Pilot",
+				ProviderIDs:       jellyfin.ProviderIDs{IMDB: "tt0959621"},
+				SeriesProviderIDs: jellyfin.ProviderIDs{TVDB: "81189"},
+				ParentIndexNumber: &season,
+				IndexNumber:       &episode,
+			},
+			want: "series_tvdb_81189_s1_e2",
+		},
+		{
+			name:     "Episodes are matched by their series by default",
+			itemType: jellyfin.ItemEpisode,
+			item: jellyfin.Item{
+				Name:              "Pilot",
+				ProviderIDs:       jellyfin.ProviderIDs{IMDB: "tt0959621"},
+				SeriesProviderIDs: jellyfin.ProviderIDs{TMDB: "1396"},
+				ParentIndexNumber: &season,
+				IndexNumber:       &episode,
+			},
+			want: "series_tmdb_1396_s1_e2",
+		},
+		{
+			name:     "Series without episode number",
+			itemType: jellyfin.ItemEpisode,
+			priority: []string{"series_tvdb", "imdb"},
+			item: jellyfin.Item{
+				Name:              "Pilot",
+				ProviderIDs:       jellyfin.ProviderIDs{IMDB: "tt0959621"},
+				SeriesProviderIDs: jellyfin.ProviderIDs{TVDB: "81189"},
+				ParentIndexNumber: &season,
+			},
+			want: "imdb_tt0959621",
+		},
+		{
+			name:     "Fallback to name",
+			itemType: jellyfin.ItemEpisode,
+			item:     jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", Runtime: 5000},
+			want:     "name_Pilot_Breaking Bad_Season 1_5000",
+		},
+		{
+			name:     "Fallback to season and episode number",
+			itemType: jellyfin.ItemEpisode,
+			item:     jellyfin.Item{Name: "Pilot", SeriesName: "Breaking Bad", SeasonName: "Season 1", ParentIndexNumber: &season, IndexNumber: &episode, Runtime: 5000},
+			want:     "name_Breaking Bad_s1_e2_5000",
+		},
+		{
+			name:     "Series of movies",
+			itemType: jellyfin.ItemMovie,
+			priority: []string{"series_tvdb"},
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown provider",
+			itemType: jellyfin.ItemMovie,
+			priority: []string{"imdb", "letterboxd"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := NewMatcher(tt.itemType, tt.priority)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := matcher.Key(tt.item); got != tt.want {
+				t.Errorf("Key() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
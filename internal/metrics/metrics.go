@@ -28,21 +28,28 @@ var (
 		Subsystem: subsystemMedia,
 		Name:      "items_total",
 		Help:      "Total number of items",
-	}, []string{"server", "type"})
+	}, []string{"server", "user", "type"})
 
 	TotalItemsTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: subsystemMedia,
 		Name:      "items_fetched_timestamp_seconds",
 		Help:      "Timestamp when fetched number of items",
-	}, []string{"server", "type"})
+	}, []string{"server", "user", "type"})
 
 	ItemsUpdatedUserData = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: subsystemMedia,
 		Name:      "items_updated_userdata_total",
 		Help:      "Total number of movies with updated UserData found",
-	}, []string{"server", "type"})
+	}, []string{"server", "user", "type"})
+
+	ItemsUpdatedFavorite = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystemMedia,
+		Name:      "items_updated_favorite_total",
+		Help:      "Total number of items with updated favorite state found",
+	}, []string{"server", "user", "type"})
 
 	RequestsTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
@@ -65,6 +72,26 @@ var (
 		Help:      "Total amount of cooldown phases because of too frequent requests from event sources",
 	})
 
+	EventSourceQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "queue_depth",
+		Help:      "Number of syncs requested by event sources that are queued until the end of the cooldown phase",
+	})
+
+	Paused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "paused",
+		Help:      "Whether syncing has been paused using the API",
+	})
+
+	ClientConsecutiveFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "client",
+		Name:      "consecutive_failures",
+		Help:      "Number of consecutive syncs that have failed to reach a client",
+	}, []string{"server"})
+
 	EventSourceErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: "events",
@@ -18,7 +18,8 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func StartServer(ctx context.Context, addr string, wg *sync.WaitGroup) error {
+// StartServer serves the metrics on /metrics and the given handlers, such as health checks, on their paths.
+func StartServer(ctx context.Context, addr string, wg *sync.WaitGroup, handlers map[string]http.Handler) error {
 	if wg == nil {
 		return errors.New("nil waitgroup passed")
 	}
@@ -28,6 +29,9 @@ func StartServer(ctx context.Context, addr string, wg *sync.WaitGroup) error {
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+	}
 
 	server := http.Server{
 		Addr:              addr,
@@ -0,0 +1,10 @@
+package internal
+
+// WithDryRun makes the app only plan updates instead of sending them to Jellyfin. The SQLite cache is populated as
+// usual, but the state is left untouched. Planned updates can be retrieved using PlannedUpdates.
+func WithDryRun() func(a *App) error {
+	return func(a *App) error {
+		a.dryRun = true
+		return nil
+	}
+}
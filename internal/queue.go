@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"sync"
+
+	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+// queuedItem identifies a targeted event, events that refer to the same item are only synced once.
+type queuedItem struct {
+	server   string
+	serverID string
+	itemID   string
+	userID   string
+}
+
+// syncQueue coalesces the events that arrive during a cooldown phase. All requests for a full sync are merged into a
+// single sync, events that refer to a single item are accumulated into a set. A queued full sync supersedes the events
+// that refer to a single item, which are remembered as superseded.
+type syncQueue struct {
+	mutex sync.Mutex
+	full  bool
+	// superseded is true if events of single items have been dropped in favor of the queued full sync
+	superseded bool
+	items      []events.EventSyncRequest
+	seen       map[queuedItem]struct{}
+}
+
+func newSyncQueue() *syncQueue {
+	return &syncQueue{
+		seen: map[queuedItem]struct{}{},
+	}
+}
+
+// add queues the event, returns false if the event has been merged into an already queued event.
+func (q *syncQueue) add(event events.EventSyncRequest) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	defer q.updateMetric()
+
+	if !event.IsTargeted() {
+		if q.full {
+			return false
+		}
+		q.full = true
+		q.superseded = len(q.items) > 0
+		q.items = nil
+		clear(q.seen)
+		return true
+	}
+
+	if q.full {
+		q.superseded = true
+		return false
+	}
+
+	key := queuedItem{
+		server:   event.Server,
+		serverID: event.ServerID,
+		itemID:   event.ItemID,
+		userID:   event.UserID,
+	}
+	if _, found := q.seen[key]; found {
+		return false
+	}
+
+	q.seen[key] = struct{}{}
+	q.items = append(q.items, event)
+	return true
+}
+
+// len returns the number of syncs that are queued.
+func (q *syncQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size()
+}
+
+func (q *syncQueue) size() int {
+	if q.full {
+		return len(q.items) + 1
+	}
+	return len(q.items)
+}
+
+// take empties the queue and returns whether a full sync has been requested and whether it has superseded events of
+// single items, or else the queued item events in the order they have arrived.
+func (q *syncQueue) take() (bool, bool, []events.EventSyncRequest) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	defer q.updateMetric()
+
+	full, superseded, items := q.full, q.superseded, q.items
+	q.full = false
+	q.superseded = false
+	q.items = nil
+	clear(q.seen)
+	return full, superseded, items
+}
+
+func (q *syncQueue) updateMetric() {
+	metrics.EventSourceQueueDepth.Set(float64(q.size()))
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/metrics"
+)
+
+func TestSyncQueue(t *testing.T) {
+	full := events.EventSyncRequest{Source: "mqtt"}
+	item := func(server, itemID string) events.EventSyncRequest {
+		return events.EventSyncRequest{Source: "webhook", Server: server, ItemID: itemID}
+	}
+
+	tests := []struct {
+		name      string
+		events    []events.EventSyncRequest
+		wantAdded []bool
+		wantFull  bool
+		// wantSuperseded is true if events of single items have been dropped in favor of the full sync
+		wantSuperseded bool
+		wantItems      []events.EventSyncRequest
+	}{
+		{
+			name: "Empty queue",
+		},
+		{
+			name:      "Items are taken in the order they arrived",
+			events:    []events.EventSyncRequest{item("a", "2"), item("a", "1"), item("b", "1")},
+			wantAdded: []bool{true, true, true},
+			wantItems: []events.EventSyncRequest{item("a", "2"), item("a", "1"), item("b", "1")},
+		},
+		{
+			name:      "Events of the same item are deduplicated",
+			events:    []events.EventSyncRequest{item("a", "1"), item("a", "2"), item("a", "1")},
+			wantAdded: []bool{true, true, false},
+			wantItems: []events.EventSyncRequest{item("a", "1"), item("a", "2")},
+		},
+		{
+			name: "Events of the same item of other users are kept",
+			events: []events.EventSyncRequest{
+				{Server: "a", ItemID: "1", UserID: "alice"},
+				{Server: "a", ItemID: "1", UserID: "bob"},
+			},
+			wantAdded: []bool{true, true},
+			wantItems: []events.EventSyncRequest{
+				{Server: "a", ItemID: "1", UserID: "alice"},
+				{Server: "a", ItemID: "1", UserID: "bob"},
+			},
+		},
+		{
+			name:      "Full syncs are coalesced",
+			events:    []events.EventSyncRequest{full, full, full},
+			wantAdded: []bool{true, false, false},
+			wantFull:  true,
+		},
+		{
+			name:           "Full sync supersedes queued items",
+			events:         []events.EventSyncRequest{item("a", "1"), item("b", "1"), full},
+			wantAdded:      []bool{true, true, true},
+			wantFull:       true,
+			wantSuperseded: true,
+		},
+		{
+			name:           "Items are merged into a queued full sync",
+			events:         []events.EventSyncRequest{full, item("a", "1"), full},
+			wantAdded:      []bool{true, false, false},
+			wantFull:       true,
+			wantSuperseded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSyncQueue()
+			for idx, event := range tt.events {
+				if got := q.add(event); got != tt.wantAdded[idx] {
+					t.Errorf("add(%d) got = %v, want %v", idx, got, tt.wantAdded[idx])
+				}
+			}
+
+			wantLen := len(tt.wantItems)
+			if tt.wantFull {
+				wantLen++
+			}
+			if got := q.len(); got != wantLen {
+				t.Errorf("len() got = %d, want %d", got, wantLen)
+			}
+			if got := testutil.ToFloat64(metrics.EventSourceQueueDepth); got != float64(wantLen) {
+				t.Errorf("queue depth metric got = %v, want %d", got, wantLen)
+			}
+
+			gotFull, gotSuperseded, gotItems := q.take()
+			if gotFull != tt.wantFull {
+				t.Errorf("take() full = %v, want %v", gotFull, tt.wantFull)
+			}
+			if gotSuperseded != tt.wantSuperseded {
+				t.Errorf("take() superseded = %v, want %v", gotSuperseded, tt.wantSuperseded)
+			}
+			if !reflect.DeepEqual(gotItems, tt.wantItems) {
+				t.Errorf("take() items = %v, want %v", gotItems, tt.wantItems)
+			}
+
+			if got := q.len(); got != 0 {
+				t.Errorf("len() after take() got = %d, want 0", got)
+			}
+			if got := testutil.ToFloat64(metrics.EventSourceQueueDepth); got != 0 {
+				t.Errorf("queue depth metric after take() got = %v, want 0", got)
+			}
+
+			// taken events can be queued again
+			for _, event := range tt.events[:min(1, len(tt.events))] {
+				if !q.add(event) {
+					t.Errorf("add() after take() got = false, want true")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"go.uber.org/multierr"
+)
+
+// Revert restores the previous UserData of all changelog entries matching the given filter, newest entries first.
+// Each revert is recorded in the changelog itself, all reverts of a single invocation share a run ID. In dry run mode,
+// the reverts are only planned. Entries that are reverts themselves or that have already been reverted are skipped.
+// Returns the number of entries that have been reverted.
+func (a *App) Revert(ctx context.Context, filter sqlite.ChangelogFilter) (int, error) {
+	// Prevent reverts and syncs running simultaneously
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.resetPlannedUpdates()
+	a.runID = newRunID()
+
+	entries, err := a.db.GetChangelog(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var reverted int
+	var errs error
+	for _, entry := range entries {
+		if entry.Reverts > 0 {
+			log.Debug().Int64("changelog_id", entry.ID).Str("id", entry.LocalID).Str("server", entry.Server).Msg("Not reverting changelog entry, it is a revert itself")
+			continue
+		}
+
+		if entry.RevertedBy > 0 {
+			log.Info().Int64("changelog_id", entry.ID).Int64("reverted_by", entry.RevertedBy).Str("id", entry.LocalID).Str("server", entry.Server).Msg("Not reverting changelog entry, it has already been reverted")
+			continue
+		}
+
+		if !entry.HasPrevious() {
+			log.Warn().Int64("changelog_id", entry.ID).Str("id", entry.LocalID).Str("server", entry.Server).Msg("Not reverting changelog entry, previous values are unknown")
+			continue
+		}
+
+		data := getRevertUserData(entry)
+		if data == nil {
+			log.Debug().Int64("changelog_id", entry.ID).Str("id", entry.LocalID).Str("server", entry.Server).Msg("Not reverting changelog entry, no fields have been changed")
+			continue
+		}
+
+		if err := a.revertEntry(ctx, entry, *data); err != nil {
+			errs = multierr.Append(errs, err)
+			log.Error().Err(err).Int64("changelog_id", entry.ID).Str("id", entry.LocalID).Str("name", entry.Name).Str("server", entry.Server).Str("user", entry.User).Msg("Could not revert changelog entry")
+			continue
+		}
+		reverted++
+	}
+
+	log.Info().Str("run", a.runID).Msgf("Reverted %d of %d changelog entries", reverted, len(entries))
+	return reverted, errs
+}
+
+func (a *App) revertEntry(ctx context.Context, entry sqlite.ChangelogEntry, data jellyfin.UserDataUpdate) error {
+	userName, found := a.users[entry.User][entry.Server]
+	if !found {
+		return fmt.Errorf("user %q is not configured for server %q", entry.User, entry.Server)
+	}
+
+	client, found := a.clients[entry.Server]
+	if !found {
+		return fmt.Errorf("no client for server %q", entry.Server)
+	}
+
+	if a.dryRun {
+		a.planUpdate(entry.Server, entry.User, jellyfin.ItemType(entry.Type), entry.LocalID, entry.Name, entry.SeriesName, data)
+		return nil
+	}
+
+	userId, err := client.GetUserId(ctx, userName)
+	if err != nil {
+		return err
+	}
+
+	if err := client.UpdateUserData(ctx, userId, entry.LocalID, data); err != nil {
+		return err
+	}
+	log.Info().Int64("changelog_id", entry.ID).Str("id", entry.LocalID).Str("name", entry.Name).Str("server", entry.Server).Str("user", entry.User).Msg("Reverted UserData for item")
+
+	// Without restoring the cached item, the next sync would date the reverted values as the most recent change and
+	// propagate them to all other servers. Items that are not cached anymore have no type.
+	if entry.Type != "" {
+		if err := a.db.RevertUserData(ctx, entry.Server, entry.User, jellyfin.ItemType(entry.Type), entry.LocalID, data); err != nil {
+			log.Error().Str("server", entry.Server).Str("user", entry.User).Str("id", entry.LocalID).Err(err).Msg("Could not restore cached item")
+		}
+	}
+
+	if err := a.db.InsertChangelog(ctx, entry.Server, entry.User, getRevertChangelogData(entry, a.runID)); err != nil {
+		log.Error().Str("server", entry.Server).Str("user", entry.User).Err(err).Msg("Could not insert changelog")
+	}
+	return nil
+}
+
+// getRevertUserData returns the UserData that restores the previous values of all fields that have been changed by
+// the given changelog entry. Returns nil if no fields have been changed.
+func getRevertUserData(entry sqlite.ChangelogEntry) *jellyfin.UserDataUpdate {
+	changed := entry.ChangedFields()
+	if len(changed) == 0 {
+		return nil
+	}
+
+	data := &jellyfin.UserDataUpdate{}
+	if slices.Contains(changed, sqlite.FieldPlayed) {
+		data.Played = &entry.PreviousPlayed
+	}
+	if slices.Contains(changed, sqlite.FieldPositionTicks) {
+		data.PlaybackPositionTicks = &entry.PreviousWatchedPositionTicks
+	}
+	// Jellyfin can not unset the date an item has been played last
+	if slices.Contains(changed, sqlite.FieldWatchedDate) && entry.PreviousWatchedDate > 0 {
+		lastPlayed := time.Unix(entry.PreviousWatchedDate, 0)
+		data.LastPlayedDate = &lastPlayed
+	}
+	if slices.Contains(changed, sqlite.FieldFavorite) {
+		data.IsFavorite = &entry.PreviousIsFavorite
+	}
+
+	if len(getUpdatedFields(*data)) == 0 {
+		return nil
+	}
+	return data
+}
+
+func getRevertChangelogData(entry sqlite.ChangelogEntry, runID string) sqlite.ChangelogData {
+	return sqlite.ChangelogData{
+		LocalID:                      entry.LocalID,
+		NewWatchedDate:               entry.PreviousWatchedDate,
+		NewWatchedPositionTicks:      entry.PreviousWatchedPositionTicks,
+		NewIsFavorite:                entry.PreviousIsFavorite,
+		NewPlayed:                    entry.PreviousPlayed,
+		PreviousWatchedDate:          entry.NewWatchedDate,
+		PreviousWatchedPositionTicks: entry.NewWatchedPositionTicks,
+		PreviousIsFavorite:           entry.NewIsFavorite,
+		PreviousPlayed:               entry.NewPlayed,
+		Reason:                       sqlite.ReasonRevert,
+		RunID:                        runID,
+		Reverts:                      entry.ID,
+	}
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/config"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+func TestApp_Revert(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, played bool) jellyfin.Item {
+		return jellyfin.Item{
+			Name:        "The Matrix",
+			ID:          id,
+			Type:        string(jellyfin.ItemMovie),
+			UserData:    jellyfin.UserData{LastPlayedDate: watched, Played: played},
+			ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093"},
+			Runtime:     5000,
+		}
+	}
+
+	// the movie has been played on server a and has been synced to server b
+	db := sqlite.MustNew("")
+	if err := db.InsertItems(t.Context(), "a", config.DefaultUser, jellyfin.ItemMovie, []jellyfin.Item{matrix("1", true)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+	if err := db.InsertItems(t.Context(), "b", config.DefaultUser, jellyfin.ItemMovie, []jellyfin.Item{matrix("2", true)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+	change := sqlite.ChangelogData{
+		LocalID:             "2",
+		NewWatchedDate:      watched.Unix(),
+		NewPlayed:           true,
+		SourceServer:        "a",
+		SourceLocalID:       "1",
+		PreviousWatchedDate: watched.Unix(),
+		Reason:              sqlite.ReasonPlayed,
+		RunID:               "sync",
+	}
+	if err := db.InsertChangelog(t.Context(), "b", config.DefaultUser, change); err != nil {
+		t.Fatalf("could not insert changelog: %v", err)
+	}
+
+	clientA := &fakeJellyfin{}
+	clientB := &fakeJellyfin{}
+	app := newTestApp(t, db, map[string]JellyfinClient{"a": clientA, "b": clientB})
+
+	reverted, err := app.Revert(t.Context(), sqlite.ChangelogFilter{Server: "b"})
+	if err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if reverted != 1 {
+		t.Errorf("Revert() reverted = %d, want 1", reverted)
+	}
+	if update, found := clientB.updates["2"]; !found || update.Played == nil || *update.Played {
+		t.Errorf("expected movie to be unplayed on server b, got %v", clientB.updates)
+	}
+	if len(clientA.updates) > 0 {
+		t.Errorf("expected no updates on server a, got %v", clientA.updates)
+	}
+
+	// an entry is only reverted once
+	clientB.updates = nil
+	reverted, err = app.Revert(t.Context(), sqlite.ChangelogFilter{Server: "b"})
+	if err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if reverted != 0 {
+		t.Errorf("Revert() reverted = %d, want 0", reverted)
+	}
+	if len(clientB.updates) > 0 {
+		t.Errorf("expected no updates on server b, got %v", clientB.updates)
+	}
+
+	// the next sync fetches the reverted movie, which must not be propagated back to server a
+	if err := db.InsertItems(t.Context(), "b", config.DefaultUser, jellyfin.ItemMovie, []jellyfin.Item{matrix("2", false)}); err != nil {
+		t.Fatalf("could not insert movie: %v", err)
+	}
+	for _, server := range []string{"a", "b"} {
+		got, err := db.GetItemsWithUpdatedUserData(t.Context(), server, config.DefaultUser, jellyfin.ItemMovie)
+		if err != nil {
+			t.Fatalf("GetItemsWithUpdatedUserData() error = %v", err)
+		}
+		if len(got) != 0 {
+			t.Errorf("expected no updates for server %s, got %v", server, got)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/events"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+	"github.com/soerenschneider/jellyporter/internal/matching"
+	"go.uber.org/multierr"
+)
+
+var (
+	ErrNoMatchingItems = errors.New("no matching items found")
+	ErrItemExcluded    = errors.New("item is excluded by the filters of the client")
+)
+
+// SyncItem synchronizes the UserData of a single item, identified by the server and its local ID on that server, and
+// of all items on the other servers that are identical to it. Instead of fetching all items, only the matching items
+// are fetched from the servers.
+func (a *App) SyncItem(ctx context.Context, user, server, localID string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.resetPlannedUpdates()
+	a.runID = newRunID()
+
+	item, err := a.fetchItem(ctx, user, server, localID)
+	if err != nil {
+		return err
+	}
+
+	itemType := jellyfin.ItemType(item.Type)
+	if !slices.Contains(a.itemTypes, itemType) {
+		return fmt.Errorf("items of type %q are not synced", item.Type)
+	}
+
+	if err := a.checkFilter(ctx, user, server, *item); err != nil {
+		return err
+	}
+
+	if err := a.db.InsertItems(ctx, server, user, itemType, []jellyfin.Item{*item}); err != nil {
+		return err
+	}
+
+	return a.syncMatchingItems(ctx, user, itemType, server, localID, "")
+}
+
+// SyncItemByProviderID synchronizes the UserData of all items of the given type that match the given provider ID, such
+// as an IMDB ID, across all servers.
+func (a *App) SyncItemByProviderID(ctx context.Context, user string, itemType jellyfin.ItemType, provider, id string) error {
+	if !slices.Contains(a.itemTypes, itemType) {
+		return fmt.Errorf("items of type %q are not synced", itemType)
+	}
+
+	matchKey, err := matching.ProviderKey(provider, id)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.resetPlannedUpdates()
+	a.runID = newRunID()
+
+	return a.syncMatchingItems(ctx, user, itemType, "", "", matchKey)
+}
+
+// SyncEvent synchronizes the item an event refers to for all users of the server that has sent the event, or only for
+// the user the event refers to if the user is known.
+func (a *App) SyncEvent(ctx context.Context, event events.EventSyncRequest) error {
+	if !event.IsTargeted() {
+		return errors.New("event does not refer to a single item")
+	}
+
+	server := event.Server
+	if server == "" {
+		var err error
+		if server, err = a.resolveServer(ctx, event.ServerID); err != nil {
+			return err
+		}
+	} else if _, found := a.clients[server]; !found {
+		return fmt.Errorf("unknown client %q", server)
+	}
+
+	var errs error
+	var synced int
+	for user, servers := range a.users {
+		userName, found := servers[server]
+		if !found {
+			continue
+		}
+
+		if event.UserID != "" {
+			userId, err := a.clients[server].GetUserId(ctx, userName)
+			if err != nil {
+				errs = multierr.Append(errs, err)
+				continue
+			}
+			if !sameJellyfinId(userId, event.UserID) {
+				continue
+			}
+		}
+
+		synced++
+		err := a.SyncItem(ctx, user, server, event.ItemID)
+		if errors.Is(err, ErrItemExcluded) {
+			log.Debug().Str("server", server).Str("user", user).Str("item", event.ItemID).Msg("Ignoring event for item that is excluded by the filters")
+			continue
+		}
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("could not sync item %q for user %q: %w", event.ItemID, user, err))
+		}
+	}
+
+	if synced == 0 && errs == nil {
+		return fmt.Errorf("no configured user found for user id %q on server %q", event.UserID, server)
+	}
+
+	return errs
+}
+
+// sameJellyfinId compares two Jellyfin IDs, which are GUIDs that are formatted both with and without dashes depending on
+// the API.
+func sameJellyfinId(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, "-", ""), strings.ReplaceAll(b, "-", ""))
+}
+
+// resolveServer returns the name of the client whose Jellyfin server has the given ID.
+func (a *App) resolveServer(ctx context.Context, serverID string) (string, error) {
+	var errs error
+	for name, client := range a.clients {
+		id, err := client.GetServerId(ctx)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if id == serverID {
+			return name, nil
+		}
+	}
+
+	return "", multierr.Append(fmt.Errorf("no client found for server id %q", serverID), errs)
+}
+
+// fetchItem fetches a single item including its UserData from the server.
+func (a *App) fetchItem(ctx context.Context, user, server, localID string) (*jellyfin.Item, error) {
+	userName, found := a.users[user][server]
+	if !found {
+		return nil, fmt.Errorf("user %q is not configured for server %q", user, server)
+	}
+
+	client := a.clients[server]
+	userId, err := client.GetUserId(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetItem(ctx, userId, localID)
+}
+
+// checkFilter returns ErrItemExcluded if the item does not match the filter of the server.
+func (a *App) checkFilter(ctx context.Context, user, server string, item jellyfin.Item) error {
+	filter, found := a.filters[server]
+	if !found || filter.IsEmpty() {
+		return nil
+	}
+
+	client := a.clients[server]
+	userId, err := client.GetUserId(ctx, a.users[user][server])
+	if err != nil {
+		return err
+	}
+
+	included, err := client.IsIncluded(ctx, userId, item, filter)
+	if err != nil {
+		return err
+	}
+	if !included {
+		return ErrItemExcluded
+	}
+
+	return nil
+}
+
+// syncMatchingItems refreshes the cached UserData of all items that match either the given item or the given key and
+// pushes the UserData of the most recently changed item to the other servers.
+func (a *App) syncMatchingItems(ctx context.Context, user string, itemType jellyfin.ItemType, server, localID, matchKey string) error {
+	start := time.Now()
+	matches, err := a.db.GetItemMatches(ctx, user, itemType, server, localID, matchKey)
+	if err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		return ErrNoMatchingItems
+	}
+
+	// localIds holds the local IDs of the matching items per server
+	localIds := map[string][]string{}
+	for _, match := range matches {
+		if _, found := a.users[user][match.Server]; !found {
+			continue
+		}
+		localIds[match.Server] = append(localIds[match.Server], match.LocalID)
+	}
+
+	var mutex sync.Mutex
+	var errs error
+	var wg sync.WaitGroup
+	// failed holds the servers that could not be refreshed, their cached UserData may be outdated
+	failed := map[string]bool{}
+	for matchServer, ids := range localIds {
+		for _, id := range ids {
+			if matchServer == server && id == localID {
+				// has already been fetched
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := a.refreshItem(ctx, user, matchServer, id, itemType); err != nil {
+					mutex.Lock()
+					errs = multierr.Append(errs, err)
+					failed[matchServer] = true
+					mutex.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	// servers that could not be refreshed are skipped and marked stale like servers that could not be fetched, so
+	// their outdated UserData is not used as source, and the remaining servers are still synced with each other
+	for failedServer := range failed {
+		log.Warn().Str("server", failedServer).Str("user", user).Str("type", string(itemType)).Msg("Could not refresh matching item, skipping server and marking it stale")
+		delete(localIds, failedServer)
+		if !a.dryRun {
+			if err := a.db.MarkStale(ctx, failedServer, user, itemType, time.Now()); err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+	}
+
+	for matchServer, ids := range localIds {
+		userName := a.users[user][matchServer]
+
+		updated, err := a.db.GetItemsWithUpdatedUserData(ctx, matchServer, user, itemType)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		} else {
+			updated = slices.DeleteFunc(updated, func(item sqlite.ItemWithUpdatedUserData) bool {
+				return !slices.Contains(ids, item.LocalID)
+			})
+			if err := a.pushUserData(ctx, itemType, matchServer, user, userName, updated); err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+
+		favorites, err := a.db.GetItemsWithUpdatedFavorite(ctx, matchServer, user, itemType)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+		} else {
+			favorites = slices.DeleteFunc(favorites, func(item sqlite.ItemWithUpdatedFavorite) bool {
+				return !slices.Contains(ids, item.LocalID)
+			})
+			if err := a.pushFavorites(ctx, itemType, matchServer, user, userName, favorites); err != nil {
+				errs = multierr.Append(errs, err)
+			}
+		}
+	}
+
+	log.Info().Str("user", user).Str("type", string(itemType)).Str("run", a.runID).Dur("duration", time.Since(start)).Msgf("Finished syncing %d matching items", len(matches))
+	return errs
+}
+
+// refreshItem fetches a single item from the server and updates its cached UserData.
+func (a *App) refreshItem(ctx context.Context, user, server, localID string, itemType jellyfin.ItemType) error {
+	item, err := a.fetchItem(ctx, user, server, localID)
+	if err != nil {
+		return err
+	}
+
+	return a.db.InsertItems(ctx, server, user, itemType, []jellyfin.Item{*item})
+}
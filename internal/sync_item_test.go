@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soerenschneider/jellyporter/internal/config"
+	"github.com/soerenschneider/jellyporter/internal/database/sqlite"
+	"github.com/soerenschneider/jellyporter/internal/jellyfin"
+)
+
+// fakeJellyfin serves single items and records the UserData updates it receives.
+type fakeJellyfin struct {
+	JellyfinClient
+	items map[string]jellyfin.Item
+	err   error
+
+	mutex   sync.Mutex
+	updates map[string]jellyfin.UserDataUpdate
+}
+
+func (f *fakeJellyfin) GetUserId(_ context.Context, _ string) (string, error) {
+	return "user-id", nil
+}
+
+func (f *fakeJellyfin) GetItem(_ context.Context, _, itemID string) (*jellyfin.Item, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	item, found := f.items[itemID]
+	if !found {
+		return nil, errors.New("not found")
+	}
+	return &item, nil
+}
+
+func (f *fakeJellyfin) UpdateUserData(_ context.Context, _, itemID string, data jellyfin.UserDataUpdate) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.updates == nil {
+		f.updates = map[string]jellyfin.UserDataUpdate{}
+	}
+	f.updates[itemID] = data
+	return nil
+}
+
+func TestApp_SyncItem(t *testing.T) {
+	watched := time.Date(2025, 06, 15, 15, 0, 0, 0, time.UTC)
+	matrix := func(id string, played bool) jellyfin.Item {
+		item := jellyfin.Item{
+			Name:        "The Matrix",
+			ID:          id,
+			Type:        string(jellyfin.ItemMovie),
+			ProviderIDs: jellyfin.ProviderIDs{IMDB: "tt0133093"},
+			Runtime:     5000,
+		}
+		if played {
+			item.UserData = jellyfin.UserData{LastPlayedDate: watched, Played: true, PlayCount: 1}
+		}
+		return item
+	}
+
+	tests := []struct {
+		name        string
+		unreachable []string
+		wantErr     bool
+		wantUpdated []string
+		wantStale   []string
+	}{
+		{
+			name:        "All servers are updated",
+			wantUpdated: []string{"b", "c"},
+		},
+		{
+			name:        "Servers that could not be refreshed are skipped",
+			unreachable: []string{"c"},
+			wantErr:     true,
+			wantUpdated: []string{"b"},
+			wantStale:   []string{"c"},
+		},
+		{
+			name:        "Nothing to push if all other servers could not be refreshed",
+			unreachable: []string{"b", "c"},
+			wantErr:     true,
+			wantStale:   []string{"b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sqlite.MustNew("")
+			clients := map[string]*fakeJellyfin{}
+			appClients := map[string]JellyfinClient{}
+			for idx, server := range []string{"a", "b", "c"} {
+				id := string(rune('1' + idx))
+				if err := db.InsertItems(t.Context(), server, config.DefaultUser, jellyfin.ItemMovie, []jellyfin.Item{matrix(id, false)}); err != nil {
+					t.Fatalf("could not insert movie: %v", err)
+				}
+				clients[server] = &fakeJellyfin{items: map[string]jellyfin.Item{id: matrix(id, server == "a")}}
+				appClients[server] = clients[server]
+			}
+			for _, server := range tt.unreachable {
+				clients[server].err = errors.New("connection refused")
+			}
+
+			app := newTestApp(t, db, appClients)
+			err := app.SyncItem(t.Context(), config.DefaultUser, "a", "1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SyncItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for server, client := range clients {
+				wantUpdate := slices.Contains(tt.wantUpdated, server)
+				if got := len(client.updates) > 0; got != wantUpdate {
+					t.Errorf("server %s: updated = %v, want %v", server, got, wantUpdate)
+				}
+				for _, update := range client.updates {
+					if update.Played == nil || !*update.Played {
+						t.Errorf("server %s: expected item to be played, got %v", server, update)
+					}
+				}
+
+				wantStale := slices.Contains(tt.wantStale, server)
+				stale, err := db.IsStale(t.Context(), server, config.DefaultUser, jellyfin.ItemMovie)
+				if err != nil {
+					t.Fatalf("IsStale() error = %v", err)
+				}
+				if stale != wantStale {
+					t.Errorf("server %s: stale = %v, want %v", server, stale, wantStale)
+				}
+			}
+		})
+	}
+}